@@ -0,0 +1,99 @@
+package backtest
+
+import (
+	"context"
+	"time"
+
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/stream"
+)
+
+// LiveRunner run a strategy against a real exchange with its streams.
+type LiveRunner struct {
+	ex         exchange.Exchange
+	hub        *stream.Hub
+	hasPrivate bool
+	strategy   Strategy
+	opt        Options
+}
+
+// NewLive public and private are wrapped by a Hub. wrap them with stream.SupervisePublic / SupervisePrivate to reconnect.
+// private may be nil if the strategy does not need fills.
+func NewLive(ex exchange.Exchange, public exchange.PublicStream, private exchange.PrivateStream, strategy Strategy, opt Options) *LiveRunner {
+	return &LiveRunner{
+		ex:         ex,
+		hub:        stream.NewHub(public, private),
+		hasPrivate: private != nil,
+		strategy:   strategy,
+		opt:        opt,
+	}
+}
+
+func (r *LiveRunner) Exchange() exchange.Exchange {
+	return r.ex
+}
+
+func (r *LiveRunner) Now() time.Time {
+	return time.Now()
+}
+
+// Run start streams and call the strategy until ctx is done, the strategy fails or streams stop.
+func (r *LiveRunner) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	topics := append([]exchange.Topic{}, r.opt.Topics...)
+	if r.hasPrivate {
+		topics = append(topics, exchange.Topic{Channel: exchange.OrderEventsChannel})
+	}
+	sub, err := r.hub.Subscribe(ctx, topics...)
+	if err != nil {
+		return err
+	}
+	if err := r.hub.Start(); err != nil {
+		return err
+	}
+	defer r.hub.Close()
+
+	if err := r.strategy.OnStart(r); err != nil {
+		return err
+	}
+
+	var timer <-chan time.Time
+	if r.opt.TimerInterval > 0 {
+		ticker := time.NewTicker(r.opt.TimerInterval)
+		defer ticker.Stop()
+		timer = ticker.C
+	}
+
+	for {
+		msg := &exchange.Message{}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer:
+			if err := r.strategy.OnTimer(r); err != nil {
+				return err
+			}
+			continue
+		case e, ok := <-sub.Executions:
+			if !ok {
+				return r.hub.Err()
+			}
+			msg.Execution = &e
+		case b, ok := <-sub.Boards:
+			if !ok {
+				return r.hub.Err()
+			}
+			msg.Board = &b
+		case ev, ok := <-sub.OrderEvents:
+			if !ok {
+				return r.hub.Err()
+			}
+			msg.OrderEvent = &ev
+		}
+		if err := dispatch(r.strategy, r, msg); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package backtest
+
+import (
+	"math"
+	"time"
+)
+
+// year 暗号資産は休まず取引されるので365日で年率にする
+const year = 365 * 24 * time.Hour
+
+// EquityPoint a sample of the equity curve in Options.Currency.
+type EquityPoint struct {
+	Time   time.Time `json:"time"`
+	Equity float64   `json:"equity"`
+	// Exposure notional value of positions.
+	Exposure float64 `json:"exposure"`
+}
+
+// Trade a round trip from a flat position of the symbol back to flat (or to the opposite side).
+// prices are averages. PnL is net of Fees, in Options.Currency.
+type Trade struct {
+	Symbol     string    `json:"symbol"`
+	IsLong     bool      `json:"is_long"`
+	Size       float64   `json:"size"`
+	EntryTime  time.Time `json:"entry_time"`
+	ExitTime   time.Time `json:"exit_time"`
+	EntryPrice float64   `json:"entry_price"`
+	ExitPrice  float64   `json:"exit_price"`
+	PnL        float64   `json:"pnl"`
+	Fees       float64   `json:"fees"`
+}
+
+// Metrics performance of a backtest. ratios are fractions, not percents.
+type Metrics struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	StartEquity float64   `json:"start_equity"`
+	EndEquity   float64   `json:"end_equity"`
+	TotalReturn float64   `json:"total_return"`
+	// AnnualizedReturn compounded over 365 days.
+	AnnualizedReturn float64 `json:"annualized_return"`
+	// Sharpe, Sortino annualized from returns between samples. the risk free rate is 0.
+	Sharpe              float64       `json:"sharpe"`
+	Sortino             float64       `json:"sortino"`
+	MaxDrawdown         float64       `json:"max_drawdown"`
+	MaxDrawdownDuration time.Duration `json:"max_drawdown_duration"`
+	Trades              int           `json:"trades"`
+	WinRate             float64       `json:"win_rate"`
+	// ProfitFactor gross profit / gross loss of trades. 0 without losses.
+	ProfitFactor float64 `json:"profit_factor"`
+	// Turnover traded notional / average equity.
+	Turnover           float64       `json:"turnover"`
+	Fees               float64       `json:"fees"`
+	AverageHoldingTime time.Duration `json:"average_holding_time"`
+	// Exposure average of exposure / equity over samples.
+	Exposure float64 `json:"exposure"`
+}
+
+// Result of a backtest.
+type Result struct {
+	Currency string        `json:"currency"`
+	Metrics  Metrics       `json:"metrics"`
+	Curve    []EquityPoint `json:"curve"`
+	Trades   []Trade       `json:"trades"`
+}
+
+// Analyze compute metrics from the equity curve and trades. notional and fees are totals of all fills.
+func Analyze(curve []EquityPoint, trades []Trade, notional, fees float64) Metrics {
+	m := Metrics{Trades: len(trades), Fees: fees}
+	if len(curve) > 0 {
+		first, last := curve[0], curve[len(curve)-1]
+		m.Start, m.End = first.Time, last.Time
+		m.StartEquity, m.EndEquity = first.Equity, last.Equity
+		if first.Equity > 0 {
+			m.TotalReturn = last.Equity/first.Equity - 1
+			if d := last.Time.Sub(first.Time); d > 0 && last.Equity > 0 {
+				m.AnnualizedReturn = math.Pow(last.Equity/first.Equity, float64(year)/float64(d)) - 1
+			}
+		}
+	}
+	m.Sharpe, m.Sortino = ratios(curve)
+	m.MaxDrawdown, m.MaxDrawdownDuration = drawdown(curve)
+
+	sumEquity, sumExposure := 0.0, 0.0
+	for _, p := range curve {
+		sumEquity += p.Equity
+		if p.Equity > 0 {
+			sumExposure += p.Exposure / p.Equity
+		}
+	}
+	if len(curve) > 0 {
+		if avg := sumEquity / float64(len(curve)); avg > 0 {
+			m.Turnover = notional / avg
+		}
+		m.Exposure = sumExposure / float64(len(curve))
+	}
+
+	wins, profit, loss := 0, 0.0, 0.0
+	var holding time.Duration
+	for _, t := range trades {
+		if t.PnL > 0 {
+			wins++
+			profit += t.PnL
+		} else {
+			loss -= t.PnL
+		}
+		holding += t.ExitTime.Sub(t.EntryTime)
+	}
+	if len(trades) > 0 {
+		m.WinRate = float64(wins) / float64(len(trades))
+		m.AverageHoldingTime = holding / time.Duration(len(trades))
+		if loss > 0 {
+			m.ProfitFactor = profit / loss
+		}
+	}
+	return m
+}
+
+// ratios annualized Sharpe and Sortino ratio of returns between samples.
+func ratios(curve []EquityPoint) (float64, float64) {
+	returns := []float64{}
+	var span time.Duration
+	for i := 1; i < len(curve); i++ {
+		if curve[i-1].Equity <= 0 {
+			continue
+		}
+		returns = append(returns, curve[i].Equity/curve[i-1].Equity-1)
+		span += curve[i].Time.Sub(curve[i-1].Time)
+	}
+	if len(returns) < 2 || span <= 0 {
+		return 0, 0
+	}
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	variance, downside := 0.0, 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	variance /= float64(len(returns) - 1)
+	downside /= float64(len(returns))
+
+	// サンプル間隔の平均から年間のサンプル数を求める
+	scale := math.Sqrt(float64(year) / (float64(span) / float64(len(returns))))
+	sharpe, sortino := 0.0, 0.0
+	if variance > 0 {
+		sharpe = mean / math.Sqrt(variance) * scale
+	}
+	if downside > 0 {
+		sortino = mean / math.Sqrt(downside) * scale
+	}
+	return sharpe, sortino
+}
+
+// drawdown max drawdown from a peak and the longest time under a peak.
+func drawdown(curve []EquityPoint) (float64, time.Duration) {
+	maxDD := 0.0
+	var maxDuration time.Duration
+	peak := math.Inf(-1)
+	var peakTime time.Time
+	for _, p := range curve {
+		if p.Equity >= peak {
+			peak, peakTime = p.Equity, p.Time
+			continue
+		}
+		if peak > 0 {
+			maxDD = math.Max(maxDD, (peak-p.Equity)/peak)
+		}
+		if d := p.Time.Sub(peakTime); d > maxDuration {
+			maxDuration = d
+		}
+	}
+	return maxDD, maxDuration
+}
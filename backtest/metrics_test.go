@@ -0,0 +1,65 @@
+package backtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestAnalyze(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	curve := []EquityPoint{}
+	for i, e := range []float64{100, 110, 99, 121} {
+		curve = append(curve, EquityPoint{Time: start.Add(time.Duration(i) * day), Equity: e, Exposure: e / 2})
+	}
+
+	book := newTradeBook()
+	book.add("BTC_JPY", true, 100, 1, 0.1, 1, start)
+	// ドテン
+	book.add("BTC_JPY", false, 110, 2, 0.2, 1, start.Add(day))
+	book.add("BTC_JPY", true, 115, 1, 0, 1, start.Add(3*day))
+	trades := book.trades
+	if len(trades) != 2 || !trades[0].IsLong || trades[1].IsLong {
+		t.Fatalf("trades %+v", trades)
+	}
+	if !near(trades[0].PnL, 9.8) || !near(trades[1].PnL, -5.1) || !near(trades[1].EntryPrice, 110) {
+		t.Fatalf("trades %+v", trades)
+	}
+
+	m := Analyze(curve, trades, book.notional, book.fees)
+	if !near(m.TotalReturn, 0.21) || !near(m.MaxDrawdown, 0.1) || m.MaxDrawdownDuration != day {
+		t.Errorf("metrics %+v", m)
+	}
+	if !near(m.WinRate, 0.5) || !near(m.ProfitFactor, 9.8/5.1) || !near(m.Fees, 0.3) || !near(m.Exposure, 0.5) {
+		t.Errorf("metrics %+v", m)
+	}
+	if !near(m.Turnover, (100+220+115)/107.5) || m.AverageHoldingTime != 1.5*24*time.Hour || m.Sharpe <= 0 {
+		t.Errorf("metrics %+v", m)
+	}
+
+	res := &Result{Currency: "JPY", Metrics: m, Curve: curve, Trades: trades}
+	buf := &bytes.Buffer{}
+	if err := res.WriteJSON(buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded := Result{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded.Trades) != 2 {
+		t.Fatal(err, decoded)
+	}
+	buf.Reset()
+	if err := res.WriteCurveCSV(buf); err != nil || strings.Count(buf.String(), "\n") != 5 {
+		t.Fatal(err, buf.String())
+	}
+	buf.Reset()
+	if err := res.WriteHTML(buf); err != nil || strings.Count(buf.String(), "<svg") != 3 {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,331 @@
+package backtest
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/replay"
+)
+
+// Params a parameter set of a strategy.
+type Params map[string]float64
+
+// Param a dimension of the parameter space.
+// grid search uses Values. random search draws from Values, or uniformly from [Min, Max] if Values is empty.
+type Param struct {
+	Name   string
+	Values []float64
+	Min    float64
+	Max    float64
+	// Int round random values.
+	Int bool
+}
+
+// Objective score of a run to maximize.
+type Objective func(m Metrics) float64
+
+// objectives of common metrics.
+var (
+	BySharpe      Objective = func(m Metrics) float64 { return m.Sharpe }
+	BySortino     Objective = func(m Metrics) float64 { return m.Sortino }
+	ByTotalReturn Objective = func(m Metrics) float64 { return m.TotalReturn }
+	// ByCalmar annualized return / max drawdown.
+	ByCalmar Objective = func(m Metrics) float64 {
+		if m.MaxDrawdown == 0 {
+			return m.AnnualizedReturn
+		}
+		return m.AnnualizedReturn / m.MaxDrawdown
+	}
+)
+
+// Trial a run of a parameter set. Err is set if the run failed, and it is ranked last.
+type Trial struct {
+	Params Params
+	Result *Result
+	Score  float64
+	Err    error
+}
+
+// Optimizer run a strategy with many parameter sets in parallel.
+// each run has its own dummy and source, so runs do not share state.
+type Optimizer struct {
+	// NewExchange create a fresh dummy, e.g. ccew.Dummy with the same key.
+	NewExchange func() (exchange.Exchange, error)
+	// NewSource open the data between from and to.
+	NewSource   func(from, to time.Time) (replay.Source, error)
+	NewStrategy func(p Params) (Strategy, error)
+	Space       []Param
+	Options     Options
+	// Objective default BySharpe.
+	Objective Objective
+	// Workers number of parallel runs. default runtime.NumCPU().
+	Workers int
+}
+
+// Grid run every combination of Values between from and to. trials are sorted by Score, best first.
+func (o *Optimizer) Grid(from, to time.Time) ([]Trial, error) {
+	sets := []Params{{}}
+	for _, p := range o.Space {
+		if len(p.Values) == 0 {
+			return nil, errors.New("values of " + p.Name + " is empty.")
+		}
+		next := []Params{}
+		for _, set := range sets {
+			for _, v := range p.Values {
+				params := Params{p.Name: v}
+				for k, v := range set {
+					params[k] = v
+				}
+				next = append(next, params)
+			}
+		}
+		sets = next
+	}
+	return o.Run(sets, from, to)
+}
+
+// Random run n parameter sets drawn with seed between from and to. trials are sorted by Score, best first.
+func (o *Optimizer) Random(n int, seed int64, from, to time.Time) ([]Trial, error) {
+	r := rand.New(rand.NewSource(seed))
+	sets := make([]Params, n)
+	for i := range sets {
+		sets[i] = Params{}
+		for _, p := range o.Space {
+			var v float64
+			if len(p.Values) > 0 {
+				v = p.Values[r.Intn(len(p.Values))]
+			} else {
+				v = p.Min + r.Float64()*(p.Max-p.Min)
+			}
+			if p.Int {
+				v = math.Round(v)
+			}
+			sets[i][p.Name] = v
+		}
+	}
+	return o.Run(sets, from, to)
+}
+
+// Run the parameter sets in parallel between from and to. trials are sorted by Score, best first.
+// errors of runs are in Trial.Err, and an error is returned only if the optimizer is misconfigured.
+func (o *Optimizer) Run(sets []Params, from, to time.Time) ([]Trial, error) {
+	if o.NewExchange == nil || o.NewSource == nil || o.NewStrategy == nil {
+		return nil, errors.New("NewExchange, NewSource and NewStrategy are required.")
+	}
+	objective := o.Objective
+	if objective == nil {
+		objective = BySharpe
+	}
+	workers := o.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	trials := make([]Trial, len(sets))
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				trials[i] = o.trial(sets[i], from, to, objective)
+			}
+		}()
+	}
+	for i := range sets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.SliceStable(trials, func(i, j int) bool {
+		if (trials[i].Err == nil) != (trials[j].Err == nil) {
+			return trials[i].Err == nil
+		}
+		return trials[i].Score > trials[j].Score
+	})
+	return trials, nil
+}
+
+func (o *Optimizer) trial(params Params, from, to time.Time, objective Objective) Trial {
+	trial := Trial{Params: params}
+	res, err := o.backtest(params, from, to)
+	if err != nil {
+		trial.Err = err
+		return trial
+	}
+	trial.Result = res
+	trial.Score = objective(res.Metrics)
+	if math.IsNaN(trial.Score) {
+		trial.Score = math.Inf(-1)
+	}
+	return trial
+}
+
+func (o *Optimizer) backtest(params Params, from, to time.Time) (*Result, error) {
+	ex, err := o.NewExchange()
+	if err != nil {
+		return nil, err
+	}
+	src, err := o.NewSource(from, to)
+	if err != nil {
+		return nil, err
+	}
+	// Runが始まるまではソースを閉じる者がいない
+	strategy, err := o.NewStrategy(params)
+	if err != nil {
+		closeSource(src)
+		return nil, err
+	}
+	r, err := New(ex, src, strategy, o.Options, replay.Options{From: from, To: to})
+	if err != nil {
+		closeSource(src)
+		return nil, err
+	}
+	if err := r.Run(); err != nil {
+		return nil, err
+	}
+	return r.Result(), nil
+}
+
+// closeSource close src if it holds files, e.g. *recorder.Reader.
+func closeSource(src replay.Source) {
+	if c, ok := src.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// WalkForwardOptions windows of walk-forward optimization.
+// the first window optimizes [Start, Start+InSample) and validates the next OutOfSample.
+// windows move by Step (default OutOfSample) until the out of sample period passes End.
+type WalkForwardOptions struct {
+	Start       time.Time
+	End         time.Time
+	InSample    time.Duration
+	OutOfSample time.Duration
+	Step        time.Duration
+}
+
+// WalkForwardWindow a window of walk-forward optimization.
+type WalkForwardWindow struct {
+	InFrom  time.Time
+	InTo    time.Time
+	OutFrom time.Time
+	OutTo   time.Time
+	// Best the best trial in sample.
+	Best Trial
+	// OutOfSample the best parameters run out of sample.
+	OutOfSample Trial
+}
+
+// WalkForward optimize each in sample period with search (e.g. o.Grid) and validate the best parameters
+// on the following out of sample period. compare scores in and out of sample to judge overfitting.
+func (o *Optimizer) WalkForward(opt WalkForwardOptions, search func(from, to time.Time) ([]Trial, error)) ([]WalkForwardWindow, error) {
+	if opt.InSample <= 0 || opt.OutOfSample <= 0 {
+		return nil, errors.New("InSample and OutOfSample must be positive.")
+	}
+	step := opt.Step
+	if step <= 0 {
+		step = opt.OutOfSample
+	}
+	windows := []WalkForwardWindow{}
+	for start := opt.Start; !start.Add(opt.InSample + opt.OutOfSample).After(opt.End); start = start.Add(step) {
+		w := WalkForwardWindow{
+			InFrom:  start,
+			InTo:    start.Add(opt.InSample),
+			OutFrom: start.Add(opt.InSample),
+			OutTo:   start.Add(opt.InSample + opt.OutOfSample),
+		}
+		trials, err := search(w.InFrom, w.InTo)
+		if err != nil {
+			return nil, err
+		}
+		if len(trials) == 0 || trials[0].Err != nil {
+			return nil, errors.New("no successful trial in sample.")
+		}
+		w.Best = trials[0]
+		out, err := o.Run([]Params{w.Best.Params}, w.OutFrom, w.OutTo)
+		if err != nil {
+			return nil, err
+		}
+		w.OutOfSample = out[0]
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// MonteCarloOptions options of MonteCarlo.
+type MonteCarloOptions struct {
+	Runs int
+	Seed int64
+	// Replace draw trades with replacement (bootstrap). otherwise trades are shuffled,
+	// which keeps the final equity and changes only the path.
+	Replace bool
+}
+
+// MonteCarloResult distributions of resampled runs, sorted ascending.
+type MonteCarloResult struct {
+	FinalEquity []float64
+	MaxDrawdown []float64
+}
+
+// MonteCarlo resample the order of trades and rebuild equity from startEquity with their PnL.
+func MonteCarlo(trades []Trade, startEquity float64, opt MonteCarloOptions) MonteCarloResult {
+	r := rand.New(rand.NewSource(opt.Seed))
+	res := MonteCarloResult{}
+	pnls := make([]float64, len(trades))
+	for run := 0; run < opt.Runs; run++ {
+		for i := range pnls {
+			if opt.Replace {
+				pnls[i] = trades[r.Intn(len(trades))].PnL
+			} else {
+				pnls[i] = trades[i].PnL
+			}
+		}
+		if !opt.Replace {
+			r.Shuffle(len(pnls), func(i, j int) { pnls[i], pnls[j] = pnls[j], pnls[i] })
+		}
+
+		equity, peak, maxDD := startEquity, startEquity, 0.0
+		for _, pnl := range pnls {
+			equity += pnl
+			peak = math.Max(peak, equity)
+			if peak > 0 {
+				maxDD = math.Max(maxDD, (peak-equity)/peak)
+			}
+		}
+		res.FinalEquity = append(res.FinalEquity, equity)
+		res.MaxDrawdown = append(res.MaxDrawdown, maxDD)
+	}
+	sort.Float64s(res.FinalEquity)
+	sort.Float64s(res.MaxDrawdown)
+	return res
+}
+
+// Percentile final equity and max drawdown at q (0 to 1) of the runs.
+// e.g. Percentile(0.95) gives the drawdown exceeded by 5% of runs.
+func (res MonteCarloResult) Percentile(q float64) (float64, float64) {
+	return percentile(res.FinalEquity, q), percentile(res.MaxDrawdown, q)
+}
+
+func percentile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Round(q * float64(len(sorted)-1)))
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
@@ -0,0 +1,139 @@
+package backtest
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/replay"
+	"github.com/TTRSQ/ccew/src/dummy"
+)
+
+// dipBuyer buy Offset below 100 at start.
+type dipBuyer struct {
+	Base
+	offset float64
+}
+
+func (s *dipBuyer) OnStart(ctx Context) error {
+	ctx.Exchange().UpdateBestPrice(101, 99)
+	_, err := ctx.Exchange().CreateOrder(100-s.offset, 1, true, "BTC_JPY", "LIMIT")
+	return err
+}
+
+func newTestOptimizer(csv string) *Optimizer {
+	return &Optimizer{
+		NewExchange: func() (exchange.Exchange, error) {
+			return dummy.New(exchange.Key{SpecificParam: map[string]interface{}{"symbol": "BTC_JPY"}})
+		},
+		NewSource: func(from, to time.Time) (replay.Source, error) {
+			return replay.FromCSV(strings.NewReader(csv), replay.DefaultCSVOptions("bitflyer", "BTC_JPY")), nil
+		},
+		NewStrategy: func(p Params) (Strategy, error) {
+			if p["offset"] < 0 {
+				return nil, errors.New("negative offset.")
+			}
+			return &dipBuyer{offset: p["offset"]}, nil
+		},
+		Space:     []Param{{Name: "offset", Values: []float64{-1, 0.5, 1, 3}}},
+		Objective: func(m Metrics) float64 { return m.EndEquity },
+		Workers:   2,
+	}
+}
+
+func TestOptimizer(t *testing.T) {
+	csv := "time,price,size,side,id\n" +
+		"1609459200,100,1,sell,1\n" +
+		"1609459260,98.5,2,sell,2\n" +
+		"1609459320,100,1,buy,3\n" +
+		"1609459380,100,1,buy,4\n"
+	o := newTestOptimizer(csv)
+	trials, err := o.Grid(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []float64{}
+	for _, trial := range trials {
+		got = append(got, trial.Params["offset"])
+	}
+	// 安く買えたほど良い. 失敗した試行は最後
+	if len(trials) != 4 || got[0] != 1 || got[1] != 0.5 || got[2] != 3 || trials[3].Err == nil {
+		t.Fatalf("trials %v %+v", got, trials)
+	}
+	if trials[0].Score != 1 || trials[0].Result.Metrics.EndEquity != 1 {
+		t.Errorf("best %+v", trials[0].Result.Metrics)
+	}
+
+	random, err := o.Random(5, 1, time.Time{}, time.Time{})
+	if err != nil || len(random) != 5 {
+		t.Fatal(err, random)
+	}
+
+	start := time.Unix(1609459200, 0)
+	o.Space[0].Values = []float64{0.5, 1}
+	windows, err := o.WalkForward(WalkForwardOptions{
+		Start:       start,
+		End:         start.Add(4 * time.Minute),
+		InSample:    2 * time.Minute,
+		OutOfSample: time.Minute,
+	}, o.Grid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 2 || !windows[1].InFrom.Equal(start.Add(time.Minute)) || windows[0].OutOfSample.Err != nil {
+		t.Fatalf("windows %+v", windows)
+	}
+}
+
+func TestMonteCarlo(t *testing.T) {
+	trades := []Trade{{PnL: 10}, {PnL: -20}, {PnL: 5}, {PnL: -5}}
+	res := MonteCarlo(trades, 100, MonteCarloOptions{Runs: 100, Seed: 1})
+	// 順序を変えても最終損益は同じ
+	if lo, _ := res.Percentile(0); lo != 90 {
+		t.Errorf("final %v", res.FinalEquity)
+	}
+	_, best := res.Percentile(0)
+	_, worst := res.Percentile(1)
+	if !near(best, 0.2/1.1) || !near(worst, 0.25) {
+		t.Errorf("drawdown %v %v", best, worst)
+	}
+	boot := MonteCarlo(trades, 100, MonteCarloOptions{Runs: 100, Seed: 1, Replace: true})
+	if boot.FinalEquity[0] == boot.FinalEquity[99] {
+		t.Errorf("bootstrap %v", boot.FinalEquity)
+	}
+}
+
+// closingSource count Close of the sources.
+type closingSource struct {
+	replay.Source
+	closed *int32
+}
+
+func (s closingSource) Close() error {
+	atomic.AddInt32(s.closed, 1)
+	return nil
+}
+
+func TestSourceClosed(t *testing.T) {
+	csv := "time,price,size,side,id\n" +
+		"1609459200,100,1,sell,1\n"
+	o := newTestOptimizer(csv)
+	newSource := o.NewSource
+	var closed int32
+	o.NewSource = func(from, to time.Time) (replay.Source, error) {
+		src, err := newSource(from, to)
+		return closingSource{Source: src, closed: &closed}, err
+	}
+
+	// 戦略を作れなかった試行もソースを閉じる
+	trials, err := o.Grid(time.Time{}, time.Time{})
+	if err != nil || trials[3].Err == nil {
+		t.Fatal(err, trials)
+	}
+	if closed != int32(len(trials)) {
+		t.Fatalf("closed %d of %d", closed, len(trials))
+	}
+}
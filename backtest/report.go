@@ -0,0 +1,231 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteJSON write metrics, the curve and trades as one JSON object.
+func (res *Result) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(res)
+}
+
+// WriteCurveCSV write the equity curve. columns are time (RFC3339), equity, exposure.
+func (res *Result) WriteCurveCSV(w io.Writer) error {
+	rows := [][]string{{"time", "equity", "exposure"}}
+	for _, p := range res.Curve {
+		rows = append(rows, []string{p.Time.Format(time.RFC3339Nano), formatFloat(p.Equity), formatFloat(p.Exposure)})
+	}
+	return csv.NewWriter(w).WriteAll(rows)
+}
+
+// WriteTradesCSV write the trade list.
+func (res *Result) WriteTradesCSV(w io.Writer) error {
+	rows := [][]string{{"symbol", "side", "size", "entry_time", "exit_time", "entry_price", "exit_price", "pnl", "fees"}}
+	for _, t := range res.Trades {
+		side := "short"
+		if t.IsLong {
+			side = "long"
+		}
+		rows = append(rows, []string{
+			t.Symbol,
+			side,
+			formatFloat(t.Size),
+			t.EntryTime.Format(time.RFC3339Nano),
+			t.ExitTime.Format(time.RFC3339Nano),
+			formatFloat(t.EntryPrice),
+			formatFloat(t.ExitPrice),
+			formatFloat(t.PnL),
+			formatFloat(t.Fees),
+		})
+	}
+	return csv.NewWriter(w).WriteAll(rows)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// chart size of svg charts in the report.
+const (
+	chartWidth  = 900
+	chartHeight = 240
+)
+
+type chart struct {
+	Title  string
+	Points string
+	Bars   []bar
+	Min    string
+	Max    string
+	Width  int
+	Height int
+}
+
+type bar struct {
+	X, Y, W, H float64
+	Loss       bool
+}
+
+type row struct {
+	Name, Value string
+}
+
+// WriteHTML write a self-contained report with metrics, the equity and drawdown chart and trades.
+// it needs no scripts or external files.
+func (res *Result) WriteHTML(w io.Writer) error {
+	m := res.Metrics
+	equity := make([]float64, len(res.Curve))
+	drawdowns := make([]float64, len(res.Curve))
+	peak := math.Inf(-1)
+	for i, p := range res.Curve {
+		equity[i] = p.Equity
+		peak = math.Max(peak, p.Equity)
+		if peak > 0 {
+			drawdowns[i] = -(peak - p.Equity) / peak * 100
+		}
+	}
+	pnls := make([]float64, len(res.Trades))
+	for i, t := range res.Trades {
+		pnls[i] = t.PnL
+	}
+
+	return reportTemplate.Execute(w, map[string]interface{}{
+		"Result": res,
+		"Rows": []row{
+			{"Period", fmt.Sprintf("%s - %s", m.Start.Format(time.RFC3339), m.End.Format(time.RFC3339))},
+			{"Equity", fmt.Sprintf("%.2f -> %.2f %s", m.StartEquity, m.EndEquity, res.Currency)},
+			{"Total return", percent(m.TotalReturn)},
+			{"Annualized return", percent(m.AnnualizedReturn)},
+			{"Sharpe", fmt.Sprintf("%.2f", m.Sharpe)},
+			{"Sortino", fmt.Sprintf("%.2f", m.Sortino)},
+			{"Max drawdown", percent(m.MaxDrawdown)},
+			{"Max drawdown duration", m.MaxDrawdownDuration.String()},
+			{"Trades", strconv.Itoa(m.Trades)},
+			{"Win rate", percent(m.WinRate)},
+			{"Profit factor", fmt.Sprintf("%.2f", m.ProfitFactor)},
+			{"Turnover", fmt.Sprintf("%.2f", m.Turnover)},
+			{"Fees", fmt.Sprintf("%.2f %s", m.Fees, res.Currency)},
+			{"Average holding time", m.AverageHoldingTime.String()},
+			{"Exposure", percent(m.Exposure)},
+		},
+		"Charts": []chart{
+			lineChart("Equity", equity),
+			lineChart("Drawdown (%)", drawdowns),
+			barChart("Trade PnL", pnls),
+		},
+	})
+}
+
+func percent(f float64) string {
+	return fmt.Sprintf("%.2f%%", f*100)
+}
+
+func bounds(values []float64) (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	if len(values) == 0 {
+		return 0, 1
+	}
+	if lo == hi {
+		lo, hi = lo-1, hi+1
+	}
+	return lo, hi
+}
+
+func lineChart(title string, values []float64) chart {
+	lo, hi := bounds(values)
+	points := make([]string, len(values))
+	for i, v := range values {
+		x := 0.0
+		if len(values) > 1 {
+			x = float64(i) / float64(len(values)-1) * chartWidth
+		}
+		y := (hi - v) / (hi - lo) * chartHeight
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return chart{
+		Title:  title,
+		Points: strings.Join(points, " "),
+		Min:    fmt.Sprintf("%.2f", lo),
+		Max:    fmt.Sprintf("%.2f", hi),
+		Width:  chartWidth,
+		Height: chartHeight,
+	}
+}
+
+func barChart(title string, values []float64) chart {
+	lo, hi := bounds(append([]float64{0}, values...))
+	zero := hi / (hi - lo) * chartHeight
+	bars := make([]bar, len(values))
+	for i, v := range values {
+		w := float64(chartWidth) / float64(len(values))
+		h := math.Abs(v) / (hi - lo) * chartHeight
+		y := zero - h
+		if v < 0 {
+			y = zero
+		}
+		bars[i] = bar{X: float64(i) * w, Y: y, W: math.Max(w-1, 1), H: h, Loss: v < 0}
+	}
+	return chart{
+		Title:  title,
+		Bars:   bars,
+		Min:    fmt.Sprintf("%.2f", lo),
+		Max:    fmt.Sprintf("%.2f", hi),
+		Width:  chartWidth,
+		Height: chartHeight,
+	}
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"time": func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"num":  func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Backtest report</title>
+<style>
+body { font-family: sans-serif; margin: 24px; color: #222; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+td:first-child, th:first-child { text-align: left; }
+svg { background: #fafafa; border: 1px solid #ccc; display: block; }
+.axis { font-size: 12px; color: #666; }
+.loss { fill: #d9534f; }
+.gain { fill: #5cb85c; }
+</style>
+</head>
+<body>
+<h1>Backtest report</h1>
+<table>
+{{range .Rows}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{range .Charts}}
+<h2>{{.Title}}</h2>
+<div class="axis">max {{.Max}}</div>
+<svg width="{{.Width}}" height="{{.Height}}" viewBox="0 0 {{.Width}} {{.Height}}" preserveAspectRatio="none">
+{{if .Points}}<polyline fill="none" stroke="#337ab7" stroke-width="1.5" points="{{.Points}}"/>{{end}}
+{{range .Bars}}<rect x="{{printf "%.1f" .X}}" y="{{printf "%.1f" .Y}}" width="{{printf "%.1f" .W}}" height="{{printf "%.1f" .H}}" class="{{if .Loss}}loss{{else}}gain{{end}}"/>
+{{end}}</svg>
+<div class="axis">min {{.Min}}</div>
+{{end}}
+<h2>Trades</h2>
+<table>
+<tr><th>Symbol</th><th>Side</th><th>Size</th><th>Entry</th><th>Exit</th><th>Entry price</th><th>Exit price</th><th>PnL</th><th>Fees</th></tr>
+{{range .Result.Trades}}<tr><td>{{.Symbol}}</td><td>{{if .IsLong}}long{{else}}short{{end}}</td><td>{{num .Size}}</td><td>{{time .EntryTime}}</td><td>{{time .ExitTime}}</td><td>{{num .EntryPrice}}</td><td>{{num .ExitPrice}}</td><td>{{num .PnL}}</td><td>{{num .Fees}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
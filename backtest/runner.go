@@ -0,0 +1,279 @@
+package backtest
+
+import (
+	"errors"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/replay"
+	"github.com/TTRSQ/ccew/src/dummy"
+)
+
+// defaultSampleInterval 資産曲線の既定の間隔
+const defaultSampleInterval = time.Minute
+
+// Runner run a strategy over recorded data with the dummy exchange and a simulated clock.
+type Runner struct {
+	sim      exchange.Simulator
+	valuer   dummy.Valuer
+	driver   *replay.Driver
+	events   exchange.PrivateStream
+	strategy Strategy
+	opt      Options
+
+	now        time.Time
+	nextTimer  time.Time
+	nextSample time.Time
+	currency   string
+	curve      []EquityPoint
+	book       *tradeBook
+	sampleErr  error
+}
+
+// New ex must be the dummy created by ccew.Dummy. src is replayed as fast as possible between From and To.
+func New(ex exchange.Exchange, src replay.Source, strategy Strategy, opt Options, replayOpt replay.Options) (*Runner, error) {
+	sim, ok := ex.(exchange.Simulator)
+	if !ok {
+		return nil, errors.New("exchange is not simulator.")
+	}
+	valuer, ok := ex.(dummy.Valuer)
+	if !ok {
+		return nil, errors.New("exchange is not dummy.")
+	}
+	events, err := dummy.NewPrivateStream(ex)
+	if err != nil {
+		return nil, err
+	}
+	replayOpt.Speed = 0
+	if opt.SampleInterval <= 0 {
+		opt.SampleInterval = defaultSampleInterval
+	}
+	return &Runner{
+		sim:      sim,
+		valuer:   valuer,
+		driver:   replay.New(ex, src, replayOpt),
+		events:   events,
+		strategy: strategy,
+		opt:      opt,
+		currency: opt.Currency,
+		book:     newTradeBook(),
+	}, nil
+}
+
+func (r *Runner) Exchange() exchange.Exchange {
+	return r.sim
+}
+
+func (r *Runner) Now() time.Time {
+	return r.now
+}
+
+// Run replay all events. fills caused by an event are given before the event itself.
+func (r *Runner) Run() error {
+	defer r.events.Close()
+	// 開始に失敗してもソースを閉じる
+	defer r.driver.Close()
+	if len(r.opt.Topics) > 0 {
+		if err := r.driver.Subscribe(r.opt.Topics...); err != nil {
+			return err
+		}
+	}
+	if err := r.driver.Start(); err != nil {
+		return err
+	}
+
+	started := false
+	for {
+		t, err := r.driver.NextTime()
+		if err == replay.ErrEnd && !started {
+			return nil
+		}
+		if err == replay.ErrEnd {
+			return r.finish()
+		}
+		if err != nil {
+			return err
+		}
+
+		// 最初のイベントの時刻から始める
+		if !started {
+			started = true
+			r.now = t
+			if err := r.sim.UpdateTime(t); err != nil {
+				return err
+			}
+			if err := r.sample(); err != nil {
+				return err
+			}
+			r.nextSample = t.Add(r.opt.SampleInterval)
+			if err := r.strategy.OnStart(r); err != nil {
+				return err
+			}
+			if err := r.fills(); err != nil {
+				return err
+			}
+			if r.opt.TimerInterval > 0 {
+				r.nextTimer = t.Add(r.opt.TimerInterval)
+			}
+		}
+		if err := r.advance(t); err != nil {
+			return err
+		}
+
+		msg, err := r.driver.Read()
+		if err == replay.ErrEnd {
+			return r.finish()
+		}
+		if err != nil {
+			return err
+		}
+		r.now = r.driver.Now()
+		if err := r.fills(); err != nil {
+			return err
+		}
+		if err := dispatch(r.strategy, r, msg); err != nil {
+			return err
+		}
+	}
+}
+
+// advance take equity samples and call OnTimer for each time before t on the simulated clock.
+func (r *Runner) advance(t time.Time) error {
+	for {
+		timer := r.opt.TimerInterval > 0 && r.nextTimer.Before(t)
+		sample := r.nextSample.Before(t)
+		if !timer && !sample {
+			return nil
+		}
+		// 同時刻ならタイマーの前の状態を記録する
+		isSample := sample && (!timer || !r.nextTimer.Before(r.nextSample))
+		if isSample {
+			r.now = r.nextSample
+			r.nextSample = r.nextSample.Add(r.opt.SampleInterval)
+		} else {
+			r.now = r.nextTimer
+			r.nextTimer = r.nextTimer.Add(r.opt.TimerInterval)
+		}
+		// 遅延中の注文や資金調達はこの時刻までに処理される
+		if err := r.sim.UpdateTime(r.now); err != nil {
+			return err
+		}
+		if err := r.fills(); err != nil {
+			return err
+		}
+		if isSample {
+			if err := r.sample(); err != nil {
+				return err
+			}
+		} else if err := r.strategy.OnTimer(r); err != nil {
+			return err
+		}
+	}
+}
+
+// sample add the equity at now to the curve.
+// until the first sample succeeds, errors are kept because prices may be unknown yet.
+func (r *Runner) sample() error {
+	equity, exposure, err := r.value()
+	if err != nil {
+		if len(r.curve) > 0 {
+			return err
+		}
+		r.sampleErr = err
+		return nil
+	}
+	if n := len(r.curve); n > 0 && r.curve[n-1].Time.Equal(r.now) {
+		r.curve = r.curve[:n-1]
+	}
+	r.curve = append(r.curve, EquityPoint{Time: r.now, Equity: equity, Exposure: exposure})
+	return nil
+}
+
+func (r *Runner) value() (float64, float64, error) {
+	currency, err := r.valuationCurrency()
+	if err != nil {
+		return 0, 0, err
+	}
+	equity, err := r.valuer.Equity(currency)
+	if err != nil {
+		return 0, 0, err
+	}
+	exposure, err := r.valuer.Exposure(currency)
+	return equity, exposure, err
+}
+
+func (r *Runner) valuationCurrency() (string, error) {
+	if r.currency == "" {
+		_, quote, err := r.valuer.Currencies("")
+		if err != nil {
+			return "", err
+		}
+		r.currency = quote
+	}
+	return r.currency, nil
+}
+
+// finish take the last sample. it fails if the equity was never known.
+func (r *Runner) finish() error {
+	if err := r.sample(); err != nil {
+		return err
+	}
+	if len(r.curve) == 0 && r.sampleErr != nil {
+		return r.sampleErr
+	}
+	return nil
+}
+
+// record add the fill to the trades.
+func (r *Runner) record(ev *orderevent.Event) error {
+	currency, err := r.valuationCurrency()
+	if err != nil {
+		return err
+	}
+	_, quote, err := r.valuer.Currencies(ev.Symbol)
+	if err != nil {
+		return err
+	}
+	rate, err := r.valuer.Convert(1, quote, currency)
+	if err != nil {
+		return err
+	}
+	fee, err := r.valuer.Convert(ev.Fill.Fee, ev.Fill.FeeCurrency, currency)
+	if err != nil {
+		return err
+	}
+	r.book.add(ev.Symbol, ev.IsBuy, ev.Fill.Price, ev.Fill.Size, fee, rate, r.now)
+	return nil
+}
+
+// Result metrics, the equity curve and trades of the run. positions still open are not in trades.
+func (r *Runner) Result() *Result {
+	return &Result{
+		Currency: r.currency,
+		Metrics:  Analyze(r.curve, r.book.trades, r.book.notional, r.book.fees),
+		Curve:    r.curve,
+		Trades:   r.book.trades,
+	}
+}
+
+// fills give own fills of the dummy to the strategy.
+func (r *Runner) fills() error {
+	for {
+		ev, err := r.events.Read()
+		if err != nil {
+			return err
+		}
+		if ev == nil {
+			return nil
+		}
+		if ev.Fill != nil {
+			if err := r.record(ev); err != nil {
+				return err
+			}
+		}
+		if err := dispatch(r.strategy, r, &exchange.Message{OrderEvent: ev}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package backtest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/replay"
+	"github.com/TTRSQ/ccew/src/dummy"
+)
+
+type testStrategy struct {
+	Base
+	executions int
+	timers     []time.Time
+	fills      []orderevent.Event
+}
+
+func (s *testStrategy) OnStart(ctx Context) error {
+	ctx.Exchange().UpdateBestPrice(101, 99)
+	_, err := ctx.Exchange().CreateOrder(99.5, 1, true, "BTC_JPY", "LIMIT")
+	return err
+}
+
+func (s *testStrategy) OnExecution(ctx Context, e execution.Execution) error {
+	s.executions++
+	return nil
+}
+
+func (s *testStrategy) OnFill(ctx Context, e orderevent.Event) error {
+	s.fills = append(s.fills, e)
+	return nil
+}
+
+func (s *testStrategy) OnTimer(ctx Context) error {
+	s.timers = append(s.timers, ctx.Now())
+	return nil
+}
+
+func TestRunner(t *testing.T) {
+	csv := "time,price,size,side,id\n" +
+		"1609459200,100,1,sell,1\n" +
+		"1609459201,99,2,sell,2\n" +
+		"1609459203.5,100,1,buy,3\n"
+	ex, _ := dummy.New(exchange.Key{})
+	s := &testStrategy{}
+	src := replay.FromCSV(strings.NewReader(csv), replay.DefaultCSVOptions("bitflyer", "BTC_JPY"))
+	r, err := New(ex, src, s, Options{TimerInterval: time.Second}, replay.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.executions != 3 {
+		t.Errorf("executions %d", s.executions)
+	}
+	if len(s.fills) != 1 || s.fills[0].Type != orderevent.Filled || !s.fills[0].Fill.IsMaker {
+		t.Fatalf("fills %+v", s.fills)
+	}
+	// 1秒ごと, イベントより前の時刻のみ
+	if len(s.timers) != 3 || !s.timers[2].Equal(time.Unix(1609459203, 0)) {
+		t.Errorf("timers %v", s.timers)
+	}
+
+	// 開始時は通貨が分からないので終了時のみ
+	res := r.Result()
+	if len(res.Curve) != 1 || res.Curve[0].Equity != 0.5 || res.Currency != "JPY" || res.Curve[0].Exposure != 100 || len(res.Trades) != 0 {
+		t.Errorf("result %+v", res)
+	}
+}
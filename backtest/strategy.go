@@ -0,0 +1,79 @@
+package backtest
+
+import (
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/interface/exchange"
+)
+
+// Context given to strategies. strategies must use Now instead of time.Now to run in backtests.
+type Context interface {
+	// Exchange the dummy in backtests, the real adapter in live.
+	Exchange() exchange.Exchange
+	// Now simulated clock in backtests, wall clock in live.
+	Now() time.Time
+}
+
+// Strategy trading logic runnable by Runner (backtest) and LiveRunner (live) without changes.
+// all methods are called from one goroutine. an error stops the runner.
+type Strategy interface {
+	OnStart(ctx Context) error
+	OnExecution(ctx Context, e execution.Execution) error
+	OnBoard(ctx Context, b board.Board) error
+	// OnFill own fills. liquidations are also given.
+	OnFill(ctx Context, e orderevent.Event) error
+	// OnTimer called every Options.TimerInterval.
+	OnTimer(ctx Context) error
+}
+
+// Base no-op Strategy. embed it to implement only needed methods.
+type Base struct{}
+
+func (Base) OnStart(ctx Context) error {
+	return nil
+}
+
+func (Base) OnExecution(ctx Context, e execution.Execution) error {
+	return nil
+}
+
+func (Base) OnBoard(ctx Context, b board.Board) error {
+	return nil
+}
+
+func (Base) OnFill(ctx Context, e orderevent.Event) error {
+	return nil
+}
+
+func (Base) OnTimer(ctx Context) error {
+	return nil
+}
+
+// Options of Runner and LiveRunner.
+type Options struct {
+	// Topics executions and boards given to the strategy. own order events are always given.
+	Topics []exchange.Topic
+	// TimerInterval interval of OnTimer. 0 disables it.
+	TimerInterval time.Duration
+	// SampleInterval interval of the equity curve of Runner. default 1 minute.
+	SampleInterval time.Duration
+	// Currency currency of the equity curve and metrics of Runner.
+	// default the quote currency of the default symbol of the dummy.
+	Currency string
+}
+
+// dispatch call the strategy method for the message.
+func dispatch(s Strategy, ctx Context, msg *exchange.Message) error {
+	switch {
+	case msg.Execution != nil:
+		return s.OnExecution(ctx, *msg.Execution)
+	case msg.Board != nil:
+		return s.OnBoard(ctx, *msg.Board)
+	case msg.OrderEvent != nil && msg.OrderEvent.Fill != nil:
+		return s.OnFill(ctx, *msg.OrderEvent)
+	}
+	return nil
+}
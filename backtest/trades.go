@@ -0,0 +1,94 @@
+package backtest
+
+import (
+	"math"
+	"time"
+)
+
+// position open trade of a symbol.
+type position struct {
+	size       float64 // 符号付き
+	entryPrice float64 // 平均取得単価
+	maxSize    float64
+	entryTime  time.Time
+	// opened, closed 建てた量と決済した量の合計. 平均価格の表示に使う
+	openedValue float64
+	openedSize  float64
+	closedValue float64
+	closedSize  float64
+	pnl         float64
+	fees        float64
+}
+
+// tradeBook build round trips from fills.
+type tradeBook struct {
+	open     map[string]*position
+	trades   []Trade
+	notional float64
+	fees     float64
+}
+
+func newTradeBook() *tradeBook {
+	return &tradeBook{open: map[string]*position{}}
+}
+
+// add a fill. price is in the quote currency and rate converts the quote currency
+// into the valuation currency. fee is in the valuation currency.
+func (b *tradeBook) add(symbol string, isBuy bool, price, size, fee, rate float64, at time.Time) {
+	b.notional += price * size * rate
+	b.fees += fee
+
+	delta := size
+	if !isBuy {
+		delta = -size
+	}
+	p := b.open[symbol]
+	if p == nil {
+		p = &position{entryTime: at}
+		b.open[symbol] = p
+	}
+	if p.size*delta >= 0 {
+		p.entryPrice = (p.entryPrice*math.Abs(p.size) + price*size) / (math.Abs(p.size) + size)
+		p.size += delta
+		p.maxSize = math.Max(p.maxSize, math.Abs(p.size))
+		p.openedValue += price * size
+		p.openedSize += size
+		p.fees += fee
+		return
+	}
+
+	// 反対売買. 建玉を超えた分はドテンとして新しい取引にする
+	closed := math.Min(math.Abs(p.size), size)
+	pnl := (price - p.entryPrice) * closed * rate
+	if p.size < 0 {
+		pnl = -pnl
+	}
+	closeFee := fee * closed / size
+	p.pnl += pnl
+	p.fees += closeFee
+	p.closedValue += price * closed
+	p.closedSize += closed
+	p.size += math.Copysign(closed, delta)
+	if math.Abs(p.size) > 1e-12 {
+		return
+	}
+
+	b.trades = append(b.trades, Trade{
+		Symbol:     symbol,
+		IsLong:     delta < 0,
+		Size:       p.maxSize,
+		EntryTime:  p.entryTime,
+		ExitTime:   at,
+		EntryPrice: p.openedValue / p.openedSize,
+		ExitPrice:  p.closedValue / p.closedSize,
+		PnL:        p.pnl - p.fees,
+		Fees:       p.fees,
+	})
+	delete(b.open, symbol)
+	if rest := size - closed; rest > 1e-12 {
+		// 合計は二重に数えない
+		b.notional -= price * rest * rate
+		b.fees -= fee - closeFee
+		b.add(symbol, isBuy, price, rest, fee-closeFee, rate, at)
+	}
+}
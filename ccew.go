@@ -10,6 +10,7 @@ import (
 	"github.com/TTRSQ/ccew/src/ftx"
 	"github.com/TTRSQ/ccew/src/gmo"
 	"github.com/TTRSQ/ccew/src/liquid"
+	"github.com/TTRSQ/ccew/src/paper"
 )
 
 // ExchangeKey ..
@@ -17,42 +18,114 @@ type ExchangeKey = exchange.Key
 
 // this is factory of ccew.
 
-// Bitflyer .. no SpecificParam.
+// Bitflyer .. SpecificParam additional_keys : [][]string{ [id, sec],[id, sec].. }, signKey : sign.Key and the HTTP options of httpx.New
 func Bitflyer(key exchange.Key) (exchange.Exchange, error) {
 	return bitflyer.New(key)
 }
 
-// Ftx .. SpecificParam FTX-SUBACCOUNT : string
+// Ftx .. SpecificParam FTX-SUBACCOUNT : string, additional_keys : [][]string{ [id, sec],[id, sec].. }, signKey : sign.Key and the HTTP options of httpx.New
 func Ftx(key exchange.Key) (exchange.Exchange, error) {
 	return ftx.New(key)
 }
 
-// ByBit .. no SpecificParam.
+// ByBit .. SpecificParam additional_keys : [][]string{ [id, sec],[id, sec].. }, signKey : sign.Key and the HTTP options of httpx.New
 func ByBit(key exchange.Key) (exchange.Exchange, error) {
 	return bybit.New(key)
 }
 
-// BitBank .. SpecificParam additional_keys : [][]string{ [id, sec],[id, sec].. }
+// BitBank .. SpecificParam additional_keys : [][]string{ [id, sec],[id, sec].. }, signKey : sign.Key and the HTTP options of httpx.New
 func BitBank(key exchange.Key) (exchange.Exchange, error) {
 	return bitbank.New(key)
 }
 
-// Liquid .. SpecificParam additional_keys : [][]string{ [id, sec],[id, sec].. }
+// Liquid .. SpecificParam additional_keys : [][]string{ [id, sec],[id, sec].. }, signKey : sign.Key and the HTTP options of httpx.New
 func Liquid(key exchange.Key) (exchange.Exchange, error) {
 	return liquid.New(key)
 }
 
-// CoinCheck .. SpecificParam additional_keys : [][]string{ [id, sec],[id, sec].. }
+// CoinCheck .. SpecificParam additional_keys : [][]string{ [id, sec],[id, sec].. }, signKey : sign.Key and the HTTP options of httpx.New
 func CoinCheck(key exchange.Key) (exchange.Exchange, error) {
 	return coincheck.New(key)
 }
 
-// Gmo .. SpecificParam proxyURL : *url.URL
+// Gmo .. SpecificParam additional_keys : [][]string{ [id, sec],[id, sec].. }, signKey : sign.Key and the HTTP options of httpx.New
 func Gmo(key exchange.Key) (exchange.Exchange, error) {
 	return gmo.New(key)
 }
 
-// Dummy .. no SpecificParam.
+// BitflyerPrivateStream .. SpecificParam proxyURL : *url.URL, signKey : sign.Key
+func BitflyerPrivateStream(key exchange.Key) (exchange.PrivateStream, error) {
+	return bitflyer.NewPrivateStream(key)
+}
+
+// FtxPrivateStream .. SpecificParam FTX-SUBACCOUNT : string, proxyURL : *url.URL, signKey : sign.Key
+func FtxPrivateStream(key exchange.Key) (exchange.PrivateStream, error) {
+	return ftx.NewPrivateStream(key)
+}
+
+// ByBitPrivateStream .. SpecificParam proxyURL : *url.URL, signKey : sign.Key
+func ByBitPrivateStream(key exchange.Key) (exchange.PrivateStream, error) {
+	return bybit.NewPrivateStream(key)
+}
+
+// GmoPrivateStream .. SpecificParam proxyURL : *url.URL, signKey : sign.Key
+func GmoPrivateStream(key exchange.Key) (exchange.PrivateStream, error) {
+	return gmo.NewPrivateStream(key)
+}
+
+// BitflyerPublicStream .. SpecificParam proxyURL : *url.URL
+func BitflyerPublicStream(key exchange.Key) (exchange.PublicStream, error) {
+	return bitflyer.NewPublicStream(key)
+}
+
+// FtxPublicStream .. SpecificParam proxyURL : *url.URL
+func FtxPublicStream(key exchange.Key) (exchange.PublicStream, error) {
+	return ftx.NewPublicStream(key)
+}
+
+// ByBitPublicStream .. SpecificParam proxyURL : *url.URL
+func ByBitPublicStream(key exchange.Key) (exchange.PublicStream, error) {
+	return bybit.NewPublicStream(key)
+}
+
+// GmoPublicStream .. SpecificParam proxyURL : *url.URL
+func GmoPublicStream(key exchange.Key) (exchange.PublicStream, error) {
+	return gmo.NewPublicStream(key)
+}
+
+// Dummy .. SpecificParam makerFee, takerFee : float64, simulate : string, feeModel : dummy.FeeModel, fillModel : dummy.FillModel,
+// limitDelay : int, queuePosition : bool, queueCancel : string,
+// symbol : string, currencies : map[string][]string, balances : map[string]float64,
+// margin : bool, leverage, initialMarginRate, maintenanceMarginRate, liquidationSlippage : float64,
+// funding : []dummy.Funding, entryLatency, cancelLatency, editLatency : dummy.Latency, latencySeed : int64,
+// eventLog : io.Writer, name : string
+// limitDelay is kept for compatibility. latencies on the event clock are preferred.
+// only UpdateExecution and UpdateTime advance the event clock. with latencies, call UpdateTime
+// when driving by UpdateBoard, UpdateLTP or UpdateBestPrice, or delayed requests never arrive.
+// orders need the currencies of the symbol, from its name or currencies.
+// Balance starts with all, fiat and crypto of the default symbol as before, then each currency.
+// it also implements exchange.Simulator, dummy.MarginAccount, dummy.FundingAccount, dummy.Snapshotter and dummy.Valuer.
 func Dummy(key exchange.Key) (exchange.Exchange, error) {
 	return dummy.New(key)
 }
+
+// DummyPrivateStream .. order events of the exchange created by Dummy.
+func DummyPrivateStream(ex exchange.Exchange) (exchange.PrivateStream, error) {
+	return dummy.NewPrivateStream(ex)
+}
+
+// Paper .. orders are filled by a dummy with live data of real. SpecificParam is the same as Dummy.
+// fees default to the schedule of real.
+func Paper(real exchange.Exchange, key exchange.Key) (exchange.Exchange, error) {
+	return paper.New(real, key)
+}
+
+// PaperPublicStream .. public of the real exchange. reading it feeds the exchange created by Paper.
+func PaperPublicStream(ex exchange.Exchange, public exchange.PublicStream) (exchange.PublicStream, error) {
+	return paper.NewPublicStream(ex, public)
+}
+
+// PaperPrivateStream .. simulated order events of the exchange created by Paper.
+func PaperPrivateStream(ex exchange.Exchange) (exchange.PrivateStream, error) {
+	return paper.NewPrivateStream(ex)
+}
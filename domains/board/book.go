@@ -0,0 +1,115 @@
+package board
+
+import (
+	"sort"
+
+	"github.com/TTRSQ/ccew/domains/base"
+)
+
+// Book local order book maintained from snapshots and diffs.
+type Book struct {
+	asks map[float64]float64
+	bids map[float64]float64
+}
+
+// NewBook make empty book.
+func NewBook() *Book {
+	return &Book{
+		asks: map[float64]float64{},
+		bids: map[float64]float64{},
+	}
+}
+
+// Reset replace all levels with snapshot.
+func (b *Book) Reset(asks, bids []base.Norm) {
+	b.asks = map[float64]float64{}
+	b.bids = map[float64]float64{}
+	for _, v := range asks {
+		b.Update(true, v.Price, v.Size)
+	}
+	for _, v := range bids {
+		b.Update(false, v.Price, v.Size)
+	}
+}
+
+// Update set size of the level. size 0 removes the level.
+func (b *Book) Update(isAsk bool, price, size float64) {
+	side := map[bool]map[float64]float64{true: b.asks, false: b.bids}[isAsk]
+	if size <= 0 {
+		delete(side, price)
+		return
+	}
+	side[price] = size
+}
+
+// Board return sorted board. depth <= 0 means all levels.
+func (b *Book) Board(exchangeName, symbol string, depth int) Board {
+	asks := toNorms(b.asks, depth, func(i, j float64) bool { return i < j })
+	bids := toNorms(b.bids, depth, func(i, j float64) bool { return i > j })
+	ret := Board{
+		ExchangeName: exchangeName,
+		Symbol:       symbol,
+		Asks:         asks,
+		Bids:         bids,
+	}
+	if len(asks) > 0 && len(bids) > 0 {
+		ret.MidPrice = (asks[0].Price + bids[0].Price) / 2
+	}
+	return ret
+}
+
+func toNorms(levels map[float64]float64, depth int, less func(i, j float64) bool) []base.Norm {
+	prices := make([]float64, 0, len(levels))
+	for price := range levels {
+		prices = append(prices, price)
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		return less(prices[i], prices[j])
+	})
+	if depth > 0 && len(prices) > depth {
+		prices = prices[:depth]
+	}
+	ret := make([]base.Norm, len(prices))
+	for i, price := range prices {
+		ret[i] = base.Norm{Price: price, Size: levels[price]}
+	}
+	return ret
+}
+
+// Level change of one price level. Size 0 means the level is removed.
+type Level struct {
+	IsAsk bool
+	Price float64
+	Size  float64
+}
+
+// Diff return level changes from prev to next. asks first, then bids, each in price order of next.
+func Diff(prev, next Board) []Level {
+	ret := []Level{}
+	for _, isAsk := range []bool{true, false} {
+		prevLevels, nextLevels := prev.Bids, next.Bids
+		if isAsk {
+			prevLevels, nextLevels = prev.Asks, next.Asks
+		}
+		sizes := map[float64]float64{}
+		for _, v := range prevLevels {
+			sizes[v.Price] = v.Size
+		}
+		for _, v := range nextLevels {
+			size, exist := sizes[v.Price]
+			if !exist || size != v.Size {
+				ret = append(ret, Level{IsAsk: isAsk, Price: v.Price, Size: v.Size})
+			}
+			delete(sizes, v.Price)
+		}
+		removed := make([]float64, 0, len(sizes))
+		for price := range sizes {
+			removed = append(removed, price)
+		}
+		sort.Float64s(removed)
+		for _, price := range removed {
+			ret = append(ret, Level{IsAsk: isAsk, Price: price})
+		}
+	}
+	return ret
+}
@@ -0,0 +1,72 @@
+package orderevent
+
+import (
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/stock"
+)
+
+// Type kind of order lifecycle event.
+type Type string
+
+const (
+	// Accepted order is accepted and resting on the board.
+	Accepted Type = "ACCEPTED"
+	// PartiallyFilled order is executed partially.
+	PartiallyFilled Type = "PARTIALLY_FILLED"
+	// Filled order is executed completely.
+	Filled Type = "FILLED"
+	// Canceled order is canceled.
+	Canceled Type = "CANCELED"
+	// Expired order is expired by exchange.
+	Expired Type = "EXPIRED"
+	// Rejected order is rejected by exchange.
+	Rejected Type = "REJECTED"
+	// CancelRejected cancel request is rejected. the order may be still alive.
+	CancelRejected Type = "CANCEL_REJECTED"
+	// Closed order is no longer active but it is unknown whether it was filled or canceled.
+	// polling streams report it.
+	Closed Type = "CLOSED"
+	// Liquidated position is closed by the exchange because of insufficient margin. Fill is set.
+	Liquidated Type = "LIQUIDATED"
+	// PositionChanged position of the symbol is changed. only Position is filled.
+	PositionChanged Type = "POSITION_CHANGED"
+)
+
+// Fill own execution.
+type Fill struct {
+	ExecutionID string
+	base.Norm
+	Fee         float64
+	FeeCurrency string
+	IsMaker     bool
+}
+
+// Event normalized order event from private streams.
+type Event struct {
+	id.ID
+	Type      Type
+	IsBuy     bool
+	OrderType string
+	// price and size of the order.
+	base.Norm
+	ExecutedSize  float64
+	RemainingSize float64
+	// Fill is set when Type is PartiallyFilled or Filled.
+	Fill *Fill
+	// Position is set when Type is PositionChanged.
+	Position  *stock.Stock
+	Reason    string
+	OccuredAt time.Time
+}
+
+// IsDone return true if the order is no longer alive.
+func (e *Event) IsDone() bool {
+	switch e.Type {
+	case Filled, Canceled, Expired, Rejected, Closed, Liquidated:
+		return true
+	}
+	return false
+}
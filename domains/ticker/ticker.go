@@ -0,0 +1,16 @@
+package ticker
+
+import "time"
+
+// Ticker best prices and last traded price.
+type Ticker struct {
+	ExchangeName string
+	Symbol       string
+	BestBid      float64
+	BestAsk      float64
+	BestBidSize  float64
+	BestAskSize  float64
+	LTP          float64
+	Volume       float64
+	OccuredAt    time.Time
+}
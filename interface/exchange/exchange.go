@@ -1,11 +1,15 @@
 package exchange
 
 import (
+	"time"
+
 	"github.com/TTRSQ/ccew/domains/base"
 	"github.com/TTRSQ/ccew/domains/board"
 	"github.com/TTRSQ/ccew/domains/execution"
 	"github.com/TTRSQ/ccew/domains/order"
+	"github.com/TTRSQ/ccew/domains/orderevent"
 	"github.com/TTRSQ/ccew/domains/stock"
+	"github.com/TTRSQ/ccew/domains/ticker"
 )
 
 // Key .. key data for use private apis.
@@ -50,9 +54,80 @@ type Exchange interface {
 	UpdateBestPrice(bestAsk, bestBid float64) error
 }
 
+// ExecutionsReader 直近の約定を返す取引所. Exchangeとは別に実装する
+type ExecutionsReader interface {
+	// Executions 直近の約定. 新しい順か古い順かは取引所による
+	Executions(symbol string) ([]execution.Execution, error)
+}
+
+// Simulator 市場データで動かす取引所 (dummy). UpdateLTP, UpdateBestPriceより細かいデータを受け取る
+// 板と約定はSymbolの銘柄に反映される. 空の場合はデフォルトの銘柄
+type Simulator interface {
+	Exchange
+	// UpdateBoard 成行と板にぶつかる指値はこの板を消費して約定する
+	UpdateBoard(b board.Board) error
+	// UpdateExecution 置いている指値は約定価格を超えた出来高の分だけ約定する
+	UpdateExecution(e execution.Execution) error
+	// UpdateSymbolLTP, UpdateSymbolBestPrice 銘柄を指定したUpdateLTP, UpdateBestPrice
+	UpdateSymbolLTP(symbol string, ltp float64) error
+	UpdateSymbolBestPrice(symbol string, bestAsk, bestBid float64) error
+	// UpdateTime イベント時刻を進める. 資金調達の精算などはこの時刻で行う
+	UpdateTime(t time.Time) error
+}
+
 // Stream socketを起動し受け取る
 type Stream interface {
 	Start() error
 	// Read Execution, error Executionはなかったらnilが飛ぶ
 	Read() (execution.Execution, error)
 }
+
+// PrivateStream 注文イベントと自分の約定を受け取る
+type PrivateStream interface {
+	// Start 接続, 認証, 購読まで行う
+	Start() error
+	Close() error
+	// Read Event, error Eventはなかったらnilが飛ぶ
+	Read() (*orderevent.Event, error)
+}
+
+// Channel 購読するデータの種類
+type Channel string
+
+const (
+	// ExecutionsChannel 約定
+	ExecutionsChannel Channel = "executions"
+	// BoardChannel 板
+	BoardChannel Channel = "board"
+	// TickerChannel ティッカー
+	TickerChannel Channel = "ticker"
+	// OrderEventsChannel 自分の注文イベント. Symbolが空なら全銘柄
+	OrderEventsChannel Channel = "order_events"
+)
+
+// Topic 購読単位
+type Topic struct {
+	Channel Channel
+	Symbol  string
+}
+
+// Message ストリームで届くデータ. Channelに対応するフィールドのみ値が入る
+type Message struct {
+	Topic
+	Execution *execution.Execution
+	Board     *board.Board
+	// Levels 前回の板からの変化. 差分を計算できる場合のみ入る
+	Levels     []board.Level
+	Ticker     *ticker.Ticker
+	OrderEvent *orderevent.Event
+}
+
+// PublicStream 約定, 板, ティッカーを1接続で購読する
+type PublicStream interface {
+	// Subscribe Start前後どちらでも呼べる. 再接続時も同じTopicを購読する
+	Subscribe(topics ...Topic) error
+	Start() error
+	Close() error
+	// Read Message, error Messageはなかったらnilが飛ぶ
+	Read() (*Message, error)
+}
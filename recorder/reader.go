@@ -0,0 +1,215 @@
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReaderOptions options of Reader. zero value reads all records.
+type ReaderOptions struct {
+	// From records with LocalTime before From are skipped.
+	From time.Time
+	// To reading stops at the first record with LocalTime at or after To.
+	To time.Time
+}
+
+// Reader iterate records of a directory in LocalTime order.
+// files are merged, so directories written by several recorders can be read at once.
+type Reader struct {
+	opt     ReaderOptions
+	pending []recordFile
+	open    cursorHeap
+}
+
+type recordFile struct {
+	path  string
+	start time.Time
+}
+
+// OpenReader list record files of dir. files are opened lazily while reading.
+func OpenReader(dir string, opt ReaderOptions) (*Reader, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, filePrefix+"-*"+fileSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	files := []recordFile{}
+	for _, path := range paths {
+		// {prefix}-{start}-{seq}{suffix}
+		parts := strings.Split(strings.TrimSuffix(filepath.Base(path), fileSuffix), "-")
+		if len(parts) != 3 {
+			continue
+		}
+		start, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, recordFile{path: path, start: time.Unix(0, start)})
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].start.Equal(files[j].start) {
+			return files[i].path < files[j].path
+		}
+		return files[i].start.Before(files[j].start)
+	})
+
+	return &Reader{opt: opt, pending: files}, nil
+}
+
+// Next return the next record. io.EOF is returned at the end.
+func (r *Reader) Next() (*Record, error) {
+	for {
+		// 先頭より前に始まるファイルを開いておく
+		for len(r.pending) > 0 && (r.open.Len() == 0 || !r.pending[0].start.After(r.open[0].head.LocalTime)) {
+			file := r.pending[0]
+			r.pending = r.pending[1:]
+			if !r.opt.To.IsZero() && !file.start.Before(r.opt.To) {
+				r.pending = nil
+				break
+			}
+			c, err := openCursor(file.path)
+			if err != nil {
+				return nil, err
+			}
+			if c != nil {
+				heap.Push(&r.open, c)
+			}
+		}
+		if r.open.Len() == 0 {
+			return nil, io.EOF
+		}
+
+		c := r.open[0]
+		rec := c.head
+		more, err := c.next()
+		if err != nil {
+			return nil, err
+		}
+		if more {
+			heap.Fix(&r.open, 0)
+		} else {
+			heap.Pop(&r.open)
+			c.close()
+		}
+
+		if !r.opt.To.IsZero() && !rec.LocalTime.Before(r.opt.To) {
+			r.Close()
+			return nil, io.EOF
+		}
+		if rec.LocalTime.Before(r.opt.From) {
+			continue
+		}
+		return rec, nil
+	}
+}
+
+// Close close opened files.
+func (r *Reader) Close() error {
+	for _, c := range r.open {
+		c.close()
+	}
+	r.open = nil
+	r.pending = nil
+	return nil
+}
+
+// cursor reading position of a file. head is the record to be returned next.
+type cursor struct {
+	path    string
+	file    *os.File
+	gz      *gzip.Reader
+	scanner *bufio.Scanner
+	head    *Record
+}
+
+// openCursor return nil if the file has no record.
+func openCursor(path string) (*cursor, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		// ヘッダすら書かれずに落ちたファイル
+		file.Close()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+
+	c := &cursor{path: path, file: file, gz: gz, scanner: scanner}
+	more, err := c.next()
+	if err != nil || !more {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// next read the next record into head. a broken tail of a file cut by a crash is ignored.
+func (c *cursor) next() (bool, error) {
+	if !c.scanner.Scan() {
+		err := c.scanner.Err()
+		if err == nil || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		return false, fmt.Errorf("%s: %v", c.path, err)
+	}
+
+	rec := &Record{}
+	if err := json.Unmarshal(c.scanner.Bytes(), rec); err != nil {
+		// 最終行の書きかけであれば終端とみなす
+		if !c.scanner.Scan() {
+			return false, nil
+		}
+		return false, fmt.Errorf("%s: %v", c.path, err)
+	}
+	if rec.Version > FormatVersion {
+		return false, fmt.Errorf("%s: record version %d is not supported.", c.path, rec.Version)
+	}
+	c.head = rec
+	return true, nil
+}
+
+func (c *cursor) close() {
+	c.gz.Close()
+	c.file.Close()
+}
+
+type cursorHeap []*cursor
+
+func (h cursorHeap) Len() int {
+	return len(h)
+}
+
+func (h cursorHeap) Less(i, j int) bool {
+	return h[i].head.LocalTime.Before(h[j].head.LocalTime)
+}
+
+func (h cursorHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *cursorHeap) Push(x interface{}) {
+	*h = append(*h, x.(*cursor))
+}
+
+func (h *cursorHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
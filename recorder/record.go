@@ -0,0 +1,238 @@
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/ticker"
+	"github.com/TTRSQ/ccew/interface/exchange"
+)
+
+// FormatVersion version of Record written by this package.
+const FormatVersion = 1
+
+// file name is {prefix}-{start unix nano}-{seq}{suffix}. 名前順が書き込み順になる
+const (
+	filePrefix = "ccew"
+	fileSuffix = ".jsonl.gz"
+)
+
+// Record one line of recorded file. only the field of Channel is set.
+type Record struct {
+	Version  int              `json:"v"`
+	Exchange string           `json:"exchange"`
+	Symbol   string           `json:"symbol"`
+	Channel  exchange.Channel `json:"channel"`
+	// ExchangeTime time reported by exchange. zero if not reported.
+	ExchangeTime time.Time `json:"exchange_time"`
+	// LocalTime time when the record is received. increases within a file.
+	LocalTime time.Time `json:"local_time"`
+
+	Execution *execution.Execution `json:"execution,omitempty"`
+	Board     *board.Board         `json:"board,omitempty"`
+	Ticker    *ticker.Ticker       `json:"ticker,omitempty"`
+}
+
+// FromMessage make Record of msg received at localTime.
+func FromMessage(exchangeName string, msg *exchange.Message, localTime time.Time) Record {
+	rec := Record{
+		Version:   FormatVersion,
+		Exchange:  exchangeName,
+		Symbol:    msg.Symbol,
+		Channel:   msg.Channel,
+		LocalTime: localTime,
+		Execution: msg.Execution,
+		Board:     msg.Board,
+		Ticker:    msg.Ticker,
+	}
+	switch {
+	case msg.Execution != nil:
+		rec.ExchangeTime = msg.Execution.OccuredAt
+	case msg.Ticker != nil:
+		rec.ExchangeTime = msg.Ticker.OccuredAt
+	}
+	return rec
+}
+
+// Message convert to exchange.Message.
+func (r *Record) Message() *exchange.Message {
+	return &exchange.Message{
+		Topic:     exchange.Topic{Channel: r.Channel, Symbol: r.Symbol},
+		Execution: r.Execution,
+		Board:     r.Board,
+		Ticker:    r.Ticker,
+	}
+}
+
+// Time LocalTime, the clock of replay. boards have no ExchangeTime, and mixing the two clocks
+// would shift boards against trades by latency and clock skew.
+func (r *Record) Time() time.Time {
+	return r.LocalTime
+}
+
+// WriterOptions options of Writer. zero value uses default.
+type WriterOptions struct {
+	// MaxBytes rotate after this size of uncompressed records. default 64MB.
+	MaxBytes int64
+	// MaxAge rotate after this duration. default 1h.
+	MaxAge time.Duration
+	// FlushInterval records are flushed to the file at least this often. default 1s.
+	FlushInterval time.Duration
+}
+
+func (o WriterOptions) withDefault() WriterOptions {
+	if o.MaxBytes == 0 {
+		o.MaxBytes = 64 << 20
+	}
+	if o.MaxAge == 0 {
+		o.MaxAge = time.Hour
+	}
+	if o.FlushInterval == 0 {
+		o.FlushInterval = time.Second
+	}
+	return o
+}
+
+// Writer append records to rotating gzip files in a directory.
+// files are never rewritten. after a restart a new file is created,
+// so a file cut by a crash is left as is and read up to the last complete record.
+type Writer struct {
+	dir string
+	opt WriterOptions
+
+	mu        sync.Mutex
+	file      *os.File
+	gz        *gzip.Writer
+	buf       *bufio.Writer
+	seq       int
+	written   int64
+	openedAt  time.Time
+	flushedAt time.Time
+	lastTime  time.Time
+	closed    bool
+}
+
+// NewWriter create dir if not exists.
+func NewWriter(dir string, opt WriterOptions) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Writer{dir: dir, opt: opt.withDefault()}, nil
+}
+
+// Write append rec. LocalTime is set to now if zero and is kept non-decreasing.
+func (w *Writer) Write(rec Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errors.New("writer is closed.")
+	}
+
+	now := time.Now()
+	if rec.Version == 0 {
+		rec.Version = FormatVersion
+	}
+	if rec.LocalTime.IsZero() {
+		rec.LocalTime = now
+	}
+	if rec.LocalTime.Before(w.lastTime) {
+		rec.LocalTime = w.lastTime
+	}
+	w.lastTime = rec.LocalTime
+
+	if w.file != nil && (w.written >= w.opt.MaxBytes || now.Sub(w.openedAt) >= w.opt.MaxAge) {
+		if err := w.closeFile(); err != nil {
+			return err
+		}
+	}
+	if w.file == nil {
+		if err := w.openFile(rec.LocalTime); err != nil {
+			return err
+		}
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := w.buf.Write(line); err != nil {
+		return err
+	}
+	w.written += int64(len(line))
+
+	if now.Sub(w.flushedAt) >= w.opt.FlushInterval {
+		return w.flush(now)
+	}
+	return nil
+}
+
+// Flush write buffered records to the file.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.flush(time.Now())
+}
+
+// Close flush and close the current file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.file == nil {
+		return nil
+	}
+	return w.closeFile()
+}
+
+func (w *Writer) openFile(start time.Time) error {
+	w.seq++
+	name := fmt.Sprintf("%s-%019d-%06d%s", filePrefix, start.UnixNano(), w.seq, fileSuffix)
+	file, err := os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.gz = gzip.NewWriter(file)
+	w.buf = bufio.NewWriter(w.gz)
+	w.written = 0
+	w.openedAt = time.Now()
+	w.flushedAt = w.openedAt
+	return nil
+}
+
+// flush gzipのFlushで区切るので途中で落ちてもそこまでは読める
+func (w *Writer) flush(now time.Time) error {
+	w.flushedAt = now
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.gz.Flush()
+}
+
+func (w *Writer) closeFile() error {
+	err := w.buf.Flush()
+	if e := w.gz.Close(); e != nil && err == nil {
+		err = e
+	}
+	if e := w.file.Close(); e != nil && err == nil {
+		err = e
+	}
+	w.file = nil
+	return err
+}
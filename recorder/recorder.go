@@ -0,0 +1,184 @@
+package recorder
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/interface/exchange"
+)
+
+// Source stream to record. wrap Stream with stream.SupervisePublic to keep recording over disconnects.
+type Source struct {
+	Exchange string
+	Stream   exchange.PublicStream
+	Topics   []exchange.Topic
+}
+
+// notifier streams implementing it are waited on instead of polled. same as stream.Notifier.
+type notifier interface {
+	Ready() <-chan struct{}
+}
+
+// Recorder record messages of sources into a directory.
+// an error of any source or of writing stops the whole recording. see Done and Err.
+type Recorder struct {
+	writer  *Writer
+	sources []Source
+
+	mu       sync.Mutex
+	err      error
+	closed   bool
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// New create recorder writing to dir.
+func New(dir string, opt WriterOptions, sources ...Source) (*Recorder, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("sources required.")
+	}
+	writer, err := NewWriter(dir, opt)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		writer:  writer,
+		sources: sources,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Start subscribe topics, start streams and record until Close.
+func (r *Recorder) Start() error {
+	for i, src := range r.sources {
+		err := src.Stream.Subscribe(src.Topics...)
+		if err == nil {
+			err = src.Stream.Start()
+		}
+		if err != nil {
+			// 起動済みのものは閉じる
+			for _, started := range r.sources[:i] {
+				started.Stream.Close()
+			}
+			return err
+		}
+	}
+	for _, src := range r.sources {
+		r.wg.Add(1)
+		go r.record(src)
+	}
+
+	// 読み込みがなくても定期的に書き出す
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.writer.opt.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+				if err := r.writer.Flush(); err != nil {
+					r.fail(err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Close stop recording and close streams and the file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.mu.Unlock()
+
+	r.stop()
+	r.wg.Wait()
+	var err error
+	for _, src := range r.sources {
+		if e := src.Stream.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	if e := r.writer.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Done closed when recording stops by Close or an error. Close is still needed to close streams and the file.
+func (r *Recorder) Done() <-chan struct{} {
+	return r.done
+}
+
+// Err return the error which stopped recording. wrap streams with stream.SupervisePublic so that
+// disconnects are not errors.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// fail stop recording of all sources by err.
+func (r *Recorder) fail(err error) {
+	r.mu.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.mu.Unlock()
+	r.stop()
+}
+
+func (r *Recorder) stop() {
+	r.stopOnce.Do(func() {
+		close(r.done)
+	})
+}
+
+func (r *Recorder) record(src Source) {
+	defer r.wg.Done()
+	var ready <-chan struct{}
+	if n, ok := src.Stream.(notifier); ok {
+		ready = n.Ready()
+	}
+	for {
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+
+		msg, err := src.Stream.Read()
+		if err != nil {
+			r.fail(err)
+			return
+		}
+		if msg != nil {
+			if err := r.writer.Write(FromMessage(src.Exchange, msg, time.Now())); err != nil {
+				r.fail(err)
+				return
+			}
+			continue
+		}
+
+		// 読み切ったら通知を待つ. 通知できないストリームはポーリングする
+		var poll <-chan time.Time
+		if ready == nil {
+			poll = time.After(time.Millisecond)
+		}
+		select {
+		case <-r.done:
+			return
+		case <-ready:
+		case <-poll:
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package recorder
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/interface/exchange"
+)
+
+func executionRecord(price float64, at time.Time) Record {
+	return Record{
+		Exchange:  "bitflyer",
+		Symbol:    "FX_BTC_JPY",
+		Channel:   exchange.ExecutionsChannel,
+		LocalTime: at,
+		Execution: &execution.Execution{Norm: base.Norm{Price: price, Size: 1}},
+	}
+}
+
+func TestWriteAndRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	start := time.Unix(1600000000, 0)
+
+	// 1レコードごとにローテートする
+	w, err := NewWriter(dir, WriterOptions{MaxBytes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.Write(executionRecord(float64(i), start.Add(time.Duration(i*2)*time.Second))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	// 再起動後, 別のwriterが間の時刻を書く
+	w, _ = NewWriter(dir, WriterOptions{})
+	w.Write(executionRecord(1.5, start.Add(3*time.Second)))
+	w.Close()
+
+	// 落ちて途中で切れたファイル
+	crashed, _ := NewWriter(dir, WriterOptions{})
+	crashed.Write(executionRecord(10, start.Add(10*time.Second)))
+	crashed.Flush()
+	crashed.Write(executionRecord(11, start.Add(11*time.Second)))
+	crashed.buf.Flush()
+	crashed.file.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+fileSuffix))
+	if len(files) != 5 {
+		t.Fatalf("files %v", files)
+	}
+
+	r, err := OpenReader(dir, ReaderOptions{From: start.Add(time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got := []float64{}
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Version != FormatVersion {
+			t.Errorf("version %d", rec.Version)
+		}
+		got = append(got, rec.Execution.Price)
+	}
+	want := []float64{1, 1.5, 2, 10}
+	if len(got) != len(want) {
+		t.Fatalf("%v != %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("%v != %v", got, want)
+		}
+	}
+}
+
+// fakeStream Readでerrを返す. errがnilなら通知を待つ
+type fakeStream struct {
+	err    error
+	ready  chan struct{}
+	closed chan struct{}
+}
+
+func (s *fakeStream) Subscribe(topics ...exchange.Topic) error { return nil }
+func (s *fakeStream) Start() error                             { return nil }
+func (s *fakeStream) Ready() <-chan struct{}                   { return s.ready }
+func (s *fakeStream) Close() error {
+	close(s.closed)
+	return nil
+}
+func (s *fakeStream) Read() (*exchange.Message, error) {
+	return nil, s.err
+}
+
+func TestStopOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	healthy := &fakeStream{ready: make(chan struct{}), closed: make(chan struct{})}
+	broken := &fakeStream{err: errors.New("disconnected"), closed: make(chan struct{})}
+	rec, err := New(dir, WriterOptions{}, Source{Exchange: "a", Stream: healthy}, Source{Exchange: "b", Stream: broken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1つのエラーで全体が止まる
+	select {
+	case <-rec.Done():
+	case <-time.After(time.Second):
+		t.Fatal("recorder did not stop")
+	}
+	if rec.Err() == nil || rec.Err().Error() != "disconnected" {
+		t.Fatalf("err = %v", rec.Err())
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*fakeStream{healthy, broken} {
+		select {
+		case <-s.closed:
+		default:
+			t.Fatal("stream not closed")
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
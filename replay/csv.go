@@ -0,0 +1,151 @@
+package replay
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/recorder"
+)
+
+// CSVOptions column layout of trade dump. start from DefaultCSVOptions.
+type CSVOptions struct {
+	Exchange string
+	Symbol   string
+	// Header skip the first line.
+	Header bool
+	// column index of each value. IDColumn < 0 means no id column.
+	TimeColumn  int
+	PriceColumn int
+	SizeColumn  int
+	SideColumn  int
+	IDColumn    int
+}
+
+// DefaultCSVOptions "time,price,size,side,id" with header.
+func DefaultCSVOptions(exchangeName, symbol string) CSVOptions {
+	return CSVOptions{
+		Exchange:    exchangeName,
+		Symbol:      symbol,
+		Header:      true,
+		TimeColumn:  0,
+		PriceColumn: 1,
+		SizeColumn:  2,
+		SideColumn:  3,
+		IDColumn:    4,
+	}
+}
+
+type csvSource struct {
+	opt    CSVOptions
+	reader *csv.Reader
+	line   int
+}
+
+// FromCSV read trades. time is RFC3339, unix seconds or unix milliseconds.
+// trades must be in time order.
+func FromCSV(r io.Reader, opt CSVOptions) Source {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	return &csvSource{opt: opt, reader: reader}
+}
+
+func (s *csvSource) Next() (*recorder.Record, error) {
+	for {
+		row, err := s.reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		s.line++
+		if s.line == 1 && s.opt.Header {
+			continue
+		}
+		return s.parse(row)
+	}
+}
+
+func (s *csvSource) parse(row []string) (*recorder.Record, error) {
+	column := func(i int) (string, error) {
+		if i >= len(row) {
+			return "", fmt.Errorf("line %d: column %d not found.", s.line, i)
+		}
+		return strings.TrimSpace(row[i]), nil
+	}
+
+	timeStr, err := column(s.opt.TimeColumn)
+	if err != nil {
+		return nil, err
+	}
+	occuredAt, err := parseTime(timeStr)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", s.line, err)
+	}
+	priceStr, err := column(s.opt.PriceColumn)
+	if err != nil {
+		return nil, err
+	}
+	price, err := strconv.ParseFloat(priceStr, 64)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", s.line, err)
+	}
+	sizeStr, err := column(s.opt.SizeColumn)
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.ParseFloat(sizeStr, 64)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", s.line, err)
+	}
+	side, err := column(s.opt.SideColumn)
+	if err != nil {
+		return nil, err
+	}
+	localID := fmt.Sprint(s.line)
+	if s.opt.IDColumn >= 0 {
+		if localID, err = column(s.opt.IDColumn); err != nil {
+			return nil, err
+		}
+	}
+
+	return &recorder.Record{
+		Version:      recorder.FormatVersion,
+		Exchange:     s.opt.Exchange,
+		Symbol:       s.opt.Symbol,
+		Channel:      exchange.ExecutionsChannel,
+		ExchangeTime: occuredAt,
+		LocalTime:    occuredAt,
+		Execution: &execution.Execution{
+			ID: id.NewID(s.opt.Exchange, s.opt.Symbol, localID),
+			Norm: base.Norm{
+				Price: price,
+				Size:  size,
+			},
+			IsBuy:     strings.ToLower(side) == "buy",
+			OccuredAt: occuredAt,
+		},
+	}, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, errors.New("invalid time " + s)
+	}
+	// 1e12以上はミリ秒とみなす
+	if v >= 1e12 {
+		return time.Unix(0, int64(v*float64(time.Millisecond))), nil
+	}
+	return time.Unix(0, int64(v*float64(time.Second))), nil
+}
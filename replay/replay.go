@@ -0,0 +1,313 @@
+package replay
+
+import (
+	"container/heap"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/recorder"
+)
+
+// ErrEnd all events are replayed. Read of Driver returns it at the end.
+var ErrEnd = errors.New("replay is ended.")
+
+// Source events to replay. Next returns io.EOF at the end.
+// *recorder.Reader implements it.
+type Source interface {
+	Next() (*recorder.Record, error)
+}
+
+// Options of Driver.
+type Options struct {
+	// Speed 1 replays in real time, 10 is 10 times faster. 0 means as fast as possible.
+	Speed float64
+	// From events before From are skipped. zero means from the first event.
+	From time.Time
+	// To replay ends before the first event at or after To. zero means until the end.
+	To time.Time
+	// ReorderWindow events are sorted by local time (Record.Time) within this window. default 1s.
+	// recorded files are already in order, other sources can be slightly out of order.
+	ReorderWindow time.Duration
+}
+
+// Driver replay events in local time order and advance the dummy exchange before each event is read.
+// it implements exchange.PublicStream, so strategies read it like live streams.
+type Driver struct {
+	src Source
+	ex  exchange.Exchange
+	opt Options
+
+	mu        sync.Mutex
+	topics    map[exchange.Topic]bool
+	buf       recordHeap
+	seq       int
+	srcEnded  bool
+	lastRead  time.Time
+	now       time.Time
+	wallStart time.Time
+	evStart   time.Time
+	started   bool
+	closed    bool
+}
+
+// New ex is advanced by replayed events, usually the dummy exchange. ex can be nil.
+func New(ex exchange.Exchange, src Source, opt Options) *Driver {
+	if opt.ReorderWindow == 0 {
+		opt.ReorderWindow = time.Second
+	}
+	return &Driver{
+		src:    src,
+		ex:     ex,
+		opt:    opt,
+		topics: map[exchange.Topic]bool{},
+	}
+}
+
+// Subscribe filter events by topics. all events are read if not subscribed.
+func (d *Driver) Subscribe(topics ...exchange.Topic) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, topic := range topics {
+		d.topics[topic] = true
+	}
+	return nil
+}
+
+func (d *Driver) Start() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return errors.New("replay is closed.")
+	}
+	d.started = true
+	return nil
+}
+
+func (d *Driver) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	if c, ok := d.src.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Now current event time. strategies use it instead of time.Now.
+func (d *Driver) Now() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.now
+}
+
+// Read apply the next event to the exchange and return it. ErrEnd is returned at the end.
+// with Speed, Read returns nil until the event time comes like live streams.
+func (d *Driver) Read() (*exchange.Message, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.started {
+		return nil, errors.New("replay is not started.")
+	}
+	if d.closed {
+		return nil, ErrEnd
+	}
+
+	rec, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+	t := rec.Time()
+
+	// 速度指定があれば実時間を待つ
+	if d.opt.Speed > 0 {
+		if d.wallStart.IsZero() {
+			d.wallStart = time.Now()
+			d.evStart = t
+		}
+		due := d.wallStart.Add(time.Duration(float64(t.Sub(d.evStart)) / d.opt.Speed))
+		if time.Now().Before(due) {
+			return nil, nil
+		}
+	}
+
+	heap.Pop(&d.buf)
+	if t.After(d.now) {
+		d.now = t
+	}
+	msg := rec.Message()
+	if err := d.apply(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// NextTime event time of the event Read returns next. ErrEnd is returned at the end.
+// backtests use it to run timers before the event.
+func (d *Driver) NextTime() (time.Time, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return time.Time{}, ErrEnd
+	}
+	rec, err := d.next()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return rec.Time(), nil
+}
+
+// next return the next event to be read without removing it. skipped events are removed.
+func (d *Driver) next() (*recorder.Record, error) {
+	for {
+		rec, err := d.peek()
+		if err != nil {
+			return nil, err
+		}
+		if rec == nil {
+			return nil, ErrEnd
+		}
+		t := rec.Time()
+		if !d.opt.To.IsZero() && !t.Before(d.opt.To) {
+			return nil, ErrEnd
+		}
+		if t.Before(d.opt.From) || !d.subscribed(rec) {
+			heap.Pop(&d.buf)
+			continue
+		}
+		return rec, nil
+	}
+}
+
+// Run read all events and call f after each event is applied. f is called from the caller goroutine.
+func (d *Driver) Run(f func(msg *exchange.Message) error) error {
+	if err := d.Start(); err != nil {
+		return err
+	}
+	for {
+		msg, err := d.Read()
+		if err == ErrEnd {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg == nil {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		if err := f(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *Driver) subscribed(rec *recorder.Record) bool {
+	if len(d.topics) == 0 {
+		return true
+	}
+	return d.topics[exchange.Topic{Channel: rec.Channel, Symbol: rec.Symbol}]
+}
+
+// peek fill the reorder buffer and return the earliest event. nil at the end.
+func (d *Driver) peek() (*recorder.Record, error) {
+	for !d.srcEnded && (d.buf.Len() == 0 || d.lastRead.Sub(d.buf[0].rec.Time()) < d.opt.ReorderWindow) {
+		rec, err := d.src.Next()
+		if err == io.EOF {
+			d.srcEnded = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rec.Time().After(d.lastRead) {
+			d.lastRead = rec.Time()
+		}
+		d.seq++
+		heap.Push(&d.buf, &bufferedRecord{rec: rec, seq: d.seq})
+	}
+	if d.buf.Len() == 0 {
+		return nil, nil
+	}
+	return d.buf[0].rec, nil
+}
+
+// apply advance the exchange by msg. Simulator receives whole executions and boards of each symbol.
+func (d *Driver) apply(msg *exchange.Message) error {
+	if d.ex == nil {
+		return nil
+	}
+	if sim, ok := d.ex.(exchange.Simulator); ok {
+		if err := sim.UpdateTime(d.now); err != nil {
+			return err
+		}
+		switch {
+		case msg.Execution != nil:
+			e := *msg.Execution
+			e.Symbol = msg.Symbol
+			return sim.UpdateExecution(e)
+		case msg.Board != nil:
+			b := *msg.Board
+			b.Symbol = msg.Symbol
+			return sim.UpdateBoard(b)
+		case msg.Ticker != nil:
+			if msg.Ticker.BestAsk == 0 || msg.Ticker.BestBid == 0 {
+				return nil
+			}
+			return sim.UpdateSymbolBestPrice(msg.Symbol, msg.Ticker.BestAsk, msg.Ticker.BestBid)
+		}
+		return nil
+	}
+	switch {
+	case msg.Execution != nil:
+		return d.ex.UpdateLTP(msg.Execution.Price)
+	case msg.Board != nil:
+		if len(msg.Board.Asks) == 0 || len(msg.Board.Bids) == 0 {
+			return nil
+		}
+		return d.ex.UpdateBestPrice(msg.Board.Asks[0].Price, msg.Board.Bids[0].Price)
+	case msg.Ticker != nil:
+		if msg.Ticker.BestAsk == 0 || msg.Ticker.BestBid == 0 {
+			return nil
+		}
+		return d.ex.UpdateBestPrice(msg.Ticker.BestAsk, msg.Ticker.BestBid)
+	}
+	return nil
+}
+
+type bufferedRecord struct {
+	rec *recorder.Record
+	seq int
+}
+
+// recordHeap 同時刻は読み込み順を保つ
+type recordHeap []*bufferedRecord
+
+func (h recordHeap) Len() int {
+	return len(h)
+}
+
+func (h recordHeap) Less(i, j int) bool {
+	ti, tj := h[i].rec.Time(), h[j].rec.Time()
+	if ti.Equal(tj) {
+		return h[i].seq < h[j].seq
+	}
+	return ti.Before(tj)
+}
+
+func (h recordHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *recordHeap) Push(x interface{}) {
+	*h = append(*h, x.(*bufferedRecord))
+}
+
+func (h *recordHeap) Pop() interface{} {
+	old := *h
+	rec := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return rec
+}
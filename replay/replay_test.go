@@ -0,0 +1,92 @@
+package replay
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/recorder"
+	"github.com/TTRSQ/ccew/src/dummy"
+)
+
+func TestReplayCSV(t *testing.T) {
+	// 3行目は時刻が前後している
+	csv := `time,price,size,side,id
+1600000000,100,1,buy,1
+1600000002,96,1,sell,3
+1600000001.5,98,1,sell,2
+1600000003,94,1,sell,4
+1600000010,90,1,sell,5
+`
+	ex, _ := dummy.New(exchange.Key{})
+	d := New(ex, FromCSV(strings.NewReader(csv), DefaultCSVOptions("bitflyer", "FX_BTC_JPY")), Options{
+		From: time.Unix(1600000001, 0),
+		To:   time.Unix(1600000010, 0),
+	})
+
+	got := []string{}
+	ordered := false
+	err := d.Run(func(msg *exchange.Message) error {
+		got = append(got, msg.Execution.LocalID)
+		// 最初のイベントの後に戦略が注文する
+		if !ordered {
+			ordered = true
+			_, err := ex.CreateOrder(95, 1, true, "FX_BTC_JPY", "LIMIT")
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "2,3,4" {
+		t.Errorf("events %v", got)
+	}
+	if !d.Now().Equal(time.Unix(1600000003, 0)) {
+		t.Errorf("now %v", d.Now())
+	}
+	stock, _ := ex.Stocks("FX_BTC_JPY")
+	if stock.Summary != 1 {
+		t.Errorf("order is not filled by replayed trade: %+v", stock)
+	}
+}
+
+// records Source of records in memory.
+type records []*recorder.Record
+
+func (r *records) Next() (*recorder.Record, error) {
+	if len(*r) == 0 {
+		return nil, io.EOF
+	}
+	rec := (*r)[0]
+	*r = (*r)[1:]
+	return rec, nil
+}
+
+func TestReplayLocalTime(t *testing.T) {
+	// 約定は取引所の時刻では板より前だが, 受信は板の後
+	at := time.Unix(1600000010, 0)
+	src := &records{
+		{Symbol: "FX_BTC_JPY", Channel: exchange.BoardChannel, LocalTime: at, Board: &board.Board{Symbol: "FX_BTC_JPY"}},
+		{Symbol: "FX_BTC_JPY", Channel: exchange.ExecutionsChannel, ExchangeTime: at.Add(-300 * time.Millisecond), LocalTime: at.Add(200 * time.Millisecond),
+			Execution: &execution.Execution{Norm: base.Norm{Price: 100, Size: 1}}},
+	}
+	d := New(nil, src, Options{})
+
+	got := []exchange.Channel{}
+	if err := d.Run(func(msg *exchange.Message) error {
+		got = append(got, msg.Channel)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// 板と約定は受信時刻の順に並ぶ
+	if len(got) != 2 || got[0] != exchange.BoardChannel || got[1] != exchange.ExecutionsChannel {
+		t.Errorf("events %v", got)
+	}
+}
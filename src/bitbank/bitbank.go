@@ -2,13 +2,9 @@ package bitbank
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -18,23 +14,23 @@ import (
 
 	"github.com/TTRSQ/ccew/domains/base"
 	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
 	"github.com/TTRSQ/ccew/domains/order"
 	"github.com/TTRSQ/ccew/domains/order/id"
 	"github.com/TTRSQ/ccew/domains/stock"
 	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/httpx"
+	"github.com/TTRSQ/ccew/util/ratelimit"
+	"github.com/TTRSQ/ccew/util/retry"
+	"github.com/TTRSQ/ccew/util/sign"
 )
 
-type keyStruct struct {
-	id  string
-	sec string
-}
-
 type bitbank struct {
-	keys    []keyStruct
 	host    string
 	pubHost string
 	name    string
-	keyIdx  int
+
+	client *httpx.Client
 }
 
 // New return exchange obj.
@@ -44,27 +40,19 @@ func New(key exchange.Key) (exchange.Exchange, error) {
 	bb.host = "api.bitbank.cc"
 	bb.pubHost = "public.bitbank.cc"
 
-	if key.APIKey == "" || key.APISecKey == "" {
-		return nil, errors.New("APIKey and APISecKey Required")
-	}
-	bb.keys = []keyStruct{
-		{
-			id:  key.APIKey,
-			sec: key.APISecKey,
-		},
+	// additional_keys 複数のキーを順番に使う
+	keys, err := sign.PoolOf(key)
+	if err != nil {
+		return nil, err
 	}
+	keys.Reject = sign.BitbankRejected
 
-	// nonceError回避用のkeyを追加する
-	_, exist := key.SpecificParam["additional_keys"]
-	if exist {
-		additionalKeys := key.SpecificParam["additional_keys"].([][]string)
-		for i := range additionalKeys {
-			bb.keys = append(bb.keys, keyStruct{
-				id:  additionalKeys[i][0],
-				sec: additionalKeys[i][1],
-			})
-		}
-	}
+	bb.client = httpx.New(key, httpx.Options{
+		Name:        bb.name,
+		RateLimiter: ratelimit.New(ratelimit.Bitbank()),
+		Retry:       retry.Bitbank(),
+		Signer:      sign.Bitbank(keys),
+	})
 
 	return &bb, nil
 }
@@ -312,6 +300,50 @@ func (bb *bitbank) Boards(symbol string) (board.Board, error) {
 	}, nil
 }
 
+func (bb *bitbank) Executions(symbol string) ([]execution.Execution, error) {
+	res, err := bb.getRequest(symbol+"/transactions", nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// レスポンスの変換
+	type Res struct {
+		Success int `json:"success"`
+		Data    struct {
+			Transactions []struct {
+				TransactionID int64  `json:"transaction_id"`
+				Side          string `json:"side"`
+				Price         string `json:"price"`
+				Amount        string `json:"amount"`
+				ExecutedAt    int64  `json:"executed_at"`
+			} `json:"transactions"`
+		} `json:"data"`
+	}
+	resData := Res{}
+	json.Unmarshal(res, &resData)
+	if resData.Success != 1 {
+		return nil, errors.New(string(res))
+	}
+
+	// 返却値の作成
+	ret := []execution.Execution{}
+	for _, data := range resData.Data.Transactions {
+		price, _ := strconv.ParseFloat(data.Price, 64)
+		size, _ := strconv.ParseFloat(data.Amount, 64)
+		ret = append(ret, execution.Execution{
+			ID: id.NewID(bb.name, symbol, fmt.Sprint(data.TransactionID)),
+			Norm: base.Norm{
+				Price: price,
+				Size:  size,
+			},
+			IsBuy:     data.Side == "buy",
+			OccuredAt: time.Unix(0, data.ExecutedAt*int64(time.Millisecond)),
+		})
+	}
+
+	return ret, nil
+}
+
 func (bb *bitbank) InScheduledMaintenance() bool {
 	return false
 }
@@ -336,19 +368,11 @@ func (bb *bitbank) getRequest(path string, param interface{}, isPublic bool) ([]
 
 	req.Header.Add("Content-Type", "application/json")
 
-	if !isPublic {
-		timeStamp := fmt.Sprintf("%d", time.Now().UnixNano())
-		sigPATH := u.Path
-		if u.RawQuery != "" {
-			sigPATH += "?" + u.RawQuery
-		}
-		sig, apiKey := bb.makeHMAC(timeStamp + sigPATH)
-		req.Header.Add("ACCESS-KEY", apiKey)
-		req.Header.Add("ACCESS-SIGNATURE", sig)
-		req.Header.Add("ACCESS-NONCE", timeStamp)
+	if isPublic {
+		req = sign.Public(req)
 	}
 
-	return bb.request(req)
+	return bb.client.Do(req)
 }
 
 func (bb *bitbank) postRequest(path string, param interface{}) ([]byte, error) {
@@ -362,13 +386,7 @@ func (bb *bitbank) postRequest(path string, param interface{}) ([]byte, error) {
 
 	req.Header.Add("Content-Type", "application/json")
 
-	timeStamp := fmt.Sprintf("%d", time.Now().UnixNano())
-	sig, apiKey := bb.makeHMAC(timeStamp + string(jsonParam))
-	req.Header.Add("ACCESS-KEY", apiKey)
-	req.Header.Add("ACCESS-SIGNATURE", sig)
-	req.Header.Add("ACCESS-NONCE", timeStamp)
-
-	return bb.request(req)
+	return bb.client.Do(req)
 }
 
 func structToQuery(data interface{}) string {
@@ -392,41 +410,6 @@ func structToQuery(data interface{}) string {
 	return strings.Join(queries, "&")
 }
 
-func (bb *bitbank) makeHMAC(msg string) (string, string) {
-	key := bb.getKey()
-	mac := hmac.New(sha256.New, []byte(key.sec))
-	mac.Write([]byte(msg))
-	return hex.EncodeToString(mac.Sum(nil)), key.id
-}
-
-func (bb *bitbank) getKey() keyStruct {
-	idx := bb.keyIdx
-	bb.keyIdx = (bb.keyIdx + 1) % len(bb.keys)
-	return bb.keys[idx]
-}
-
-func (bb *bitbank) request(req *http.Request) ([]byte, error) {
-	client := new(http.Client)
-	resp, err := client.Do(req)
-
-	if err != nil {
-		errStr := fmt.Sprintf("err ==> %+v\nreq ==> %v\n", err, req)
-		return nil, errors.New(errStr)
-	}
-	if resp.StatusCode != 200 {
-		body, _ := ioutil.ReadAll(resp.Body)
-		errStr := ""
-		errStr += fmt.Sprintf("body ==> %s\n", string(body))
-		errStr += fmt.Sprintf("resp ==> %+v\nreq ==> %v\n", resp, req)
-		return nil, errors.New(errStr)
-	}
-
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-
-	return body, err
-}
-
 func (bb *bitbank) UpdateLTP(lastTimePrice float64) error {
 	return errors.New("not supported.")
 }
@@ -2,13 +2,9 @@ package bitflyer
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
@@ -16,20 +12,22 @@ import (
 
 	"github.com/TTRSQ/ccew/domains/base"
 	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
 	"github.com/TTRSQ/ccew/domains/order"
 	"github.com/TTRSQ/ccew/domains/order/id"
 	"github.com/TTRSQ/ccew/domains/stock"
 	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/httpx"
+	"github.com/TTRSQ/ccew/util/ratelimit"
+	"github.com/TTRSQ/ccew/util/retry"
+	"github.com/TTRSQ/ccew/util/sign"
 )
 
 type bitflyer struct {
-	apiKey    string
-	apiSecKey string
-	host      string
-	name      string
+	host string
+	name string
 
-	proxyURL   *url.URL
-	httpClient *http.Client
+	client *httpx.Client
 }
 
 // New return exchange obj.
@@ -38,24 +36,19 @@ func New(key exchange.Key) (exchange.Exchange, error) {
 	bf.name = "bitflyer"
 	bf.host = "api.bitflyer.com"
 
-	if key.APIKey == "" || key.APISecKey == "" {
-		return nil, errors.New("APIKey and APISecKey Required")
-	}
-	bf.apiKey = key.APIKey
-	bf.apiSecKey = key.APISecKey
-
-	bf.httpClient = new(http.Client)
-	if key.SpecificParam["proxyURL"] != nil {
-		bf.httpClient = &http.Client{
-			Transport: &http.Transport{
-				Proxy: http.ProxyURL(key.SpecificParam["proxyURL"].(*url.URL)),
-			},
-		}
+	// additional_keys 複数のキーを順番に使う
+	keys, err := sign.PoolOf(key)
+	if err != nil {
+		return nil, err
 	}
+	keys.Reject = sign.BitflyerRejected
 
-	if key.SpecificParam["timeoutMS"] != nil {
-		bf.httpClient.Timeout = time.Duration(key.SpecificParam["timeoutMS"].(int)) * time.Millisecond
-	}
+	bf.client = httpx.New(key, httpx.Options{
+		Name:        bf.name,
+		RateLimiter: ratelimit.New(ratelimit.Bitflyer()),
+		Retry:       retry.Bitflyer(),
+		Signer:      sign.Bitflyer(keys),
+	})
 
 	return &bf, nil
 }
@@ -324,6 +317,48 @@ func (bf *bitflyer) Boards(symbol string) (board.Board, error) {
 	}, nil
 }
 
+func (bf *bitflyer) Executions(symbol string) ([]execution.Execution, error) {
+	type Req struct {
+		Symbol string `json:"product_code"`
+		Count  int    `json:"count"`
+	}
+	res, err := bf.getRequest("/v1/getexecutions", Req{
+		Symbol: symbol,
+		Count:  100,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// レスポンスの変換
+	type Res []struct {
+		ID       int64   `json:"id"`
+		Side     string  `json:"side"`
+		Price    float64 `json:"price"`
+		Size     float64 `json:"size"`
+		ExecDate string  `json:"exec_date"`
+	}
+	resData := Res{}
+	json.Unmarshal(res, &resData)
+
+	// 返却値の作成. exec_dateはタイムゾーンなしのUTC
+	ret := []execution.Execution{}
+	for _, data := range resData {
+		occuredAt, _ := time.Parse("2006-01-02T15:04:05.999999999", strings.TrimSuffix(data.ExecDate, "Z"))
+		ret = append(ret, execution.Execution{
+			ID: id.NewID(bf.name, symbol, fmt.Sprint(data.ID)),
+			Norm: base.Norm{
+				Price: data.Price,
+				Size:  data.Size,
+			},
+			IsBuy:     data.Side == "BUY",
+			OccuredAt: occuredAt,
+		})
+	}
+
+	return ret, nil
+}
+
 func (bf *bitflyer) InScheduledMaintenance() bool {
 	// jst := utiltime.Jst()
 	// // 355 <= time <= 415で落とす
@@ -346,27 +381,17 @@ func (bf *bitflyer) getRequest(path string, param interface{}) ([]byte, error) {
 	}
 
 	uri := url.URL{Scheme: "https", Host: bf.host, Path: path, RawQuery: uparm.Encode()}
-	timestamp := fmt.Sprintf("%d", time.Now().Unix())
 	req, _ := http.NewRequest(
 		"GET",
 		uri.String(),
 		nil,
 	)
 
-	req.Header.Add("ACCESS-KEY", bf.apiKey)
-	req.Header.Add("ACCESS-TIMESTAMP", timestamp)
-
-	rawSign := timestamp + "GET" + path + "?" + uparm.Encode()
-	sign := bf.makeHMAC(rawSign)
-
-	req.Header.Add("ACCESS-SIGN", sign)
-
-	return bf.request(req)
+	return bf.client.Do(req)
 }
 
 func (bf *bitflyer) postRequest(path string, param interface{}) ([]byte, error) {
 	url := url.URL{Scheme: "https", Host: bf.host, Path: path}
-	timestamp := fmt.Sprintf("%d", time.Now().Unix())
 	jsonParam, _ := json.Marshal(param)
 	req, _ := http.NewRequest(
 		"POST",
@@ -375,41 +400,8 @@ func (bf *bitflyer) postRequest(path string, param interface{}) ([]byte, error)
 	)
 
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("ACCESS-KEY", bf.apiKey)
-	req.Header.Add("ACCESS-TIMESTAMP", timestamp)
-
-	rawSign := timestamp + "POST" + path + string(jsonParam)
-	sign := bf.makeHMAC(rawSign)
-
-	req.Header.Add("ACCESS-SIGN", sign)
-
-	return bf.request(req)
-}
-
-func (bf *bitflyer) makeHMAC(msg string) string {
-	mac := hmac.New(sha256.New, []byte(bf.apiSecKey))
-	mac.Write([]byte(msg))
-	return hex.EncodeToString(mac.Sum(nil))
-}
-
-func (bf *bitflyer) request(req *http.Request) ([]byte, error) {
-	resp, err := bf.httpClient.Do(req)
-
-	if err != nil {
-		errStr := fmt.Sprintf("err ==> %+v\nreq ==> %v\n", err, req)
-		return nil, errors.New(errStr)
-	}
-	if resp.StatusCode != 200 {
-		body, _ := ioutil.ReadAll(resp.Body)
-		errStr := fmt.Sprintf("body ==> %s\n", string(body))
-		errStr += fmt.Sprintf("resp ==> %+v\nreq ==> %v\n", resp, req)
-		return nil, errors.New(errStr)
-	}
-
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
 
-	return body, err
+	return bf.client.Do(req)
 }
 
 func (bf *bitflyer) UpdateLTP(lastTimePrice float64) error {
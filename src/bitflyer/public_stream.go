@@ -0,0 +1,282 @@
+package bitflyer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/ticker"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/wsconn"
+)
+
+type publicStream struct {
+	name     string
+	endpoint string
+	proxyURL *url.URL
+
+	mu     sync.Mutex
+	conn   *wsconn.Conn
+	topics []exchange.Topic
+	queue  *wsconn.Queue
+}
+
+// NewPublicStream return stream of lightning_executions, lightning_board and lightning_ticker.
+func NewPublicStream(key exchange.Key) (exchange.PublicStream, error) {
+	ps := publicStream{}
+	ps.name = "bitflyer"
+	ps.endpoint = "wss://ws.lightstream.bitflyer.com/json-rpc"
+	if key.SpecificParam["proxyURL"] != nil {
+		ps.proxyURL = key.SpecificParam["proxyURL"].(*url.URL)
+	}
+	ps.queue = &wsconn.Queue{}
+
+	return &ps, nil
+}
+
+func (ps *publicStream) Subscribe(topics ...exchange.Topic) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.topics = append(ps.topics, topics...)
+	if ps.conn == nil {
+		return nil
+	}
+	return subscribeTopics(ps.conn, topics)
+}
+
+func (ps *publicStream) Start() error {
+	conn, err := wsconn.Dial(ps.endpoint, ps.proxyURL)
+	if err != nil {
+		return err
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if err := subscribeTopics(conn, ps.topics); err != nil {
+		conn.Close()
+		return err
+	}
+	// 板は接続ごとに作り直す
+	books := map[string]*board.Book{}
+	// 再接続時は前の接続を閉じてから差し替える
+	if ps.conn != nil {
+		ps.conn.Close()
+	}
+	ps.conn = conn
+	conn.WakeOnClose(ps.queue)
+	conn.Listen(func(msg []byte) {
+		ps.handle(books, msg)
+	})
+	return nil
+}
+
+func (ps *publicStream) Close() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return nil
+	}
+	err := ps.conn.Close()
+	ps.conn = nil
+	return err
+}
+
+// Ready receive when Read may return a message or the error of the connection.
+func (ps *publicStream) Ready() <-chan struct{} {
+	return ps.queue.Ready()
+}
+
+func (ps *publicStream) Read() (*exchange.Message, error) {
+	if v := ps.queue.Pop(); v != nil {
+		msg := v.(exchange.Message)
+		return &msg, nil
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return nil, errors.New("stream is not started.")
+	}
+	return nil, ps.conn.Err()
+}
+
+func (ps *publicStream) Ping() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return errors.New("stream is not started.")
+	}
+	return ps.conn.Ping()
+}
+
+func (ps *publicStream) LastReceived() time.Time {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return time.Time{}
+	}
+	return ps.conn.LastReceived()
+}
+
+func subscribeTopics(conn *wsconn.Conn, topics []exchange.Topic) error {
+	type subscribeParam struct {
+		Channel string `json:"channel"`
+	}
+	for _, topic := range topics {
+		channels := []string{}
+		switch topic.Channel {
+		case exchange.ExecutionsChannel:
+			channels = append(channels, "lightning_executions_"+topic.Symbol)
+		case exchange.BoardChannel:
+			channels = append(channels, "lightning_board_snapshot_"+topic.Symbol, "lightning_board_"+topic.Symbol)
+		case exchange.TickerChannel:
+			channels = append(channels, "lightning_ticker_"+topic.Symbol)
+		default:
+			return fmt.Errorf("channel %s not supported.", topic.Channel)
+		}
+		for _, channel := range channels {
+			err := conn.WriteJSON(rpcReq{
+				Version: "2.0",
+				Method:  "subscribe",
+				Params:  subscribeParam{Channel: channel},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ps *publicStream) handle(books map[string]*board.Book, msg []byte) {
+	type Res struct {
+		Method string `json:"method"`
+		Params struct {
+			Channel string          `json:"channel"`
+			Message json.RawMessage `json:"message"`
+		} `json:"params"`
+	}
+	resData := Res{}
+	if err := json.Unmarshal(msg, &resData); err != nil || resData.Method != "channelMessage" {
+		return
+	}
+
+	channel := resData.Params.Channel
+	switch {
+	case strings.HasPrefix(channel, "lightning_executions_"):
+		ps.handleExecutions(strings.TrimPrefix(channel, "lightning_executions_"), resData.Params.Message)
+	case strings.HasPrefix(channel, "lightning_board_snapshot_"):
+		ps.handleBoard(books, strings.TrimPrefix(channel, "lightning_board_snapshot_"), resData.Params.Message, true)
+	case strings.HasPrefix(channel, "lightning_board_"):
+		ps.handleBoard(books, strings.TrimPrefix(channel, "lightning_board_"), resData.Params.Message, false)
+	case strings.HasPrefix(channel, "lightning_ticker_"):
+		ps.handleTicker(strings.TrimPrefix(channel, "lightning_ticker_"), resData.Params.Message)
+	}
+}
+
+func (ps *publicStream) handleExecutions(symbol string, msg []byte) {
+	type Res []struct {
+		ID       int64   `json:"id"`
+		Side     string  `json:"side"`
+		Price    float64 `json:"price"`
+		Size     float64 `json:"size"`
+		ExecDate string  `json:"exec_date"`
+	}
+	resData := Res{}
+	json.Unmarshal(msg, &resData)
+
+	for _, data := range resData {
+		occuredAt, _ := time.Parse(time.RFC3339Nano, data.ExecDate)
+		ps.queue.Push(exchange.Message{
+			Topic: exchange.Topic{Channel: exchange.ExecutionsChannel, Symbol: symbol},
+			Execution: &execution.Execution{
+				ID: id.NewID(ps.name, symbol, fmt.Sprint(data.ID)),
+				Norm: base.Norm{
+					Price: data.Price,
+					Size:  data.Size,
+				},
+				IsBuy:     data.Side == "BUY",
+				OccuredAt: occuredAt,
+			},
+		})
+	}
+}
+
+func (ps *publicStream) handleBoard(books map[string]*board.Book, symbol string, msg []byte, isSnapshot bool) {
+	type level struct {
+		Price float64 `json:"price"`
+		Size  float64 `json:"size"`
+	}
+	type Res struct {
+		MidPrice float64 `json:"mid_price"`
+		Bids     []level `json:"bids"`
+		Asks     []level `json:"asks"`
+	}
+	resData := Res{}
+	json.Unmarshal(msg, &resData)
+
+	book, exist := books[symbol]
+	// スナップショットの前の差分は板の一部しかないので捨てる
+	if !exist && !isSnapshot {
+		return
+	}
+	if !exist {
+		book = board.NewBook()
+		books[symbol] = book
+	}
+	if isSnapshot {
+		book.Reset(nil, nil)
+	}
+	for _, v := range resData.Asks {
+		book.Update(true, v.Price, v.Size)
+	}
+	for _, v := range resData.Bids {
+		book.Update(false, v.Price, v.Size)
+	}
+
+	b := book.Board(ps.name, symbol, 0)
+	if resData.MidPrice != 0 {
+		b.MidPrice = resData.MidPrice
+	}
+	ps.queue.Push(exchange.Message{
+		Topic: exchange.Topic{Channel: exchange.BoardChannel, Symbol: symbol},
+		Board: &b,
+	})
+}
+
+func (ps *publicStream) handleTicker(symbol string, msg []byte) {
+	type Res struct {
+		Timestamp   string  `json:"timestamp"`
+		BestBid     float64 `json:"best_bid"`
+		BestAsk     float64 `json:"best_ask"`
+		BestBidSize float64 `json:"best_bid_size"`
+		BestAskSize float64 `json:"best_ask_size"`
+		Ltp         float64 `json:"ltp"`
+		Volume      float64 `json:"volume"`
+	}
+	data := Res{}
+	json.Unmarshal(msg, &data)
+
+	occuredAt, _ := time.Parse(time.RFC3339Nano, data.Timestamp)
+	ps.queue.Push(exchange.Message{
+		Topic: exchange.Topic{Channel: exchange.TickerChannel, Symbol: symbol},
+		Ticker: &ticker.Ticker{
+			ExchangeName: ps.name,
+			Symbol:       symbol,
+			BestBid:      data.BestBid,
+			BestAsk:      data.BestAsk,
+			BestBidSize:  data.BestBidSize,
+			BestAskSize:  data.BestAskSize,
+			LTP:          data.Ltp,
+			Volume:       data.Volume,
+			OccuredAt:    occuredAt,
+		},
+	})
+}
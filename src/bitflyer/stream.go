@@ -0,0 +1,341 @@
+package bitflyer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/sign"
+	"github.com/TTRSQ/ccew/util/wsconn"
+)
+
+type privateStream struct {
+	name     string
+	endpoint string
+	key      sign.Key
+	proxyURL *url.URL
+
+	mu    sync.Mutex
+	conn  *wsconn.Conn
+	queue *wsconn.Queue
+}
+
+// NewPrivateStream return stream of child_order_events and parent_order_events.
+func NewPrivateStream(key exchange.Key) (exchange.PrivateStream, error) {
+	ps := privateStream{}
+	ps.name = "bitflyer"
+	ps.endpoint = "wss://ws.lightstream.bitflyer.com/json-rpc"
+
+	k, err := sign.KeyOf(key)
+	if err != nil {
+		return nil, err
+	}
+	ps.key = k
+
+	if key.SpecificParam["proxyURL"] != nil {
+		ps.proxyURL = key.SpecificParam["proxyURL"].(*url.URL)
+	}
+	ps.queue = &wsconn.Queue{}
+
+	return &ps, nil
+}
+
+func (ps *privateStream) Start() error {
+	conn, err := wsconn.Dial(ps.endpoint, ps.proxyURL)
+	if err != nil {
+		return err
+	}
+
+	// 認証
+	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+	nonceByte := make([]byte, 16)
+	rand.Read(nonceByte)
+	nonce := hex.EncodeToString(nonceByte)
+	mac, err := ps.key.HMAC([]byte(fmt.Sprint(timestamp) + nonce))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	type authParam struct {
+		APIKey    string `json:"api_key"`
+		Timestamp int64  `json:"timestamp"`
+		Nonce     string `json:"nonce"`
+		Signature string `json:"signature"`
+	}
+	err = conn.WriteJSON(rpcReq{
+		Version: "2.0",
+		Method:  "auth",
+		ID:      1,
+		Params: authParam{
+			APIKey:    ps.key.ID(),
+			Timestamp: timestamp,
+			Nonce:     nonce,
+			Signature: hex.EncodeToString(mac),
+		},
+	})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	type authRes struct {
+		ID     int  `json:"id"`
+		Result bool `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	res := authRes{}
+	if err := conn.ReadJSON(&res, 10*time.Second); err != nil {
+		conn.Close()
+		return err
+	}
+	if !res.Result {
+		conn.Close()
+		if res.Error != nil {
+			return fmt.Errorf("auth failed: %s", res.Error.Message)
+		}
+		return errors.New("auth failed.")
+	}
+
+	// 購読
+	type subscribeParam struct {
+		Channel string `json:"channel"`
+	}
+	for i, channel := range []string{"child_order_events", "parent_order_events"} {
+		err := conn.WriteJSON(rpcReq{
+			Version: "2.0",
+			Method:  "subscribe",
+			ID:      i + 2,
+			Params:  subscribeParam{Channel: channel},
+		})
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	// 再接続時は前の接続を閉じてから差し替える
+	if ps.conn != nil {
+		ps.conn.Close()
+	}
+	ps.conn = conn
+	conn.WakeOnClose(ps.queue)
+	conn.Listen(ps.handle)
+	return nil
+}
+
+func (ps *privateStream) Close() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return nil
+	}
+	err := ps.conn.Close()
+	ps.conn = nil
+	return err
+}
+
+// Ready receive when Read may return a message or the error of the connection.
+func (ps *privateStream) Ready() <-chan struct{} {
+	return ps.queue.Ready()
+}
+
+func (ps *privateStream) Read() (*orderevent.Event, error) {
+	if v := ps.queue.Pop(); v != nil {
+		ev := v.(orderevent.Event)
+		return &ev, nil
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return nil, errors.New("stream is not started.")
+	}
+	return nil, ps.conn.Err()
+}
+
+func (ps *privateStream) Ping() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return errors.New("stream is not started.")
+	}
+	return ps.conn.Ping()
+}
+
+func (ps *privateStream) LastReceived() time.Time {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return time.Time{}
+	}
+	return ps.conn.LastReceived()
+}
+
+type rpcReq struct {
+	Version string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+	ID      int         `json:"id,omitempty"`
+}
+
+func (ps *privateStream) handle(msg []byte) {
+	type Res struct {
+		Method string `json:"method"`
+		Params struct {
+			Channel string          `json:"channel"`
+			Message json.RawMessage `json:"message"`
+		} `json:"params"`
+	}
+	resData := Res{}
+	if err := json.Unmarshal(msg, &resData); err != nil || resData.Method != "channelMessage" {
+		return
+	}
+
+	switch resData.Params.Channel {
+	case "child_order_events":
+		ps.handleChildOrderEvents(resData.Params.Message)
+	case "parent_order_events":
+		ps.handleParentOrderEvents(resData.Params.Message)
+	}
+}
+
+func (ps *privateStream) handleChildOrderEvents(msg []byte) {
+	type Res []struct {
+		ProductCode            string  `json:"product_code"`
+		ChildOrderID           string  `json:"child_order_id"`
+		ChildOrderAcceptanceID string  `json:"child_order_acceptance_id"`
+		EventDate              string  `json:"event_date"`
+		EventType              string  `json:"event_type"`
+		ChildOrderType         string  `json:"child_order_type"`
+		Side                   string  `json:"side"`
+		Price                  float64 `json:"price"`
+		Size                   float64 `json:"size"`
+		ExpireDate             string  `json:"expire_date"`
+		Reason                 string  `json:"reason"`
+		ExecID                 int64   `json:"exec_id"`
+		Commission             float64 `json:"commission"`
+		Sfd                    float64 `json:"sfd"`
+		OutstandingSize        float64 `json:"outstanding_size"`
+	}
+	resData := Res{}
+	json.Unmarshal(msg, &resData)
+
+	for _, data := range resData {
+		occuredAt, _ := time.Parse(time.RFC3339Nano, data.EventDate)
+		ev := orderevent.Event{
+			ID:        id.NewID(ps.name, data.ProductCode, data.ChildOrderAcceptanceID),
+			IsBuy:     data.Side == "BUY",
+			OrderType: data.ChildOrderType,
+			Norm: base.Norm{
+				Price: data.Price,
+				Size:  data.Size,
+			},
+			OccuredAt: occuredAt,
+		}
+
+		switch data.EventType {
+		case "ORDER":
+			ev.Type = orderevent.Accepted
+			ev.RemainingSize = data.Size
+		case "ORDER_FAILED":
+			ev.Type = orderevent.Rejected
+			ev.Reason = data.Reason
+		case "CANCEL":
+			ev.Type = orderevent.Canceled
+		case "CANCEL_FAILED":
+			ev.Type = orderevent.CancelRejected
+		case "EXPIRE":
+			ev.Type = orderevent.Expired
+		case "EXECUTION":
+			// 約定イベントのprice, sizeは約定した値
+			ev.Type = orderevent.PartiallyFilled
+			if data.OutstandingSize == 0 {
+				ev.Type = orderevent.Filled
+			}
+			ev.Norm = base.Norm{}
+			ev.RemainingSize = data.OutstandingSize
+			ev.Fill = &orderevent.Fill{
+				ExecutionID: fmt.Sprint(data.ExecID),
+				Norm: base.Norm{
+					Price: data.Price,
+					Size:  data.Size,
+				},
+				// commissionは基軸通貨建て. sfdは別途精算されるため手数料には含めない
+				Fee:         data.Commission,
+				FeeCurrency: baseCurrency(data.ProductCode),
+			}
+		default:
+			continue
+		}
+		ps.queue.Push(ev)
+	}
+}
+
+func (ps *privateStream) handleParentOrderEvents(msg []byte) {
+	type Res []struct {
+		ProductCode             string  `json:"product_code"`
+		ParentOrderID           string  `json:"parent_order_id"`
+		ParentOrderAcceptanceID string  `json:"parent_order_acceptance_id"`
+		EventDate               string  `json:"event_date"`
+		EventType               string  `json:"event_type"`
+		ParentOrderType         string  `json:"parent_order_type"`
+		ChildOrderType          string  `json:"child_order_type"`
+		Side                    string  `json:"side"`
+		Price                   float64 `json:"price"`
+		Size                    float64 `json:"size"`
+		Reason                  string  `json:"reason"`
+	}
+	resData := Res{}
+	json.Unmarshal(msg, &resData)
+
+	for _, data := range resData {
+		occuredAt, _ := time.Parse(time.RFC3339Nano, data.EventDate)
+		ev := orderevent.Event{
+			ID:        id.NewID(ps.name, data.ProductCode, data.ParentOrderAcceptanceID),
+			IsBuy:     data.Side == "BUY",
+			OrderType: data.ParentOrderType,
+			Norm: base.Norm{
+				Price: data.Price,
+				Size:  data.Size,
+			},
+			OccuredAt: occuredAt,
+		}
+
+		// 約定は子注文のイベントで通知されるので, 親注文は状態の変化のみ流す
+		switch data.EventType {
+		case "ORDER":
+			ev.Type = orderevent.Accepted
+		case "ORDER_FAILED":
+			ev.Type = orderevent.Rejected
+			ev.Reason = data.Reason
+		case "CANCEL":
+			ev.Type = orderevent.Canceled
+		case "COMPLETE":
+			ev.Type = orderevent.Filled
+		case "EXPIRE":
+			ev.Type = orderevent.Expired
+		default:
+			continue
+		}
+		ps.queue.Push(ev)
+	}
+}
+
+// BTC_JPY, FX_BTC_JPY => BTC
+func baseCurrency(productCode string) string {
+	return strings.Split(strings.TrimPrefix(productCode, "FX_"), "_")[0]
+}
@@ -0,0 +1,117 @@
+package bitflyer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/wsconn"
+	"github.com/gorilla/websocket"
+)
+
+func TestHandleChildOrderEvents(t *testing.T) {
+	ps := privateStream{name: "bitflyer", queue: &wsconn.Queue{}}
+	ps.handle([]byte(`{"jsonrpc":"2.0","method":"channelMessage","params":{"channel":"child_order_events","message":[
+		{"product_code":"FX_BTC_JPY","child_order_acceptance_id":"JRF1","event_date":"2021-01-01T00:00:00.123Z","event_type":"ORDER","child_order_type":"LIMIT","side":"BUY","price":3000000,"size":0.02},
+		{"product_code":"FX_BTC_JPY","child_order_acceptance_id":"JRF1","event_date":"2021-01-01T00:00:01Z","event_type":"EXECUTION","exec_id":10,"side":"BUY","price":3000000,"size":0.01,"commission":0,"outstanding_size":0.01},
+		{"product_code":"FX_BTC_JPY","child_order_acceptance_id":"JRF1","event_date":"2021-01-01T00:00:02Z","event_type":"EXECUTION","exec_id":11,"side":"BUY","price":3000000,"size":0.01,"commission":0,"outstanding_size":0}
+	]}}`))
+
+	want := []orderevent.Type{orderevent.Accepted, orderevent.PartiallyFilled, orderevent.Filled}
+	for i, typ := range want {
+		ev := ps.queue.Pop()
+		if ev == nil {
+			t.Fatalf("event %d not found", i)
+		}
+		got := ev.(orderevent.Event)
+		if got.Type != typ {
+			t.Errorf("event %d: %s != %s", i, got.Type, typ)
+		}
+		if got.ID.LocalID != "JRF1" {
+			t.Errorf("event %d: LocalID %s", i, got.ID.LocalID)
+		}
+		if typ != orderevent.Accepted && (got.Fill == nil || got.Fill.Size != 0.01) {
+			t.Errorf("event %d: fill %+v", i, got.Fill)
+		}
+	}
+	if ps.queue.Pop() != nil {
+		t.Error("unexpected event")
+	}
+}
+
+func TestHandleBoardBeforeSnapshot(t *testing.T) {
+	ps := publicStream{name: "bitflyer", queue: &wsconn.Queue{}}
+	books := map[string]*board.Book{}
+
+	// スナップショットの前の差分は捨てる
+	ps.handle(books, []byte(`{"jsonrpc":"2.0","method":"channelMessage","params":{"channel":"lightning_board_FX_BTC_JPY","message":
+		{"mid_price":3000000,"bids":[{"price":2999000,"size":1}],"asks":[]}}}`))
+	if v := ps.queue.Pop(); v != nil {
+		t.Fatalf("diff before snapshot %+v", v)
+	}
+
+	ps.handle(books, []byte(`{"jsonrpc":"2.0","method":"channelMessage","params":{"channel":"lightning_board_snapshot_FX_BTC_JPY","message":
+		{"mid_price":3000000,"bids":[{"price":2999000,"size":2},{"price":2998000,"size":1}],"asks":[{"price":3001000,"size":1}]}}}`))
+	ps.handle(books, []byte(`{"jsonrpc":"2.0","method":"channelMessage","params":{"channel":"lightning_board_FX_BTC_JPY","message":
+		{"mid_price":3000000,"bids":[{"price":2999000,"size":0}],"asks":[]}}}`))
+	ps.queue.Pop()
+	v := ps.queue.Pop()
+	if v == nil {
+		t.Fatal("diff after snapshot not found")
+	}
+	b := v.(exchange.Message).Board
+	if len(b.Bids) != 1 || b.Bids[0].Price != 2998000 || len(b.Asks) != 1 {
+		t.Fatalf("board %+v", b)
+	}
+}
+
+func TestPrivateStreamRestart(t *testing.T) {
+	// 認証に成功し, 接続が閉じられたらclosedに通知する
+	closed := make(chan struct{}, 2)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"result":true}`))
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				closed <- struct{}{}
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	s, _ := NewPrivateStream(exchange.Key{APIKey: "key", APISecKey: "secret"})
+	ps := s.(*privateStream)
+	ps.endpoint = "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	// 再接続で前の接続は閉じられる
+	if err := ps.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Start(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("previous connection not closed")
+	}
+
+	// Close後は古い接続のエラーではなく未接続になる
+	if err := ps.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ps.Read(); err == nil || err.Error() != "stream is not started." {
+		t.Fatal(err)
+	}
+}
@@ -2,14 +2,9 @@ package bybit
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
 	"math"
 	"net/http"
 	"net/url"
@@ -20,17 +15,21 @@ import (
 
 	"github.com/TTRSQ/ccew/domains/base"
 	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
 	"github.com/TTRSQ/ccew/domains/order"
 	"github.com/TTRSQ/ccew/domains/order/id"
 	"github.com/TTRSQ/ccew/domains/stock"
 	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/httpx"
+	"github.com/TTRSQ/ccew/util/ratelimit"
+	"github.com/TTRSQ/ccew/util/retry"
+	"github.com/TTRSQ/ccew/util/sign"
 )
 
 type bybit struct {
-	name       string
-	host       string
-	key        exchange.Key
-	httpClient *http.Client
+	name   string
+	host   string
+	client *httpx.Client
 }
 
 // New return exchange obj.
@@ -39,15 +38,19 @@ func New(key exchange.Key) (exchange.Exchange, error) {
 	bb.name = "bybit"
 	bb.host = "api.bybit.com"
 
-	if key.APIKey == "" || key.APISecKey == "" {
-		return nil, errors.New("APIKey and APISecKey Required")
+	// additional_keys 複数のキーを順番に使う
+	keys, err := sign.PoolOf(key)
+	if err != nil {
+		return nil, err
 	}
-	bb.key = key
+	keys.Reject = sign.BybitRejected
 
-	bb.httpClient = new(http.Client)
-	if key.SpecificParam["timeoutMS"] != nil {
-		bb.httpClient.Timeout = time.Duration(key.SpecificParam["timeoutMS"].(int)) * time.Millisecond
-	}
+	bb.client = httpx.New(key, httpx.Options{
+		Name:        bb.name,
+		RateLimiter: ratelimit.New(ratelimit.Bybit()),
+		Retry:       retry.Bybit(),
+		Signer:      sign.Bybit(keys),
+	})
 
 	return &bb, nil
 }
@@ -71,8 +74,11 @@ func (bb *bybit) CreateOrder(price, size float64, isBuy bool, symbol, orderType
 		Qty         float64 `json:"qty"`
 		Price       float64 `json:"price"`
 		TimeInForce string  `json:"time_in_force"`
+		OrderLinkID string  `json:"order_link_id"`
 	}
 
+	// order_link_idがあると再送しても二重に発注されない
+	linkID := retry.NewClientOrderID()
 	res, err := bb.postRequest("/v2/private/order/create", structToMap(&Req{
 		Symbol:      symbol,
 		OrderType:   orderType,
@@ -80,8 +86,13 @@ func (bb *bybit) CreateOrder(price, size float64, isBuy bool, symbol, orderType
 		Price:       map[bool]float64{true: price, false: 0}[orderType == bb.OrderTypes().Limit],
 		Qty:         size,
 		TimeInForce: "GoodTillCancel",
+		OrderLinkID: linkID,
 	}))
 
+	// 応答が失われた試行で発注済みなら再送は重複で拒否される. 発注済みの注文を返す
+	if err != nil && retry.BybitDuplicate(res) {
+		return bb.orderByLinkID(symbol, linkID)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -128,6 +139,36 @@ func (bb *bybit) CreateOrder(price, size float64, isBuy bool, symbol, orderType
 	}, nil
 }
 
+// orderByLinkID the order placed with order_link_id linkID.
+func (bb *bybit) orderByLinkID(symbol, linkID string) (*order.Responce, error) {
+	type Req struct {
+		Symbol      string `json:"symbol"`
+		OrderLinkID string `json:"order_link_id"`
+	}
+	res, err := bb.getRequest("/v2/private/order", structToMap(&Req{
+		Symbol:      symbol,
+		OrderLinkID: linkID,
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	type Res struct {
+		Result struct {
+			OrderID     string  `json:"order_id"`
+			CumExecQty  float64 `json:"cum_exec_qty"`
+			OrderLinkID string  `json:"order_link_id"`
+		} `json:"result"`
+	}
+	resData := Res{}
+	json.Unmarshal(res, &resData)
+
+	return &order.Responce{
+		ID:         id.NewID(bb.name, symbol, resData.Result.OrderID),
+		FilledSize: resData.Result.CumExecQty,
+	}, nil
+}
+
 func (bb *bybit) LiquidationOrder(price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error) {
 	return nil, errors.New("LiquidationOrder not supported.")
 }
@@ -490,17 +531,58 @@ func (bb *bybit) Boards(symbol string) (board.Board, error) {
 	}, nil
 }
 
+func (bb *bybit) Executions(symbol string) ([]execution.Execution, error) {
+	type Req struct {
+		Symbol string `json:"symbol"`
+	}
+	res, err := bb.getRequest("/v2/public/trading-records", structToMap(&Req{
+		Symbol: symbol,
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	// レスポンスの変換
+	type Res struct {
+		RetCode int    `json:"ret_code"`
+		RetMsg  string `json:"ret_msg"`
+		Result  []struct {
+			ID    int64     `json:"id"`
+			Price float64   `json:"price"`
+			Qty   float64   `json:"qty"`
+			Side  string    `json:"side"`
+			Time  time.Time `json:"time"`
+		} `json:"result"`
+	}
+	resData := Res{}
+	json.Unmarshal(res, &resData)
+	if resData.RetCode != 0 {
+		return nil, errors.New(resData.RetMsg)
+	}
+
+	// 返却値の作成
+	ret := []execution.Execution{}
+	for _, data := range resData.Result {
+		ret = append(ret, execution.Execution{
+			ID: id.NewID(bb.name, symbol, fmt.Sprint(data.ID)),
+			Norm: base.Norm{
+				Price: data.Price,
+				Size:  data.Qty,
+			},
+			IsBuy:     data.Side == "Buy",
+			OccuredAt: data.Time,
+		})
+	}
+
+	return ret, nil
+}
+
 func (bb *bybit) InScheduledMaintenance() bool {
 	// TODO
 	return false
 }
 
 func (bb *bybit) postRequest(path string, param map[string]string) ([]byte, error) {
-	param["api_key"] = bb.key.APIKey
-	param["timestamp"] = fmt.Sprint(time.Now().UnixNano() / 1000000)
-	sign := getSignature(param, bb.key.APISecKey)
-	param["sign"] = sign
-
 	url := url.URL{Scheme: "https", Host: bb.host, Path: path}
 	jsonParam, _ := json.Marshal(param)
 	req, _ := http.NewRequest(
@@ -514,29 +596,19 @@ func (bb *bybit) postRequest(path string, param map[string]string) ([]byte, erro
 }
 
 func (bb *bybit) getRequest(path string, param map[string]string) ([]byte, error) {
-	param["api_key"] = bb.key.APIKey
-	param["timestamp"] = fmt.Sprint(time.Now().UnixNano() / 1000000)
-	sign := getSignature(param, bb.key.APISecKey)
-	queryStr := getQuery(param) + "&sign=" + sign
-
 	url := url.URL{Scheme: "https", Host: bb.host, Path: path}
+	if len(param) > 0 {
+		url.RawQuery = getQuery(param)
+	}
 	req, _ := http.NewRequest(
 		"GET",
-		url.String()+"?"+queryStr,
-		nil, //bytes.NewBuffer([]byte(queryStr)),
+		url.String(),
+		nil,
 	)
 
 	return bb.request(req)
 }
 
-func getSignature(params map[string]string, key string) string {
-	_val := getQuery(params)
-	h := hmac.New(sha256.New, []byte(key))
-	io.WriteString(h, _val)
-
-	return fmt.Sprintf("%x", h.Sum(nil))
-}
-
 func getQuery(params map[string]string) string {
 	keys := make([]string, len(params))
 	i := 0
@@ -566,24 +638,9 @@ func structToMap(data interface{}) map[string]string {
 }
 
 func (bb *bybit) request(req *http.Request) ([]byte, error) {
-	resp, err := bb.httpClient.Do(req)
-
+	body, err := bb.client.Do(req)
 	if err != nil {
-		errStr := fmt.Sprintf("err ==> %+v\nreq ==> %v\n", err, req)
-		return nil, errors.New(errStr)
-	}
-	if resp.StatusCode/100 != 2 {
-		body, _ := ioutil.ReadAll(resp.Body)
-		errStr := fmt.Sprintf("code:%d\n", resp.StatusCode)
-		errStr += fmt.Sprintf("body ==> %s\n", string(body))
-		errStr += fmt.Sprintf("resp ==> %+v\nreq ==> %v\n", resp, req)
-		return nil, errors.New(errStr)
-	}
-
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	type errCheck struct {
@@ -599,7 +656,8 @@ func (bb *bybit) request(req *http.Request) ([]byte, error) {
 		if err != nil {
 			msg = err.Error()
 		}
-		return nil, errors.New(msg)
+		// 本文はエラーの判別に使う
+		return body, errors.New(msg)
 	}
 
 	return body, err
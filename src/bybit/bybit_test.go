@@ -0,0 +1,58 @@
+package bybit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/httpx/httpxtest"
+	"github.com/TTRSQ/ccew/util/retry"
+)
+
+func TestCreateOrderRetry(t *testing.T) {
+	// 1回目は発注されたが応答が失われ, 再送は重複で拒否される
+	links := []string{}
+	transport := httpxtest.Transport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			if r.URL.Path != "/v2/private/order" || r.URL.Query().Get("order_link_id") != links[0] {
+				t.Errorf("lookup %s", r.URL)
+			}
+			w.Write([]byte(`{"ret_code":0,"result":{"order_id":"abc","cum_exec_qty":1,"order_link_id":"` + links[0] + `"}}`))
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		param := map[string]string{}
+		json.Unmarshal(body, &param)
+		links = append(links, param["order_link_id"])
+		if len(links) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"ret_code":30001,"ret_msg":"order_link_id is repeated","result":null}`))
+	}))
+	policy := retry.Bybit()
+	policy.BaseDelay = time.Millisecond
+	bb, err := New(exchange.Key{APIKey: "key", APISecKey: "secret", SpecificParam: map[string]interface{}{
+		"transport": transport,
+		"retry":     policy,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := bb.CreateOrder(10000, 2, true, "BTCUSD", "Limit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 再送は同じorder_link_idで送る
+	if len(links) != 2 || links[0] == "" || links[0] != links[1] {
+		t.Fatal(links)
+	}
+	// 発注済みの注文を返す
+	if res.ID.LocalID != "abc" || res.FilledSize != 1 {
+		t.Fatalf("%+v", res)
+	}
+}
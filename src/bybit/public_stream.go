@@ -0,0 +1,343 @@
+package bybit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/ticker"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/wsconn"
+)
+
+type publicStream struct {
+	name     string
+	endpoint string
+	proxyURL *url.URL
+
+	mu     sync.Mutex
+	conn   *wsconn.Conn
+	topics []exchange.Topic
+	queue  *wsconn.Queue
+}
+
+// NewPublicStream return stream of trade, orderBookL2_25 and instrument_info topics.
+func NewPublicStream(key exchange.Key) (exchange.PublicStream, error) {
+	ps := publicStream{}
+	ps.name = "bybit"
+	ps.endpoint = "wss://stream.bybit.com/realtime"
+	if key.SpecificParam["proxyURL"] != nil {
+		ps.proxyURL = key.SpecificParam["proxyURL"].(*url.URL)
+	}
+	ps.queue = &wsconn.Queue{}
+
+	return &ps, nil
+}
+
+func (ps *publicStream) Subscribe(topics ...exchange.Topic) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.topics = append(ps.topics, topics...)
+	if ps.conn == nil {
+		return nil
+	}
+	return subscribeTopics(ps.conn, topics)
+}
+
+func (ps *publicStream) Start() error {
+	conn, err := wsconn.Dial(ps.endpoint, ps.proxyURL)
+	if err != nil {
+		return err
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if err := subscribeTopics(conn, ps.topics); err != nil {
+		conn.Close()
+		return err
+	}
+	// 板とtickerは差分で届くので接続ごとに作り直す
+	state := newPublicState()
+	ps.conn = conn
+	conn.WakeOnClose(ps.queue)
+	conn.Listen(func(msg []byte) {
+		ps.handle(state, msg)
+	})
+	return nil
+}
+
+func (ps *publicStream) Close() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return nil
+	}
+	err := ps.conn.Close()
+	ps.conn = nil
+	return err
+}
+
+// Ready receive when Read may return a message or the error of the connection.
+func (ps *publicStream) Ready() <-chan struct{} {
+	return ps.queue.Ready()
+}
+
+func (ps *publicStream) Read() (*exchange.Message, error) {
+	if v := ps.queue.Pop(); v != nil {
+		msg := v.(exchange.Message)
+		return &msg, nil
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return nil, errors.New("stream is not started.")
+	}
+	return nil, ps.conn.Err()
+}
+
+func (ps *publicStream) Ping() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return errors.New("stream is not started.")
+	}
+	return ps.conn.WriteJSON(wsReq{Op: "ping"})
+}
+
+func (ps *publicStream) LastReceived() time.Time {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return time.Time{}
+	}
+	return ps.conn.LastReceived()
+}
+
+func subscribeTopics(conn *wsconn.Conn, topics []exchange.Topic) error {
+	if len(topics) == 0 {
+		return nil
+	}
+	args := []interface{}{}
+	for _, topic := range topics {
+		switch topic.Channel {
+		case exchange.ExecutionsChannel:
+			args = append(args, "trade."+topic.Symbol)
+		case exchange.BoardChannel:
+			args = append(args, "orderBookL2_25."+topic.Symbol)
+		case exchange.TickerChannel:
+			args = append(args, "instrument_info.100ms."+topic.Symbol)
+		default:
+			return fmt.Errorf("channel %s not supported.", topic.Channel)
+		}
+	}
+	return conn.WriteJSON(wsReq{Op: "subscribe", Args: args})
+}
+
+type publicState struct {
+	books map[string]*board.Book
+	// orderBookL2の削除はidのみで届くため価格を覚えておく
+	prices  map[string]map[int64]float64
+	tickers map[string]*ticker.Ticker
+}
+
+func newPublicState() *publicState {
+	return &publicState{
+		books:   map[string]*board.Book{},
+		prices:  map[string]map[int64]float64{},
+		tickers: map[string]*ticker.Ticker{},
+	}
+}
+
+func (ps *publicStream) handle(state *publicState, msg []byte) {
+	type Res struct {
+		Topic string `json:"topic"`
+		Type  string `json:"type"`
+	}
+	resData := Res{}
+	if err := json.Unmarshal(msg, &resData); err != nil {
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(resData.Topic, "trade."):
+		ps.handleTrade(strings.TrimPrefix(resData.Topic, "trade."), msg)
+	case strings.HasPrefix(resData.Topic, "orderBookL2_25."):
+		ps.handleOrderBook(state, strings.TrimPrefix(resData.Topic, "orderBookL2_25."), resData.Type, msg)
+	case strings.HasPrefix(resData.Topic, "instrument_info.100ms."):
+		ps.handleInstrumentInfo(state, strings.TrimPrefix(resData.Topic, "instrument_info.100ms."), resData.Type, msg)
+	}
+}
+
+func (ps *publicStream) handleTrade(symbol string, msg []byte) {
+	type Res struct {
+		Data []struct {
+			TradeTimeMs int64   `json:"trade_time_ms"`
+			Side        string  `json:"side"`
+			Size        float64 `json:"size"`
+			Price       float64 `json:"price"`
+			TradeID     string  `json:"trade_id"`
+		} `json:"data"`
+	}
+	resData := Res{}
+	json.Unmarshal(msg, &resData)
+
+	for _, data := range resData.Data {
+		ps.queue.Push(exchange.Message{
+			Topic: exchange.Topic{Channel: exchange.ExecutionsChannel, Symbol: symbol},
+			Execution: &execution.Execution{
+				ID: id.NewID(ps.name, symbol, data.TradeID),
+				Norm: base.Norm{
+					Price: data.Price,
+					Size:  data.Size,
+				},
+				IsBuy:     data.Side == "Buy",
+				OccuredAt: time.Unix(0, data.TradeTimeMs*int64(time.Millisecond)),
+			},
+		})
+	}
+}
+
+type bookLevel struct {
+	Price string  `json:"price"`
+	ID    int64   `json:"id"`
+	Side  string  `json:"side"`
+	Size  float64 `json:"size"`
+}
+
+func (ps *publicStream) handleOrderBook(state *publicState, symbol, typ string, msg []byte) {
+	book, exist := state.books[symbol]
+	if !exist {
+		book = board.NewBook()
+		state.books[symbol] = book
+	}
+	prices, exist := state.prices[symbol]
+	if !exist {
+		prices = map[int64]float64{}
+		state.prices[symbol] = prices
+	}
+	update := func(levels []bookLevel, remove bool) {
+		for _, v := range levels {
+			price, err := strconv.ParseFloat(v.Price, 64)
+			if err != nil {
+				price = prices[v.ID]
+			}
+			prices[v.ID] = price
+			size := v.Size
+			if remove {
+				size = 0
+				delete(prices, v.ID)
+			}
+			book.Update(v.Side == "Sell", price, size)
+		}
+	}
+
+	if typ == "snapshot" {
+		type Res struct {
+			Data []bookLevel `json:"data"`
+		}
+		resData := Res{}
+		json.Unmarshal(msg, &resData)
+		book.Reset(nil, nil)
+		for k := range prices {
+			delete(prices, k)
+		}
+		update(resData.Data, false)
+	} else {
+		type Res struct {
+			Data struct {
+				Delete []bookLevel `json:"delete"`
+				Update []bookLevel `json:"update"`
+				Insert []bookLevel `json:"insert"`
+			} `json:"data"`
+		}
+		resData := Res{}
+		json.Unmarshal(msg, &resData)
+		update(resData.Data.Delete, true)
+		update(resData.Data.Update, false)
+		update(resData.Data.Insert, false)
+	}
+
+	b := book.Board(ps.name, symbol, 0)
+	ps.queue.Push(exchange.Message{
+		Topic: exchange.Topic{Channel: exchange.BoardChannel, Symbol: symbol},
+		Board: &b,
+	})
+}
+
+// instrumentInfo 差分では変化した項目のみ届く
+type instrumentInfo struct {
+	LastPriceE4 json.RawMessage `json:"last_price_e4"`
+	Bid1PriceE4 json.RawMessage `json:"bid1_price_e4"`
+	Ask1PriceE4 json.RawMessage `json:"ask1_price_e4"`
+	Volume24h   json.RawMessage `json:"volume_24h"`
+	UpdatedAt   string          `json:"updated_at"`
+}
+
+func (ps *publicStream) handleInstrumentInfo(state *publicState, symbol, typ string, msg []byte) {
+	infos := []instrumentInfo{}
+	if typ == "snapshot" {
+		type Res struct {
+			Data instrumentInfo `json:"data"`
+		}
+		resData := Res{}
+		json.Unmarshal(msg, &resData)
+		infos = append(infos, resData.Data)
+		state.tickers[symbol] = &ticker.Ticker{ExchangeName: ps.name, Symbol: symbol}
+	} else {
+		type Res struct {
+			Data struct {
+				Update []instrumentInfo `json:"update"`
+			} `json:"data"`
+		}
+		resData := Res{}
+		json.Unmarshal(msg, &resData)
+		infos = resData.Data.Update
+	}
+
+	t, exist := state.tickers[symbol]
+	if !exist {
+		// スナップショット前の差分は捨てる
+		return
+	}
+	for _, info := range infos {
+		if v, ok := parseRawNumber(info.LastPriceE4); ok {
+			t.LTP = v / 1e4
+		}
+		if v, ok := parseRawNumber(info.Bid1PriceE4); ok {
+			t.BestBid = v / 1e4
+		}
+		if v, ok := parseRawNumber(info.Ask1PriceE4); ok {
+			t.BestAsk = v / 1e4
+		}
+		if v, ok := parseRawNumber(info.Volume24h); ok {
+			t.Volume = v
+		}
+		if updatedAt, err := time.Parse(time.RFC3339Nano, info.UpdatedAt); err == nil {
+			t.OccuredAt = updatedAt
+		}
+	}
+
+	ret := *t
+	ps.queue.Push(exchange.Message{
+		Topic:  exchange.Topic{Channel: exchange.TickerChannel, Symbol: symbol},
+		Ticker: &ret,
+	})
+}
+
+// parseRawNumber 数値と文字列の両方の表現を受け付ける
+func parseRawNumber(raw json.RawMessage) (float64, bool) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.Trim(string(raw), `"`), 64)
+	return v, err == nil
+}
@@ -0,0 +1,291 @@
+package bybit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/domains/stock"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/sign"
+	"github.com/TTRSQ/ccew/util/wsconn"
+)
+
+type privateStream struct {
+	name     string
+	endpoint string
+	key      sign.Key
+	proxyURL *url.URL
+
+	conn  *wsconn.Conn
+	queue *wsconn.Queue
+}
+
+// NewPrivateStream return stream of order, execution and position topics.
+func NewPrivateStream(key exchange.Key) (exchange.PrivateStream, error) {
+	ps := privateStream{}
+	ps.name = "bybit"
+	ps.endpoint = "wss://stream.bybit.com/realtime"
+
+	k, err := sign.KeyOf(key)
+	if err != nil {
+		return nil, err
+	}
+	ps.key = k
+	if key.SpecificParam["proxyURL"] != nil {
+		ps.proxyURL = key.SpecificParam["proxyURL"].(*url.URL)
+	}
+	ps.queue = &wsconn.Queue{}
+
+	return &ps, nil
+}
+
+type wsReq struct {
+	Op   string        `json:"op"`
+	Args []interface{} `json:"args,omitempty"`
+}
+
+func (ps *privateStream) Start() error {
+	conn, err := wsconn.Dial(ps.endpoint, ps.proxyURL)
+	if err != nil {
+		return err
+	}
+
+	// 認証
+	expires := time.Now().Add(10*time.Second).UnixNano() / int64(time.Millisecond)
+	mac, err := ps.key.HMAC([]byte(fmt.Sprintf("GET/realtime%d", expires)))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	err = conn.WriteJSON(wsReq{
+		Op:   "auth",
+		Args: []interface{}{ps.key.ID(), expires, fmt.Sprintf("%x", mac)},
+	})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	type authRes struct {
+		Success bool   `json:"success"`
+		RetMsg  string `json:"ret_msg"`
+	}
+	res := authRes{}
+	if err := conn.ReadJSON(&res, 10*time.Second); err != nil {
+		conn.Close()
+		return err
+	}
+	if !res.Success {
+		conn.Close()
+		return fmt.Errorf("auth failed: %s", res.RetMsg)
+	}
+
+	// 購読
+	err = conn.WriteJSON(wsReq{
+		Op:   "subscribe",
+		Args: []interface{}{"order", "execution", "position"},
+	})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	ps.conn = conn
+	conn.WakeOnClose(ps.queue)
+	conn.Listen(ps.handle)
+	return nil
+}
+
+func (ps *privateStream) Close() error {
+	if ps.conn == nil {
+		return nil
+	}
+	return ps.conn.Close()
+}
+
+// Ready receive when Read may return a message or the error of the connection.
+func (ps *privateStream) Ready() <-chan struct{} {
+	return ps.queue.Ready()
+}
+
+func (ps *privateStream) Read() (*orderevent.Event, error) {
+	if v := ps.queue.Pop(); v != nil {
+		ev := v.(orderevent.Event)
+		return &ev, nil
+	}
+	if ps.conn == nil {
+		return nil, errors.New("stream is not started.")
+	}
+	return nil, ps.conn.Err()
+}
+
+// Ping bybitはop:pingを送らないと切断される
+func (ps *privateStream) Ping() error {
+	if ps.conn == nil {
+		return errors.New("stream is not started.")
+	}
+	return ps.conn.WriteJSON(wsReq{Op: "ping"})
+}
+
+func (ps *privateStream) LastReceived() time.Time {
+	if ps.conn == nil {
+		return time.Time{}
+	}
+	return ps.conn.LastReceived()
+}
+
+func (ps *privateStream) handle(msg []byte) {
+	type Res struct {
+		Topic string          `json:"topic"`
+		Data  json.RawMessage `json:"data"`
+	}
+	resData := Res{}
+	if err := json.Unmarshal(msg, &resData); err != nil {
+		return
+	}
+
+	switch resData.Topic {
+	case "order":
+		ps.handleOrder(resData.Data)
+	case "execution":
+		ps.handleExecution(resData.Data)
+	case "position":
+		ps.handlePosition(resData.Data)
+	}
+}
+
+func (ps *privateStream) handleOrder(msg []byte) {
+	type Res []struct {
+		OrderID     string    `json:"order_id"`
+		Symbol      string    `json:"symbol"`
+		Side        string    `json:"side"`
+		OrderType   string    `json:"order_type"`
+		Price       string    `json:"price"`
+		Qty         float64   `json:"qty"`
+		OrderStatus string    `json:"order_status"`
+		CancelType  string    `json:"cancel_type"`
+		LeavesQty   float64   `json:"leaves_qty"`
+		CumExecQty  float64   `json:"cum_exec_qty"`
+		Timestamp   time.Time `json:"timestamp"`
+	}
+	resData := Res{}
+	json.Unmarshal(msg, &resData)
+
+	for _, data := range resData {
+		price, _ := strconv.ParseFloat(data.Price, 64)
+		ev := orderevent.Event{
+			ID:        id.NewID(ps.name, data.Symbol, data.OrderID),
+			IsBuy:     data.Side == "Buy",
+			OrderType: data.OrderType,
+			Norm: base.Norm{
+				Price: price,
+				Size:  data.Qty,
+			},
+			ExecutedSize:  data.CumExecQty,
+			RemainingSize: data.LeavesQty,
+			OccuredAt:     data.Timestamp,
+		}
+
+		// 約定はexecutionトピックで流すので, ここでは状態の変化のみ扱う
+		switch data.OrderStatus {
+		case "New":
+			ev.Type = orderevent.Accepted
+		case "Rejected":
+			ev.Type = orderevent.Rejected
+		case "Cancelled", "Deactivated":
+			ev.Type = orderevent.Canceled
+			ev.Reason = data.CancelType
+		default:
+			continue
+		}
+		ps.queue.Push(ev)
+	}
+}
+
+func (ps *privateStream) handleExecution(msg []byte) {
+	type Res []struct {
+		Symbol    string    `json:"symbol"`
+		Side      string    `json:"side"`
+		OrderID   string    `json:"order_id"`
+		ExecID    string    `json:"exec_id"`
+		Price     string    `json:"price"`
+		OrderQty  float64   `json:"order_qty"`
+		ExecType  string    `json:"exec_type"`
+		ExecQty   float64   `json:"exec_qty"`
+		ExecFee   string    `json:"exec_fee"`
+		LeavesQty float64   `json:"leaves_qty"`
+		IsMaker   bool      `json:"is_maker"`
+		TradeTime time.Time `json:"trade_time"`
+	}
+	resData := Res{}
+	json.Unmarshal(msg, &resData)
+
+	for _, data := range resData {
+		// Fundingは注文の約定ではない
+		if data.ExecType == "Funding" {
+			continue
+		}
+		price, _ := strconv.ParseFloat(data.Price, 64)
+		fee, _ := strconv.ParseFloat(data.ExecFee, 64)
+		ev := orderevent.Event{
+			ID:    id.NewID(ps.name, data.Symbol, data.OrderID),
+			Type:  orderevent.PartiallyFilled,
+			IsBuy: data.Side == "Buy",
+			Norm: base.Norm{
+				Size: data.OrderQty,
+			},
+			ExecutedSize:  data.OrderQty - data.LeavesQty,
+			RemainingSize: data.LeavesQty,
+			Fill: &orderevent.Fill{
+				ExecutionID: data.ExecID,
+				Norm: base.Norm{
+					Price: price,
+					Size:  data.ExecQty,
+				},
+				// inverse契約の手数料は基軸通貨建て
+				Fee:         fee,
+				FeeCurrency: strings.TrimSuffix(data.Symbol, "USD"),
+				IsMaker:     data.IsMaker,
+			},
+			OccuredAt: data.TradeTime,
+		}
+		if data.LeavesQty == 0 {
+			ev.Type = orderevent.Filled
+		}
+		ps.queue.Push(ev)
+	}
+}
+
+func (ps *privateStream) handlePosition(msg []byte) {
+	type Res []struct {
+		Symbol string  `json:"symbol"`
+		Side   string  `json:"side"`
+		Size   float64 `json:"size"`
+	}
+	resData := Res{}
+	json.Unmarshal(msg, &resData)
+
+	for _, data := range resData {
+		pos := stock.Stock{Symbol: data.Symbol, Summary: data.Size}
+		if data.Side == "Sell" {
+			pos.Summary = -data.Size
+			pos.ShortSize = data.Size
+		} else {
+			pos.LongSize = data.Size
+		}
+		ps.queue.Push(orderevent.Event{
+			ID:        id.NewID(ps.name, data.Symbol, ""),
+			Type:      orderevent.PositionChanged,
+			Position:  &pos,
+			OccuredAt: time.Now(),
+		})
+	}
+}
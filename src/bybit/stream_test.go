@@ -0,0 +1,60 @@
+package bybit
+
+import (
+	"testing"
+
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/util/wsconn"
+)
+
+func TestHandlePrivateTopics(t *testing.T) {
+	ps := privateStream{name: "bybit", queue: &wsconn.Queue{}}
+	ps.handle([]byte(`{"topic":"order","data":[
+		{"order_id":"o1","symbol":"BTCUSD","side":"Buy","order_type":"Limit","price":"30000","qty":2,"order_status":"New","leaves_qty":2,"cum_exec_qty":0,"timestamp":"2021-01-01T00:00:00.123Z"},
+		{"order_id":"o2","symbol":"BTCUSD","side":"Sell","order_type":"Limit","price":"31000","qty":1,"order_status":"Cancelled","cancel_type":"CancelByUser","leaves_qty":1,"timestamp":"2021-01-01T00:00:00.456Z"}
+	]}`))
+	ps.handle([]byte(`{"topic":"execution","data":[
+		{"symbol":"BTCUSD","side":"Buy","order_id":"o1","exec_id":"e1","price":"30000","order_qty":2,"exec_type":"Trade","exec_qty":1,"exec_fee":"0.00000025","leaves_qty":1,"is_maker":true,"trade_time":"2021-01-01T00:00:01Z"},
+		{"symbol":"BTCUSD","side":"Buy","order_id":"","exec_id":"f1","price":"30000","order_qty":0,"exec_type":"Funding","exec_qty":2,"exec_fee":"0.00000010","leaves_qty":0,"trade_time":"2021-01-01T00:00:01Z"},
+		{"symbol":"BTCUSD","side":"Buy","order_id":"o1","exec_id":"e2","price":"30000","order_qty":2,"exec_type":"Trade","exec_qty":1,"exec_fee":"0.00000025","leaves_qty":0,"is_maker":false,"trade_time":"2021-01-01T00:00:02Z"}
+	]}`))
+	ps.handle([]byte(`{"topic":"position","data":[{"symbol":"BTCUSD","side":"Sell","size":3}]}`))
+
+	want := []struct {
+		typ     orderevent.Type
+		localID string
+	}{
+		{orderevent.Accepted, "o1"},
+		{orderevent.Canceled, "o2"},
+		{orderevent.PartiallyFilled, "o1"},
+		{orderevent.Filled, "o1"},
+		{orderevent.PositionChanged, ""},
+	}
+	for i, w := range want {
+		v := ps.queue.Pop()
+		if v == nil {
+			t.Fatalf("event %d not found", i)
+		}
+		got := v.(orderevent.Event)
+		if got.Type != w.typ || got.ID.LocalID != w.localID {
+			t.Errorf("event %d: %s %s", i, got.Type, got.ID.LocalID)
+		}
+		switch i {
+		case 1:
+			if got.Reason != "CancelByUser" {
+				t.Errorf("reason %s", got.Reason)
+			}
+		case 2:
+			if got.Fill == nil || got.Fill.Size != 1 || !got.Fill.IsMaker || got.Fill.FeeCurrency != "BTC" || got.RemainingSize != 1 {
+				t.Errorf("fill %+v %+v", got, got.Fill)
+			}
+		case 4:
+			if got.Position == nil || got.Position.Summary != -3 || got.Position.ShortSize != 3 {
+				t.Errorf("position %+v", got.Position)
+			}
+		}
+	}
+	if ps.queue.Pop() != nil {
+		t.Error("unexpected event")
+	}
+}
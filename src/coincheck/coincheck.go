@@ -2,13 +2,9 @@ package coincheck
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -18,25 +14,22 @@ import (
 
 	"github.com/TTRSQ/ccew/domains/base"
 	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
 	"github.com/TTRSQ/ccew/domains/order"
 	"github.com/TTRSQ/ccew/domains/order/id"
 	"github.com/TTRSQ/ccew/domains/stock"
 	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/httpx"
+	"github.com/TTRSQ/ccew/util/ratelimit"
+	"github.com/TTRSQ/ccew/util/retry"
+	"github.com/TTRSQ/ccew/util/sign"
 )
 
-type keyStruct struct {
-	id  string
-	sec string
-}
-
 type coincheck struct {
-	keys   []keyStruct
-	host   string
-	name   string
-	keyIdx int
+	host string
+	name string
 
-	proxyURL   *url.URL
-	httpClient *http.Client
+	client *httpx.Client
 }
 
 // New return exchange obj.
@@ -45,40 +38,18 @@ func New(key exchange.Key) (exchange.Exchange, error) {
 	cc.name = "coincheck"
 	cc.host = "coincheck.com"
 
-	if key.APIKey == "" || key.APISecKey == "" {
-		return nil, errors.New("APIKey and APISecKey Required")
-	}
-	cc.keys = []keyStruct{
-		{
-			id:  key.APIKey,
-			sec: key.APISecKey,
-		},
-	}
-
-	// nonceError回避用のkeyを追加する
-	_, exist := key.SpecificParam["additional_keys"]
-	if exist {
-		additionalKeys := key.SpecificParam["additional_keys"].([][]string)
-		for i := range additionalKeys {
-			cc.keys = append(cc.keys, keyStruct{
-				id:  additionalKeys[i][0],
-				sec: additionalKeys[i][1],
-			})
-		}
-	}
-
-	cc.httpClient = new(http.Client)
-	if key.SpecificParam["proxyURL"] != nil {
-		cc.httpClient = &http.Client{
-			Transport: &http.Transport{
-				Proxy: http.ProxyURL(key.SpecificParam["proxyURL"].(*url.URL)),
-			},
-		}
+	// additional_keys 複数のキーを順番に使う
+	keys, err := sign.PoolOf(key)
+	if err != nil {
+		return nil, err
 	}
 
-	if key.SpecificParam["timeoutMS"] != nil {
-		cc.httpClient.Timeout = time.Duration(key.SpecificParam["timeoutMS"].(int)) * time.Millisecond
-	}
+	cc.client = httpx.New(key, httpx.Options{
+		Name:        cc.name,
+		RateLimiter: ratelimit.New(ratelimit.Coincheck()),
+		Retry:       retry.Coincheck(),
+		Signer:      sign.Coincheck(keys),
+	})
 
 	return &cc, nil
 }
@@ -304,6 +275,53 @@ func (cc *coincheck) Boards(symbol string) (board.Board, error) {
 	}, nil
 }
 
+func (cc *coincheck) Executions(symbol string) ([]execution.Execution, error) {
+	type Req struct {
+		Symbol string `json:"pair"`
+	}
+	res, err := cc.getRequest("/api/trades", &Req{
+		Symbol: symbol,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// レスポンスの変換
+	type Res struct {
+		Success bool `json:"success"`
+		Data    []struct {
+			ID        int64     `json:"id"`
+			Amount    string    `json:"amount"`
+			Rate      string    `json:"rate"`
+			OrderType string    `json:"order_type"`
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"data"`
+	}
+	resData := Res{}
+	json.Unmarshal(res, &resData)
+	if !resData.Success {
+		return nil, errors.New(string(res))
+	}
+
+	// 返却値の作成
+	ret := []execution.Execution{}
+	for _, data := range resData.Data {
+		price, _ := strconv.ParseFloat(data.Rate, 64)
+		size, _ := strconv.ParseFloat(data.Amount, 64)
+		ret = append(ret, execution.Execution{
+			ID: id.NewID(cc.name, symbol, fmt.Sprint(data.ID)),
+			Norm: base.Norm{
+				Price: price,
+				Size:  size,
+			},
+			IsBuy:     data.OrderType == "buy",
+			OccuredAt: data.CreatedAt,
+		})
+	}
+
+	return ret, nil
+}
+
 func (cc *coincheck) InScheduledMaintenance() bool {
 	return false
 }
@@ -323,13 +341,7 @@ func (cc *coincheck) getRequest(path string, param interface{}) ([]byte, error)
 
 	req.Header.Add("Content-Type", "application/json")
 
-	timeStamp := fmt.Sprintf("%d", time.Now().UnixNano())
-	sig, apiKey := cc.makeHMAC(timeStamp + u.String())
-	req.Header.Add("ACCESS-KEY", apiKey)
-	req.Header.Add("ACCESS-SIGNATURE", sig)
-	req.Header.Add("ACCESS-NONCE", timeStamp)
-
-	return cc.request(req)
+	return cc.client.Do(req)
 }
 
 func (cc *coincheck) deleteRequest(path string, param interface{}) ([]byte, error) {
@@ -343,13 +355,7 @@ func (cc *coincheck) deleteRequest(path string, param interface{}) ([]byte, erro
 
 	req.Header.Add("Content-Type", "application/json")
 
-	timeStamp := fmt.Sprintf("%d", time.Now().UnixNano())
-	sig, apiKey := cc.makeHMAC(timeStamp + u.String() + string(jsonParam))
-	req.Header.Add("ACCESS-KEY", apiKey)
-	req.Header.Add("ACCESS-SIGNATURE", sig)
-	req.Header.Add("ACCESS-NONCE", timeStamp)
-
-	return cc.request(req)
+	return cc.client.Do(req)
 }
 
 func (cc *coincheck) postRequest(path string, param interface{}) ([]byte, error) {
@@ -363,13 +369,7 @@ func (cc *coincheck) postRequest(path string, param interface{}) ([]byte, error)
 
 	req.Header.Add("Content-Type", "application/json")
 
-	timeStamp := fmt.Sprintf("%d", time.Now().UnixNano())
-	sig, apiKey := cc.makeHMAC(timeStamp + u.String() + string(jsonParam))
-	req.Header.Add("ACCESS-KEY", apiKey)
-	req.Header.Add("ACCESS-SIGNATURE", sig)
-	req.Header.Add("ACCESS-NONCE", timeStamp)
-
-	return cc.request(req)
+	return cc.client.Do(req)
 }
 
 func structToQuery(data interface{}) string {
@@ -393,40 +393,6 @@ func structToQuery(data interface{}) string {
 	return strings.Join(queries, "&")
 }
 
-func (cc *coincheck) makeHMAC(msg string) (string, string) {
-	key := cc.getKey()
-	mac := hmac.New(sha256.New, []byte(key.sec))
-	mac.Write([]byte(msg))
-	return hex.EncodeToString(mac.Sum(nil)), key.id
-}
-
-func (cc *coincheck) getKey() keyStruct {
-	idx := cc.keyIdx
-	cc.keyIdx = (cc.keyIdx + 1) % len(cc.keys)
-	return cc.keys[idx]
-}
-
-func (cc *coincheck) request(req *http.Request) ([]byte, error) {
-	resp, err := cc.httpClient.Do(req)
-
-	if err != nil {
-		errStr := fmt.Sprintf("err ==> %+v\nreq ==> %v\n", err, req)
-		return nil, errors.New(errStr)
-	}
-	if resp.StatusCode != 200 {
-		body, _ := ioutil.ReadAll(resp.Body)
-		errStr := ""
-		errStr += fmt.Sprintf("body ==> %s\n", string(body))
-		errStr += fmt.Sprintf("resp ==> %+v\nreq ==> %v\n", resp, req)
-		return nil, errors.New(errStr)
-	}
-
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-
-	return body, err
-}
-
 func (cc *coincheck) UpdateLTP(lastTimePrice float64) error {
 	return errors.New("not supported.")
 }
@@ -0,0 +1,322 @@
+package dryrun
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/order"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/interface/exchange"
+)
+
+// modes of Entry.
+const (
+	// ModeDryRun order calls are signed but not sent.
+	ModeDryRun = "dry_run"
+	// ModeShadow order calls are only recorded.
+	ModeShadow = "shadow"
+	// ModeLive order calls are sent and recorded.
+	ModeLive = "live"
+)
+
+// notSent 送らなかったリクエストへの応答. 複数のリクエストを送る呼び出しも最後まで進める
+const notSent = "{}"
+
+// Request a signed HTTP request that was not sent. Header includes the API key and the signature.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Entry an order call of a decorated exchange.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Mode      string    `json:"mode"`
+	Exchange  string    `json:"exchange"`
+	Call      string    `json:"call"`
+	Symbol    string    `json:"symbol,omitempty"`
+	LocalID   string    `json:"local_id,omitempty"`
+	IsBuy     bool      `json:"is_buy,omitempty"`
+	OrderType string    `json:"order_type,omitempty"`
+	Price     float64   `json:"price,omitempty"`
+	Size      float64   `json:"size,omitempty"`
+	// ResultID local id returned to the caller. synthetic except in live mode.
+	ResultID string `json:"result_id,omitempty"`
+	Err      string `json:"err,omitempty"`
+	// Requests requests that would have been sent. dry run only.
+	Requests []Request `json:"requests,omitempty"`
+}
+
+// Journal order calls of decorated exchanges. give the same journal to a live and a shadow exchange
+// to compare their orders.
+type Journal struct {
+	mu      sync.Mutex
+	w       io.Writer
+	entries []Entry
+	err     error
+}
+
+// NewJournal entries are kept and also written to w as JSON lines if w is not nil.
+func NewJournal(w io.Writer) *Journal {
+	return &Journal{w: w}
+}
+
+// Entries copy of entries in call order.
+func (j *Journal) Entries() []Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Entry{}, j.entries...)
+}
+
+// Err first error of writing. writing is stopped after an error.
+func (j *Journal) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+func (j *Journal) add(e Entry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = append(j.entries, e)
+	if j.w == nil || j.err != nil {
+		return
+	}
+	line, err := json.Marshal(e)
+	if err == nil {
+		_, err = j.w.Write(append(line, '\n'))
+	}
+	if err != nil {
+		j.err = err
+	}
+}
+
+// recorder 送らなかったリクエスト
+type recorder struct {
+	mu       sync.Mutex
+	captured []Request
+}
+
+func (r *recorder) take() []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ret := r.captured
+	r.captured = nil
+	return ret
+}
+
+// transport GET以外 (注文の変更) は送らずに記録する
+type transport struct {
+	next http.RoundTripper
+	rec  *recorder
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return t.next.RoundTrip(req)
+	}
+	body := []byte{}
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+	t.rec.mu.Lock()
+	t.rec.captured = append(t.rec.captured, Request{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+		Body:   string(body),
+	})
+	t.rec.mu.Unlock()
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(notSent)),
+		ContentLength: int64(len(notSent)),
+		Request:       req,
+	}, nil
+}
+
+type decorator struct {
+	// reads go to the wrapped exchange.
+	exchange.Exchange
+	mode     string
+	journal  *Journal
+	recorder *recorder
+
+	// mu 注文の呼び出しは順番に行い, 記録したリクエストを呼び出しに対応させる
+	mu  sync.Mutex
+	seq int
+}
+
+// New create the exchange by factory (e.g. ccew.Bitflyer) in dry run mode.
+// reads hit the real API. order calls build and sign their requests, which are recorded to j
+// instead of being sent, and return synthetic ids. unsent requests get an empty JSON object, so calls sending
+// several requests record all of them. the transport of the adapter (proxyURL, tlsConfig, transport and
+// wrapTransport of SpecificParam) is kept for reads.
+func New(factory func(exchange.Key) (exchange.Exchange, error), key exchange.Key, j *Journal) (exchange.Exchange, error) {
+	rec := &recorder{}
+	param := map[string]interface{}{}
+	for k, v := range key.SpecificParam {
+		param[k] = v
+	}
+	wrap, _ := param["wrapTransport"].(func(http.RoundTripper) http.RoundTripper)
+	param["wrapTransport"] = func(next http.RoundTripper) http.RoundTripper {
+		if wrap != nil {
+			next = wrap(next)
+		}
+		return &transport{next: next, rec: rec}
+	}
+	key.SpecificParam = param
+
+	ex, err := factory(key)
+	if err != nil {
+		return nil, err
+	}
+	return &decorator{Exchange: ex, mode: ModeDryRun, journal: j, recorder: rec}, nil
+}
+
+// Shadow order calls of ex are recorded to j and not sent. they return synthetic ids. reads hit ex.
+// use it for a new version of a strategy running next to the live version.
+func Shadow(ex exchange.Exchange, j *Journal) exchange.Exchange {
+	return &decorator{Exchange: ex, mode: ModeShadow, journal: j}
+}
+
+// Live order calls of ex are sent and recorded to j. use it for the live version compared with Shadow.
+func Live(ex exchange.Exchange, j *Journal) exchange.Exchange {
+	return &decorator{Exchange: ex, mode: ModeLive, journal: j}
+}
+
+// call run f by the mode and record the call. f returns the local id of the result.
+func (d *decorator) call(e Entry, f func() (string, error)) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e.Time = time.Now()
+	e.Mode = d.mode
+	e.Exchange = d.ExchangeName()
+
+	var err error
+	switch d.mode {
+	case ModeLive:
+		e.ResultID, err = f()
+	case ModeShadow:
+		e.ResultID = d.syntheticID(e.LocalID)
+	case ModeDryRun:
+		d.recorder.take()
+		_, err = f()
+		e.Requests = d.recorder.take()
+		// 署名まで済んで送信前に止めたものは成功とする. 空の応答を読めずに失敗しても同じ
+		if len(e.Requests) > 0 {
+			err = nil
+			e.ResultID = d.syntheticID(e.LocalID)
+		}
+	}
+	if err != nil {
+		e.Err = err.Error()
+	}
+	d.journal.add(e)
+	return e.ResultID, err
+}
+
+// syntheticID 新規注文は連番, 既存の注文への操作は元のidを使う
+func (d *decorator) syntheticID(localID string) string {
+	if localID != "" {
+		return localID
+	}
+	d.seq++
+	return fmt.Sprintf("%s-%d", d.mode, d.seq)
+}
+
+func (d *decorator) CreateOrder(price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error) {
+	var res *order.Responce
+	localID, err := d.call(Entry{Call: "CreateOrder", Symbol: symbol, IsBuy: isBuy, OrderType: orderType, Price: price, Size: size}, func() (string, error) {
+		var err error
+		res, err = d.Exchange.CreateOrder(price, size, isBuy, symbol, orderType)
+		if err != nil {
+			return "", err
+		}
+		return res.ID.LocalID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if d.mode == ModeLive {
+		return res, nil
+	}
+	return &order.Responce{ID: id.NewID(d.ExchangeName(), symbol, localID)}, nil
+}
+
+func (d *decorator) LiquidationOrder(price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error) {
+	var res *order.Responce
+	localID, err := d.call(Entry{Call: "LiquidationOrder", Symbol: symbol, IsBuy: isBuy, OrderType: orderType, Price: price, Size: size}, func() (string, error) {
+		var err error
+		res, err = d.Exchange.LiquidationOrder(price, size, isBuy, symbol, orderType)
+		if err != nil {
+			return "", err
+		}
+		return res.ID.LocalID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if d.mode == ModeLive {
+		return res, nil
+	}
+	return &order.Responce{ID: id.NewID(d.ExchangeName(), symbol, localID)}, nil
+}
+
+func (d *decorator) EditOrder(symbol, localID string, price, size float64) (*order.Order, error) {
+	var res *order.Order
+	newID, err := d.call(Entry{Call: "EditOrder", Symbol: symbol, LocalID: localID, Price: price, Size: size}, func() (string, error) {
+		var err error
+		res, err = d.Exchange.EditOrder(symbol, localID, price, size)
+		if err != nil {
+			return "", err
+		}
+		return res.ID.LocalID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if d.mode == ModeLive {
+		return res, nil
+	}
+	return &order.Order{
+		ID: id.NewID(d.ExchangeName(), symbol, newID),
+		Request: order.Request{
+			Norm:   base.Norm{Price: price, Size: size},
+			Symbol: symbol,
+		},
+	}, nil
+}
+
+func (d *decorator) CancelOrder(symbol, localID string) error {
+	_, err := d.call(Entry{Call: "CancelOrder", Symbol: symbol, LocalID: localID}, func() (string, error) {
+		return localID, d.Exchange.CancelOrder(symbol, localID)
+	})
+	return err
+}
+
+func (d *decorator) CancelAllOrder(symbol string) error {
+	_, err := d.call(Entry{Call: "CancelAllOrder", Symbol: symbol}, func() (string, error) {
+		return "", d.Exchange.CancelAllOrder(symbol)
+	})
+	return err
+}
@@ -0,0 +1,145 @@
+package dryrun
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/TTRSQ/ccew/domains/order"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/src/bitflyer"
+	"github.com/TTRSQ/ccew/src/dummy"
+	"github.com/TTRSQ/ccew/util/retry"
+)
+
+func TestDryRun(t *testing.T) {
+	buf := &bytes.Buffer{}
+	j := NewJournal(buf)
+	ex, err := New(bitflyer.New, exchange.Key{APIKey: "key", APISecKey: "secret"}, j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := ex.CreateOrder(5000000, 0.01, true, "FX_BTC_JPY", "LIMIT")
+	if err != nil || res.ID.LocalID != "dry_run-1" || res.ID.ExchangeName != "bitflyer" {
+		t.Fatal(err, res)
+	}
+	if err := ex.CancelOrder("FX_BTC_JPY", "JRF0001"); err != nil {
+		t.Fatal(err)
+	}
+	// リクエストを作らずに失敗する呼び出しはそのまま返す
+	if _, err := ex.LiquidationOrder(1, 1, true, "FX_BTC_JPY", "LIMIT"); err == nil {
+		t.Fatal("error expected")
+	}
+
+	entries := j.Entries()
+	if len(entries) != 3 || entries[2].Err == "" || len(entries[1].Requests) != 1 {
+		t.Fatalf("entries %+v", entries)
+	}
+	req := entries[0].Requests[0]
+	if req.Method != "POST" || req.URL != "https://api.bitflyer.com/v1/me/sendchildorder" || !strings.Contains(req.Body, `"child_order_type":"LIMIT"`) {
+		t.Fatalf("request %+v", req)
+	}
+	// 署名を検証する
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(req.Header.Get("ACCESS-TIMESTAMP") + "POST/v1/me/sendchildorder" + req.Body))
+	if req.Header.Get("ACCESS-SIGN") != hex.EncodeToString(mac.Sum(nil)) || req.Header.Get("ACCESS-KEY") != "key" {
+		t.Errorf("header %v", req.Header)
+	}
+	if strings.Count(buf.String(), "\n") != 3 {
+		t.Errorf("journal %s", buf.String())
+	}
+}
+
+// cancelAndCreate 取消と新規の2つのリクエストで注文を変更する
+type cancelAndCreate struct {
+	exchange.Exchange
+}
+
+func (c cancelAndCreate) EditOrder(symbol, localID string, price, size float64) (*order.Order, error) {
+	if err := c.CancelOrder(symbol, localID); err != nil {
+		return nil, err
+	}
+	res, err := c.CreateOrder(price, size, true, symbol, "LIMIT")
+	if err != nil {
+		return nil, err
+	}
+	return &order.Order{ID: res.ID}, nil
+}
+
+func TestDryRunRequests(t *testing.T) {
+	// 読み込みは設定したプロキシを通る
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case proxied <- r.Method + " " + r.Host:
+		default:
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	j := NewJournal(nil)
+	factory := func(key exchange.Key) (exchange.Exchange, error) {
+		ex, err := bitflyer.New(key)
+		return cancelAndCreate{ex}, err
+	}
+	ex, err := New(factory, exchange.Key{APIKey: "key", APISecKey: "secret", SpecificParam: map[string]interface{}{
+		"proxyURL": proxyURL,
+		"retry":    retry.Policy{MaxAttempts: 1},
+	}}, j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex.Boards("FX_BTC_JPY")
+	select {
+	case got := <-proxied:
+		if got != "CONNECT api.bitflyer.com:443" {
+			t.Error(got)
+		}
+	default:
+		t.Error("read is not sent through the proxy")
+	}
+
+	// 複数のリクエストを送る呼び出しは全て記録する
+	if _, err := ex.EditOrder("FX_BTC_JPY", "JRF0001", 5000000, 0.01); err != nil {
+		t.Fatal(err)
+	}
+	entries := j.Entries()
+	if len(entries) != 1 || len(entries[0].Requests) != 2 {
+		t.Fatalf("entries %+v", entries)
+	}
+	if !strings.HasSuffix(entries[0].Requests[0].URL, "/cancelchildorder") || !strings.HasSuffix(entries[0].Requests[1].URL, "/sendchildorder") {
+		t.Fatalf("requests %+v", entries[0].Requests)
+	}
+}
+
+func TestShadow(t *testing.T) {
+	real, _ := dummy.New(exchange.Key{})
+	real.UpdateBestPrice(101, 99)
+	j := NewJournal(nil)
+	live := Live(real, j)
+	shadow := Shadow(real, j)
+
+	if _, err := live.CreateOrder(98, 1, true, "BTC_JPY", "LIMIT"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := shadow.CreateOrder(97, 1, true, "BTC_JPY", "LIMIT")
+	if err != nil || res.ID.LocalID != "shadow-1" {
+		t.Fatal(err, res)
+	}
+	// shadowの注文は送られない
+	if orders, _ := real.ActiveOrders("BTC_JPY"); len(orders) != 1 || orders[0].Price != 98 {
+		t.Fatalf("orders %+v", orders)
+	}
+	entries := j.Entries()
+	if len(entries) != 2 || entries[0].Mode != ModeLive || entries[0].ResultID == "" || entries[1].Mode != ModeShadow || entries[1].Price != 97 {
+		t.Errorf("entries %+v", entries)
+	}
+}
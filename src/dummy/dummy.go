@@ -3,56 +3,172 @@ package dummy
 import (
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
 	"sort"
+	"time"
 
 	"github.com/TTRSQ/ccew/domains/base"
 	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
 	"github.com/TTRSQ/ccew/domains/order"
 	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/orderevent"
 	"github.com/TTRSQ/ccew/domains/stock"
 	"github.com/TTRSQ/ccew/interface/exchange"
 )
 
 type dummy struct {
-	host       string
-	name       string
-	buyReqs    []boardElm
-	sellReqs   []boardElm
-	stockSize  float64
-	incID      int
-	ltp        float64
-	cash       float64
-	takerFee   float64
-	makerFee   float64
-	bestAsk    float64
-	bestBid    float64
+	host  string
+	name  string
+	incID int
+	// feeModel, fillModel 手数料と約定の決め方
+	feeModel   FeeModel
+	fillModel  FillModel
 	limitDelay int
+
+	// markets 銘柄ごとの板, 注文, 建玉. symbol は銘柄指定のない更新の対象
+	markets map[string]*market
+	symbol  string
+	// symbolCurrencies 銘柄名から通貨が分からない時の [base, quote]
+	symbolCurrencies map[string][]string
+	// balances 通貨ごとの残高
+	balances map[string]float64
+
+	// margin 証拠金取引の設定
+	margin marginConfig
+	// now イベント時刻. 約定とUpdateTimeで進む
+	now time.Time
+	// fundings 資金調達, スワップ, 借入コストの精算
+	fundings    []Funding
+	indexPrices map[string]float64
+	ledger      []FundingPayment
+	// events 購読されている時だけ溜める
+	events    []orderevent.Event
+	streaming bool
+
+	// entryLatency, cancelLatency, editLatency リクエストが取引所に届くまでの遅延. nilなら即時
+	entryLatency  Latency
+	cancelLatency Latency
+	editLatency   Latency
+	rand          *rand.Rand
+	randSource    *countingSource
+	pending       []pendingRequest
+	requestSeq    int
+
+	// logWriter 入力と約定を書き出す. ReplayLogで再現できる
+	logWriter io.Writer
+	logSeq    int
+	logErr    error
+
+	// queuePosition 指値の前に並んでいる数量を考慮する
+	queuePosition bool
+	queueCancel   string
 }
 
 type boardElm struct {
-	ID       string
-	Price    float64
-	Size     float64
-	DelayCnt int
+	ID         string
+	OrderType  string
+	ReduceOnly bool
+	DelayCnt   int
+	// Executed 約定済みの数量
+	Executed float64
+	RestingOrder
 }
 
 // New return exchange obj.
 func New(key exchange.Key) (exchange.Exchange, error) {
 	dm := dummy{}
 	dm.name = "dummy"
+	if key.SpecificParam["name"] != nil {
+		// 注文IDの取引所名. ペーパートレードでは本物の取引所名にする
+		dm.name = key.SpecificParam["name"].(string)
+	}
 	dm.host = "ttrsq.com"
-	dm.buyReqs = []boardElm{}
-	dm.sellReqs = []boardElm{}
-	dm.bestAsk = 100000000
+	dm.markets = map[string]*market{}
+	dm.symbolCurrencies = map[string][]string{}
+	dm.balances = map[string]float64{}
+	if key.SpecificParam["symbol"] != nil {
+		dm.symbol = key.SpecificParam["symbol"].(string)
+	}
+	dm.markets[dm.symbol] = newMarket(dm.symbol)
+	if key.SpecificParam["currencies"] != nil {
+		for symbol, c := range key.SpecificParam["currencies"].(map[string][]string) {
+			dm.symbolCurrencies[symbol] = c
+		}
+	}
+	if key.SpecificParam["balances"] != nil {
+		for currency, size := range key.SpecificParam["balances"].(map[string]float64) {
+			dm.balances[currency] = size
+		}
+	}
+	flat := FlatFee{}
 	if key.SpecificParam["makerFee"] != nil {
-		dm.makerFee = key.SpecificParam["makerFee"].(float64)
+		flat.Maker = key.SpecificParam["makerFee"].(float64)
 	}
 	if key.SpecificParam["takerFee"] != nil {
-		dm.takerFee = key.SpecificParam["takerFee"].(float64)
+		flat.Taker = key.SpecificParam["takerFee"].(float64)
+	}
+	dm.feeModel = flat
+	if key.SpecificParam["simulate"] != nil {
+		feeModel, err := FeeSchedule(key.SpecificParam["simulate"].(string))
+		if err != nil {
+			return nil, err
+		}
+		dm.feeModel = feeModel
+	}
+	if key.SpecificParam["feeModel"] != nil {
+		dm.feeModel = key.SpecificParam["feeModel"].(FeeModel)
 	}
 	if key.SpecificParam["limitDelay"] != nil {
 		dm.limitDelay = key.SpecificParam["limitDelay"].(int)
 	}
+	if key.SpecificParam["queuePosition"] != nil {
+		dm.queuePosition = key.SpecificParam["queuePosition"].(bool)
+	}
+	dm.fillModel = BoardFill{QueuePosition: dm.queuePosition}
+	if key.SpecificParam["fillModel"] != nil {
+		dm.fillModel = key.SpecificParam["fillModel"].(FillModel)
+	}
+	margin, err := newMarginConfig(key.SpecificParam)
+	if err != nil {
+		return nil, err
+	}
+	dm.margin = margin
+	dm.indexPrices = map[string]float64{}
+	seed := int64(1)
+	if key.SpecificParam["latencySeed"] != nil {
+		seed = key.SpecificParam["latencySeed"].(int64)
+	}
+	dm.setSeed(seed)
+	if key.SpecificParam["entryLatency"] != nil {
+		dm.entryLatency = key.SpecificParam["entryLatency"].(Latency)
+	}
+	if key.SpecificParam["cancelLatency"] != nil {
+		dm.cancelLatency = key.SpecificParam["cancelLatency"].(Latency)
+	}
+	if key.SpecificParam["editLatency"] != nil {
+		dm.editLatency = key.SpecificParam["editLatency"].(Latency)
+	}
+	if key.SpecificParam["funding"] != nil {
+		dm.fundings = append([]Funding{}, key.SpecificParam["funding"].([]Funding)...)
+		if err := validateFundings(dm.fundings); err != nil {
+			return nil, err
+		}
+	}
+	if key.SpecificParam["eventLog"] != nil {
+		dm.logWriter = key.SpecificParam["eventLog"].(io.Writer)
+	}
+	dm.queueCancel = QueueCancelProportional
+	if key.SpecificParam["queueCancel"] != nil {
+		dm.queueCancel = key.SpecificParam["queueCancel"].(string)
+		switch dm.queueCancel {
+		case QueueCancelNone, QueueCancelProportional, QueueCancelFront:
+		default:
+			return nil, fmt.Errorf("queueCancel %s not supported.", dm.queueCancel)
+		}
+	}
 
 	return &dm, nil
 }
@@ -69,35 +185,121 @@ func (dm *dummy) OrderTypes() exchange.OrderTypes {
 }
 
 func (dm *dummy) CreateOrder(price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error) {
+	dm.log(LogEntry{Kind: LogCreateOrder, Symbol: symbol, IsBuy: isBuy, OrderType: orderType, Price: price, Size: size})
 	localID := dm.incrementalID()
 	return dm.createOrderWithID(localID, price, size, isBuy, symbol, orderType)
 }
 
 func (dm *dummy) createOrderWithID(localID string, price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error) {
-	executed := false
-	if orderType == "LIMIT" {
-		executed = dm.addOrder(isBuy, boardElm{
-			ID:    localID,
-			Price: price,
-			Size:  size,
+	if size <= 0 {
+		return nil, errors.New("size must be positive.")
+	}
+	m := dm.market(symbol)
+	if _, _, err := dm.currencies(m); err != nil {
+		return nil, err
+	}
+	if _, err := dm.parseOrderType(orderType); err != nil {
+		return nil, err
+	}
+	if dm.entryLatency != nil {
+		// 取引所に届いてから約定判定する. エラーはRejectedイベントになる
+		dm.delay(dm.entryLatency, pendingRequest{
+			kind:      entryRequest,
+			symbol:    m.symbol,
+			localID:   localID,
+			price:     price,
+			size:      size,
+			isBuy:     isBuy,
+			orderType: orderType,
 		})
-	} else {
-		executed = true
-	}
-	if executed {
-		if isBuy {
-			dm.stockSize += size
-			dm.cash -= price * size * (1.0 + dm.takerFee)
-		} else {
-			dm.stockSize -= size
-			dm.cash += price * size * (1.0 - dm.takerFee)
+		return &order.Responce{ID: id.NewID(dm.name, m.symbol, localID)}, nil
+	}
+	return dm.enterOrder(localID, price, size, isBuy, symbol, orderType)
+}
+
+// enterOrder match the order on arrival and rest the remaining of limit orders.
+func (dm *dummy) enterOrder(localID string, price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error) {
+	m := dm.market(symbol)
+	spec, err := dm.parseOrderType(orderType)
+	if err != nil {
+		return nil, err
+	}
+	// 価格が届く前の成行は仮の板で約定してしまう
+	if spec.market && !m.priced {
+		return nil, ErrNoPrice
+	}
+	if spec.reduceOnly {
+		reducible := m.reducible(isBuy)
+		if reducible <= sizeEpsilon {
+			return nil, ErrReduceOnly
+		}
+		size = math.Min(size, reducible)
+	}
+	levels := m.asks
+	if !isBuy {
+		levels = m.bids
+	}
+	if spec.postOnly && len(levels) > 0 && ((isBuy && price >= levels[0].Price) || (!isBuy && price <= levels[0].Price)) {
+		return nil, ErrPostOnlyWouldTake
+	}
+	if spec.fok {
+		available := 0.0
+		for _, fill := range dm.fillModel.Take(levels, isBuy, price, size, spec.market) {
+			available += fill.Size
+		}
+		if available < size-sizeEpsilon {
+			return nil, ErrFOKNotFilled
 		}
 	}
+	estimate := price
+	if spec.market {
+		estimate = 0
+	}
+	if err := dm.checkMargin(m, isBuy, estimate, size); err != nil {
+		return nil, err
+	}
+
+	// 板にぶつかる分は板の価格で約定する. 成行は板を最後まで歩く
+	filled := dm.take(m, localID, orderType, isBuy, price, size, spec.market)
+	remaining := size - filled
+	switch {
+	case spec.market && filled == 0:
+		return nil, errors.New("no liquidity.")
+	case remaining <= sizeEpsilon:
+	case spec.rests():
+		ele := boardElm{
+			ID:         localID,
+			OrderType:  orderType,
+			ReduceOnly: spec.reduceOnly,
+			Executed:   filled,
+			RestingOrder: RestingOrder{
+				Price: price,
+				Size:  remaining,
+			},
+		}
+		// 同じ価格に表示されている数量の後ろに並ぶ
+		ele.LevelSize = m.displayedSize(!isBuy, price)
+		ele.QueueAhead = ele.LevelSize
+		m.addOrder(isBuy, ele)
+	default:
+		// IOCと成行の残りは失効
+		dm.emit(orderevent.Event{
+			ID:        id.NewID(dm.name, m.symbol, localID),
+			Type:      orderevent.Expired,
+			IsBuy:     isBuy,
+			OrderType: orderType,
+			Norm: base.Norm{
+				Price: price,
+				Size:  size,
+			},
+			ExecutedSize:  filled,
+			RemainingSize: remaining,
+		})
+	}
 
 	return &order.Responce{
-		ID: id.NewID(dm.name, symbol, localID),
-		// TODO: using best ask, bid.
-		FilledSize: map[bool]float64{true: size, false: 0.0}[orderType == dm.OrderTypes().Market],
+		ID:         id.NewID(dm.name, m.symbol, localID),
+		FilledSize: filled,
 	}, nil
 }
 
@@ -105,70 +307,124 @@ func (dm *dummy) LiquidationOrder(price, size float64, isBuy bool, symbol, order
 	return nil, errors.New("EditOrder not supported. ")
 }
 
+// EditOrder replace price and size of the order. flags of the order type are kept.
 func (dm *dummy) EditOrder(symbol, localID string, price, size float64) (*order.Order, error) {
-	// キャンセル
-	canceled, isBuy := dm.cancelOrder(localID)
-
-	if !canceled {
+	dm.log(LogEntry{Kind: LogEditOrder, Symbol: symbol, LocalID: localID, Price: price, Size: size})
+	m := dm.market(symbol)
+	ele, isBuy, ok := m.find(localID)
+	if !ok {
 		return &order.Order{}, fmt.Errorf("order:%s not found. ", localID)
 	}
-
-	// 新規作成
-	ord, err := dm.createOrderWithID(localID, price, size, isBuy, symbol, dm.OrderTypes().Limit)
-	if err != nil {
-		return nil, err
-	}
-
-	return &order.Order{
-		ID: ord.ID,
+	ret := &order.Order{
+		ID: id.NewID(dm.name, m.symbol, localID),
 		Request: order.Request{
 			Norm: base.Norm{
 				Price: price,
-				Size:  size - ord.FilledSize,
+				Size:  size,
 			},
 			Symbol:    symbol,
 			IsBuy:     isBuy,
-			OrderType: dm.OrderTypes().Limit,
+			OrderType: ele.OrderType,
 		},
-	}, nil
+	}
+	if dm.editLatency != nil {
+		dm.delay(dm.editLatency, pendingRequest{
+			kind:      editRequest,
+			symbol:    m.symbol,
+			localID:   localID,
+			price:     price,
+			size:      size,
+			isBuy:     isBuy,
+			orderType: ele.OrderType,
+		})
+		return ret, nil
+	}
+
+	ord, err := dm.replaceOrder(m, localID, price, size)
+	if err != nil {
+		return nil, err
+	}
+	ret.Size = size - ord.FilledSize
+	return ret, nil
+}
+
+// replaceOrder cancel and enter the order again with the same id and order type.
+// the original order is kept if the new one is rejected.
+func (dm *dummy) replaceOrder(m *market, localID string, price, size float64) (*order.Responce, error) {
+	ele, isBuy, ok := m.find(localID)
+	if !ok {
+		return nil, fmt.Errorf("order:%s not found. ", localID)
+	}
+	m.cancelOrder(localID)
+	ord, err := dm.enterOrder(localID, price, size, isBuy, m.symbol, ele.OrderType)
+	if err != nil {
+		m.addOrder(isBuy, ele)
+		return nil, err
+	}
+	return ord, nil
 }
 
 func (dm *dummy) CancelOrder(symbol, localID string) error {
-	dm.cancelOrder(localID)
+	dm.log(LogEntry{Kind: LogCancelOrder, Symbol: symbol, LocalID: localID})
+	m := dm.market(symbol)
+	if dm.cancelLatency != nil {
+		dm.delay(dm.cancelLatency, pendingRequest{kind: cancelRequest, symbol: m.symbol, localID: localID})
+		return nil
+	}
+	dm.cancel(m, localID)
 	return nil
 }
 
+// CancelAllOrder cancel orders of the symbol only.
 func (dm *dummy) CancelAllOrder(symbol string) error {
-	dm.buyReqs = []boardElm{}
-	dm.sellReqs = []boardElm{}
+	dm.log(LogEntry{Kind: LogCancelAllOrder, Symbol: symbol})
+	m := dm.market(symbol)
+	if dm.cancelLatency != nil {
+		// 遅延は1リクエスト分. 届いた時点で生きている注文を全て取り消す
+		at := dm.latency(dm.cancelLatency)
+		for _, reqs := range [][]boardElm{m.buyReqs, m.sellReqs} {
+			for _, v := range reqs {
+				dm.delay(FixedLatency(at), pendingRequest{kind: cancelRequest, symbol: m.symbol, localID: v.ID})
+			}
+		}
+		return nil
+	}
+	for _, reqs := range [][]boardElm{m.buyReqs, m.sellReqs} {
+		for _, v := range reqs {
+			dm.cancel(m, v.ID)
+		}
+	}
 	return nil
 }
 
 func (dm *dummy) ActiveOrders(symbol string) ([]order.Order, error) {
+	m := dm.market(symbol)
 	ret := []order.Order{}
-	for _, data := range dm.buyReqs {
+	for _, data := range m.buyReqs {
 		ret = append(ret, order.Order{
-			ID: id.NewID(dm.name, symbol, data.ID),
+			ID: id.NewID(dm.name, m.symbol, data.ID),
 			Request: order.Request{
 				IsBuy:     true,
-				OrderType: "LIMIT",
+				OrderType: data.OrderType,
 				Norm: base.Norm{
 					Price: data.Price,
 					Size:  data.Size,
 				},
+				Symbol: m.symbol,
 			},
 		})
 	}
-	for _, data := range dm.sellReqs {
+	for _, data := range m.sellReqs {
 		ret = append(ret, order.Order{
-			ID: id.NewID(dm.name, symbol, data.ID),
+			ID: id.NewID(dm.name, m.symbol, data.ID),
 			Request: order.Request{
 				IsBuy:     false,
-				OrderType: "LIMIT",
+				OrderType: data.OrderType,
 				Norm: base.Norm{
 					Price: data.Price,
 					Size:  data.Size,
 				},
+				Symbol: m.symbol,
 			},
 		})
 	}
@@ -176,139 +432,100 @@ func (dm *dummy) ActiveOrders(symbol string) ([]order.Order, error) {
 }
 
 func (dm *dummy) Stocks(symbol string) (stock.Stock, error) {
-
-	stock := stock.Stock{Symbol: symbol, Summary: dm.stockSize}
-	if dm.stockSize > 0 {
-		stock.LongSize = dm.stockSize
+	m := dm.market(symbol)
+	stock := stock.Stock{Symbol: m.symbol, Summary: m.position}
+	if m.position > 0 {
+		stock.LongSize = m.position
 	} else {
-		stock.ShortSize = -dm.stockSize
+		stock.ShortSize = -m.position
 	}
 	return stock, nil
 }
 
+// Balance return all (equity marked to market), fiat (balance of the quote currency) and crypto (position)
+// of the default symbol as before, then balances of each currency sorted by currency code.
 func (dm *dummy) Balance() ([]base.Balance, error) {
-	ret := []base.Balance{
-		{
-			CurrencyCode: "all",
-			Size:         dm.cash + dm.stockSize*dm.ltp,
-		},
-		{
-			CurrencyCode: "fiat",
-			Size:         dm.cash,
-		}, {
-			CurrencyCode: "crypto",
-			Size:         dm.stockSize,
-		},
+	ret := dm.legacyBalance()
+	codes := []string{}
+	for code := range dm.balances {
+		codes = append(codes, code)
 	}
+	sort.Strings(codes)
 
+	for _, code := range codes {
+		ret = append(ret, base.Balance{
+			CurrencyCode: code,
+			Size:         dm.balances[code],
+		})
+	}
 	return ret, nil
 }
 
+// legacyBalance 通貨ごとの残高の前からある形式. 既定の銘柄の通貨が分からなければ省く
+func (dm *dummy) legacyBalance() []base.Balance {
+	m, ok := dm.lookup("")
+	if !ok {
+		return []base.Balance{}
+	}
+	_, quoteCurrency, err := dm.currencies(m)
+	if err != nil {
+		return []base.Balance{}
+	}
+	all, err := dm.Equity(quoteCurrency)
+	if err != nil {
+		// 換算できない通貨があれば既定の銘柄だけで評価する
+		all = dm.balances[quoteCurrency] + m.position*m.markPrice()
+		if dm.margin.enabled {
+			all = dm.balances[quoteCurrency] + m.unrealizedPnL()
+		}
+	}
+	return []base.Balance{
+		{CurrencyCode: "all", Size: all},
+		{CurrencyCode: "fiat", Size: dm.balances[quoteCurrency]},
+		{CurrencyCode: "crypto", Size: m.position},
+	}
+}
+
 func (dm *dummy) Boards(symbol string) (board.Board, error) {
 	return board.Board{}, errors.New("not supported. ")
 }
 
+func (dm *dummy) Executions(symbol string) ([]execution.Execution, error) {
+	return nil, errors.New("not supported.")
+}
+
 func (dm *dummy) InScheduledMaintenance() bool {
 	return false
 }
 
+// UpdateLTP update the default symbol.
 func (dm *dummy) UpdateLTP(lastTimePrice float64) error {
-	dm.ltp = lastTimePrice
-	dm.updateExecution()
-	return nil
+	return dm.UpdateSymbolLTP("", lastTimePrice)
 }
 
+// UpdateBestPrice update the default symbol.
 func (dm *dummy) UpdateBestPrice(bestAsk, bestBid float64) error {
-	dm.bestAsk = bestAsk
-	dm.bestBid = bestBid
-	return nil
-}
-
-func (dm *dummy) updateExecution() {
-	executedIDs := []string{}
-	for i, v := range dm.buyReqs {
-		if dm.ltp < v.Price && v.DelayCnt >= dm.limitDelay {
-			executedIDs = append(executedIDs, v.ID)
-			dm.stockSize += v.Size
-			dm.cash -= v.Price * v.Size * (1.0 + dm.makerFee)
-		}
-		dm.buyReqs[i].DelayCnt += 1
-	}
-
-	for i, v := range dm.sellReqs {
-		if dm.ltp > v.Price && v.DelayCnt >= dm.limitDelay {
-			executedIDs = append(executedIDs, v.ID)
-			dm.stockSize -= v.Size
-			dm.cash += v.Price * v.Size * (1.0 - dm.makerFee)
-		}
-		dm.sellReqs[i].DelayCnt += 1
-	}
-
-	// 不要になったオーダー削除
-	for _, v := range executedIDs {
-		dm.cancelOrder(v)
-	}
+	return dm.UpdateSymbolBestPrice("", bestAsk, bestBid)
 }
 
-func (dm *dummy) addOrder(isBuy bool, ele boardElm) bool {
-	executed := false
-	if isBuy {
-		if dm.bestAsk < ele.Price {
-			executed = true
-			dm.bestAsk *= 1.1
-		} else {
-			dm.buyReqs = append(dm.buyReqs, ele)
-			if len(dm.buyReqs) > 1 {
-				sort.Slice(dm.buyReqs, func(i, j int) bool {
-					return dm.buyReqs[i].Price > dm.buyReqs[j].Price
-				})
-			}
-		}
-	} else {
-		if dm.bestBid > ele.Price {
-			executed = true
-			dm.bestBid /= 1.1
-		} else {
-			dm.sellReqs = append(dm.sellReqs, ele)
-			if len(dm.sellReqs) > 1 {
-				sort.Slice(dm.sellReqs, func(i, j int) bool {
-					return dm.sellReqs[i].Price < dm.sellReqs[j].Price
-				})
-			}
-		}
-	}
-	return executed
+func (dm *dummy) UpdateSymbolLTP(symbol string, lastTimePrice float64) error {
+	dm.log(LogEntry{Kind: LogUpdateLTP, Symbol: symbol, Price: lastTimePrice})
+	// 出来高が分からないので価格を超えた注文は全量約定する
+	m := dm.market(symbol)
+	m.updateLTP(lastTimePrice)
+	dm.fillResting(m, lastTimePrice, math.Inf(1))
+	dm.checkLiquidation()
+	return nil
 }
 
-// returns canceled, isbuy
-func (dm *dummy) cancelOrder(id string) (bool, bool) {
-	newBuyReqs := []boardElm{}
-	newSellReqs := []boardElm{}
-
-	canceled := false
-	isBuy := false
-
-	for _, v := range dm.buyReqs {
-		if id != v.ID {
-			newBuyReqs = append(newBuyReqs, v)
-		} else {
-			canceled = true
-			isBuy = true
-		}
-	}
-
-	for _, v := range dm.sellReqs {
-		if id != v.ID {
-			newSellReqs = append(newSellReqs, v)
-		} else {
-			canceled = true
-		}
-	}
-
-	dm.buyReqs = newBuyReqs
-	dm.sellReqs = newSellReqs
-
-	return canceled, isBuy
+func (dm *dummy) UpdateSymbolBestPrice(symbol string, bestAsk, bestBid float64) error {
+	dm.log(LogEntry{Kind: LogUpdateBestPrice, Symbol: symbol, BestAsk: bestAsk, BestBid: bestBid})
+	m := dm.market(symbol)
+	m.setBestPrice(bestAsk, bestBid)
+	m.priced = true
+	m.quoted = true
+	dm.checkLiquidation()
+	return nil
 }
 
 func (dm *dummy) incrementalID() string {
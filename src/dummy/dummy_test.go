@@ -0,0 +1,518 @@
+package dummy
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/interface/exchange"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestMatchingWalksBoard(t *testing.T) {
+	ex, _ := New(exchange.Key{})
+	dm := ex.(*dummy)
+	dm.UpdateBoard(board.Board{
+		Asks: []base.Norm{{Price: 101, Size: 1}, {Price: 102, Size: 1}, {Price: 104, Size: 5}},
+		Bids: []base.Norm{{Price: 99, Size: 1}},
+	})
+
+	// 102まで2枚約定し, 残り1枚は102で置かれる
+	res, err := dm.CreateOrder(102, 3, true, "BTC_JPY", "LIMIT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(res.FilledSize, 2) || !near(dm.balances["JPY"], -203) {
+		t.Fatalf("filled %f cash %f", res.FilledSize, dm.balances["JPY"])
+	}
+	orders, _ := dm.ActiveOrders("BTC_JPY")
+	if len(orders) != 1 || !near(orders[0].Size, 1) {
+		t.Fatalf("orders %+v", orders)
+	}
+	if dm.market("BTC_JPY").bestAsk != 104 {
+		t.Errorf("best ask %f", dm.market("BTC_JPY").bestAsk)
+	}
+
+	// 約定価格を超えた出来高の分だけ約定する
+	dm.UpdateExecution(execution.Execution{Norm: base.Norm{Price: 101.5, Size: 0.4}})
+	orders, _ = dm.ActiveOrders("BTC_JPY")
+	if len(orders) != 1 || !near(orders[0].Size, 0.6) || !near(dm.market("BTC_JPY").position, 2.4) {
+		t.Fatalf("orders %+v stock %f", orders, dm.market("BTC_JPY").position)
+	}
+
+	// 成行は最良気配から
+	res, err = dm.CreateOrder(0, 2, false, "BTC_JPY", "MARKET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(res.FilledSize, 1) {
+		t.Errorf("market order must be limited by board: %f", res.FilledSize)
+	}
+	if _, err := dm.CreateOrder(0, 1, false, "BTC_JPY", "MARKET"); err == nil {
+		t.Error("market order without liquidity must fail")
+	}
+}
+
+func TestMarketOrderBeforePrice(t *testing.T) {
+	ex, _ := New(exchange.Key{SpecificParam: map[string]interface{}{"symbol": "BTC_JPY"}})
+	dm := ex.(*dummy)
+
+	// 価格が届くまで成行は仮の板で約定しない
+	if _, err := dm.CreateOrder(0, 1, true, "BTC_JPY", "MARKET"); err != ErrNoPrice {
+		t.Fatal(err)
+	}
+	if !near(dm.balances["JPY"], 0) {
+		t.Fatalf("cash %f", dm.balances["JPY"])
+	}
+	// 板がなければ最終約定価格で約定する
+	dm.UpdateLTP(100)
+	if res, err := dm.CreateOrder(0, 1, true, "BTC_JPY", "MARKET"); err != nil || !near(res.FilledSize, 1) || !near(dm.balances["JPY"], -100) {
+		t.Fatal(err, res, dm.balances["JPY"])
+	}
+	dm.UpdateBestPrice(101, 99)
+	dm.UpdateLTP(102)
+	if res, err := dm.CreateOrder(0, 1, true, "BTC_JPY", "MARKET"); err != nil || !near(res.FilledSize, 1) || !near(dm.balances["JPY"], -201) {
+		t.Fatal(err, res, dm.balances["JPY"])
+	}
+
+	// 銘柄ごとに判定する
+	if _, err := dm.CreateOrder(0, 1, false, "ETH_JPY", "MARKET"); err != ErrNoPrice {
+		t.Fatal(err)
+	}
+	dm.UpdateBoard(board.Board{Symbol: "ETH_JPY", Bids: []base.Norm{{Price: 5000, Size: 1}}})
+	if res, err := dm.CreateOrder(0, 1, false, "ETH_JPY", "MARKET"); err != nil || !near(res.FilledSize, 1) {
+		t.Fatal(err, res)
+	}
+	dm.UpdateExecution(execution.Execution{Norm: base.Norm{Price: 30, Size: 1}, ID: id.ID{Symbol: "XRP_JPY"}})
+	if res, err := dm.CreateOrder(0, 1, false, "XRP_JPY", "MARKET"); err != nil || !near(res.FilledSize, 1) {
+		t.Fatal(err, res)
+	}
+}
+
+func TestQueuePosition(t *testing.T) {
+	ex, err := New(exchange.Key{SpecificParam: map[string]interface{}{
+		"queuePosition": true,
+		"queueCancel":   QueueCancelFront,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm := ex.(*dummy)
+	dm.UpdateBoard(board.Board{
+		Asks: []base.Norm{{Price: 101, Size: 1}},
+		Bids: []base.Norm{{Price: 100, Size: 3}},
+	})
+	dm.CreateOrder(100, 2, true, "BTC_JPY", "LIMIT")
+
+	// 前の3枚のうち2枚が約定, 0.5枚がキャンセル
+	dm.UpdateExecution(execution.Execution{Norm: base.Norm{Price: 100, Size: 2}})
+	dm.UpdateBoard(board.Board{Bids: []base.Norm{{Price: 100, Size: 0.5}}})
+	if q := dm.market("BTC_JPY").buyReqs[0].QueueAhead; !near(q, 0.5) {
+		t.Fatalf("queue ahead %f", q)
+	}
+
+	// 前の0.5枚を消化した残りで一部約定
+	dm.UpdateExecution(execution.Execution{Norm: base.Norm{Price: 100, Size: 1.5}})
+	if !near(dm.market("BTC_JPY").position, 1) || !near(dm.market("BTC_JPY").buyReqs[0].Size, 1) {
+		t.Fatalf("stock %f order %+v", dm.market("BTC_JPY").position, dm.market("BTC_JPY").buyReqs[0])
+	}
+}
+
+func TestMultiSymbol(t *testing.T) {
+	ex, _ := New(exchange.Key{SpecificParam: map[string]interface{}{
+		"balances": map[string]float64{"JPY": 1000000},
+	}})
+	dm := ex.(*dummy)
+	dm.UpdateSymbolBestPrice("BTC_JPY", 101, 100)
+	dm.UpdateSymbolBestPrice("ETH_BTC", 0.051, 0.05)
+
+	dm.CreateOrder(0, 1, true, "BTC_JPY", "MARKET")
+	dm.CreateOrder(0, 10, true, "ETH_BTC", "MARKET")
+	dm.CreateOrder(90, 1, true, "BTC_JPY", "LIMIT")
+	dm.CreateOrder(0.04, 1, true, "ETH_BTC", "LIMIT")
+
+	// BTCは買った1からETHの代金0.51を引いた分
+	// 先頭は既定の銘柄BTC_JPYの時価評価額. ETHは円に換算できないので既定の銘柄だけで評価する
+	balances, _ := dm.Balance()
+	want := map[string]float64{"all": 1000000 - 101 + 100.5, "fiat": 1000000 - 101, "crypto": 1, "BTC": 0.49, "ETH": 10, "JPY": 1000000 - 101}
+	if len(balances) != len(want) || balances[0].CurrencyCode != "all" {
+		t.Fatalf("balances %+v", balances)
+	}
+	for _, b := range balances {
+		if !near(b.Size, want[b.CurrencyCode]) {
+			t.Errorf("%s %f", b.CurrencyCode, b.Size)
+		}
+	}
+	if s, _ := dm.Stocks("ETH_BTC"); !near(s.Summary, 10) {
+		t.Errorf("stock %+v", s)
+	}
+
+	// 他の銘柄の価格と注文は影響しない
+	dm.UpdateSymbolLTP("BTC_JPY", 80)
+	if orders, _ := dm.ActiveOrders("ETH_BTC"); len(orders) != 1 || orders[0].Request.Symbol != "ETH_BTC" {
+		t.Fatalf("orders %+v", orders)
+	}
+	dm.CancelAllOrder("ETH_BTC")
+	if orders, _ := dm.ActiveOrders("ETH_BTC"); len(orders) != 0 {
+		t.Fatalf("orders %+v", orders)
+	}
+	if s, _ := dm.Stocks("BTC_JPY"); !near(s.Summary, 2) {
+		t.Errorf("stock %+v", s)
+	}
+}
+
+func TestMarginLiquidation(t *testing.T) {
+	ex, err := New(exchange.Key{SpecificParam: map[string]interface{}{
+		"margin":              true,
+		"leverage":            2.0,
+		"liquidationSlippage": 0.01,
+		"balances":            map[string]float64{"JPY": 100},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm := ex.(*dummy)
+	stream, _ := NewPrivateStream(ex)
+	dm.UpdateSymbolBestPrice("FX_BTC_JPY", 100, 99)
+
+	if _, err := dm.CreateOrder(0, 2, true, "FX_BTC_JPY", "MARKET"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dm.CreateOrder(99, 0.1, true, "FX_BTC_JPY", "LIMIT"); err == nil {
+		t.Fatal("order beyond free margin must be rejected")
+	}
+	if _, err := dm.CreateOrder(120, 1, false, "FX_BTC_JPY", "LIMIT"); err != nil {
+		t.Fatalf("closing order must be accepted: %v", err)
+	}
+
+	// 証拠金維持率を割るまでは強制決済されない
+	dm.UpdateSymbolLTP("FX_BTC_JPY", 70)
+	status, _ := dm.Margin("JPY")
+	if !near(status.UnrealizedPnL, -60) || !near(status.MaintenanceMargin, 35) {
+		t.Fatalf("status %+v", status)
+	}
+	if ev, _ := stream.Read(); ev == nil || ev.Type != orderevent.Filled || ev.Fill == nil || ev.Fill.IsMaker {
+		t.Fatalf("fill event %+v", ev)
+	}
+	if ev, _ := stream.Read(); ev != nil {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+
+	dm.UpdateSymbolLTP("FX_BTC_JPY", 65)
+	ev, _ := stream.Read()
+	if ev == nil || ev.Type != orderevent.Liquidated || ev.IsBuy || !near(ev.Price, 64.35) {
+		t.Fatalf("event %+v", ev)
+	}
+	if s, _ := dm.Stocks("FX_BTC_JPY"); s.Summary != 0 || !near(dm.balances["JPY"], 100-35.65*2) {
+		t.Fatalf("stock %+v balance %f", s, dm.balances["JPY"])
+	}
+	if orders, _ := dm.ActiveOrders("FX_BTC_JPY"); len(orders) != 0 {
+		t.Fatalf("orders %+v", orders)
+	}
+}
+
+func TestFunding(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC)
+	ex, err := New(exchange.Key{SpecificParam: map[string]interface{}{
+		"margin": true,
+		"funding": []Funding{{
+			Symbol:   "BTC-PERP",
+			Interval: time.Hour,
+			Rate:     0.001,
+			Rates:    []FundingRate{{Time: start.Add(time.Hour), Rate: -0.002}},
+		}},
+		"balances": map[string]float64{"USD": 1000},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm := ex.(*dummy)
+	dm.UpdateTime(start)
+	dm.UpdateSymbolBestPrice("BTC-PERP", 100, 99)
+	dm.CreateOrder(0, 1, true, "BTC-PERP", "MARKET")
+	dm.UpdateSymbolLTP("BTC-PERP", 100)
+
+	// 1:00は固定レートで支払い, 2:00は時系列のレートで受け取り
+	dm.UpdateTime(start.Add(2 * time.Hour))
+	ledger := dm.Ledger()
+	if len(ledger) != 2 || !near(ledger[0].Amount, -0.1) || !near(ledger[1].Amount, 0.2) {
+		t.Fatalf("ledger %+v", ledger)
+	}
+	if !ledger[1].Time.Equal(start.Add(90 * time.Minute)) {
+		t.Errorf("settlement time %v", ledger[1].Time)
+	}
+	if !near(dm.balances["USD"], 1000.1) {
+		t.Errorf("balance %f", dm.balances["USD"])
+	}
+}
+
+func TestFundingOfOtherSymbol(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC)
+	ex, _ := New(exchange.Key{SpecificParam: map[string]interface{}{
+		"margin":   true,
+		"funding":  []Funding{{Symbol: "ETH-PERP", Interval: time.Hour, Rate: 0.001}},
+		"balances": map[string]float64{"USD": 1000},
+	}})
+	dm := ex.(*dummy)
+	dm.UpdateTime(start)
+	dm.UpdateIndexPrice("ETH-PERP", 2000)
+	dm.UpdateBestPrice(100, 99)
+
+	// 取引していない銘柄の精算は既定の銘柄を乗っ取らない
+	dm.UpdateTime(start.Add(2 * time.Hour))
+	if _, ok := dm.markets["ETH-PERP"]; ok || len(dm.Ledger()) != 0 {
+		t.Fatalf("markets %+v ledger %+v", dm.markets, dm.Ledger())
+	}
+	res, err := dm.CreateOrder(0, 1, true, "BTC-PERP", "MARKET")
+	if err != nil || !near(res.FilledSize, 1) || dm.symbol != "BTC-PERP" {
+		t.Fatal(err, res, dm.symbol)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	ex, _ := New(exchange.Key{SpecificParam: map[string]interface{}{
+		"entryLatency":  FixedLatency(100 * time.Millisecond),
+		"cancelLatency": FixedLatency(50 * time.Millisecond),
+	}})
+	dm := ex.(*dummy)
+	stream, _ := NewPrivateStream(ex)
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	trade := func(ms int, price float64) {
+		dm.UpdateExecution(execution.Execution{
+			Norm:      base.Norm{Price: price, Size: 1},
+			OccuredAt: start.Add(time.Duration(ms) * time.Millisecond),
+		})
+	}
+	trade(0, 100)
+	dm.UpdateBestPrice(101, 99)
+	dm.CreateOrder(100, 1, true, "BTC_JPY", "LIMIT")
+
+	// 届く前の約定では約定しない
+	trade(50, 99)
+	if orders, _ := dm.ActiveOrders("BTC_JPY"); len(orders) != 0 {
+		t.Fatalf("order must not be live yet: %+v", orders)
+	}
+	trade(100, 100)
+	if orders, _ := dm.ActiveOrders("BTC_JPY"); len(orders) != 1 {
+		t.Fatalf("order must be live: %+v", orders)
+	}
+
+	// 取消が届く前に約定する
+	trade(120, 100)
+	dm.CancelOrder("BTC_JPY", "0")
+	trade(150, 99)
+	trade(170, 100)
+	if s, _ := dm.Stocks("BTC_JPY"); !near(s.Summary, 1) {
+		t.Fatalf("stock %+v", s)
+	}
+	if ev, _ := stream.Read(); ev == nil || ev.Type != orderevent.Filled || !ev.Fill.IsMaker {
+		t.Fatalf("event %+v", ev)
+	}
+	if ev, _ := stream.Read(); ev == nil || ev.Type != orderevent.CancelRejected {
+		t.Fatalf("event %+v", ev)
+	}
+}
+
+func TestCancelEvents(t *testing.T) {
+	for _, latency := range []Latency{nil, FixedLatency(50 * time.Millisecond)} {
+		param := map[string]interface{}{"symbol": "BTC_JPY"}
+		if latency != nil {
+			param["cancelLatency"] = latency
+		}
+		ex, _ := New(exchange.Key{SpecificParam: param})
+		dm := ex.(*dummy)
+		stream, _ := NewPrivateStream(ex)
+		start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		dm.UpdateTime(start)
+		dm.UpdateBestPrice(101, 99)
+		dm.CreateOrder(90, 1, true, "BTC_JPY", "LIMIT")
+		dm.CreateOrder(110, 2, false, "BTC_JPY", "LIMIT")
+		dm.CreateOrder(91, 1, true, "BTC_JPY", "LIMIT")
+
+		// 遅延の有無によらず取消はイベントになる
+		dm.CancelOrder("BTC_JPY", "0")
+		dm.CancelAllOrder("BTC_JPY")
+		dm.UpdateTime(start.Add(time.Second))
+		// 遅延があれば全取消が届く前に取り消した注文は取消拒否になる
+		got := []string{}
+		for ev, _ := stream.Read(); ev != nil; ev, _ = stream.Read() {
+			if ev.Type == orderevent.Canceled {
+				got = append(got, ev.ID.LocalID)
+			}
+		}
+		if strings.Join(got, ",") != "0,2,1" {
+			t.Fatalf("latency %v: canceled %v", latency, got)
+		}
+		if orders, _ := dm.ActiveOrders("BTC_JPY"); len(orders) != 0 {
+			t.Fatalf("orders %+v", orders)
+		}
+	}
+}
+
+func TestFeeSchedule(t *testing.T) {
+	ex, err := New(exchange.Key{SpecificParam: map[string]interface{}{"simulate": "bitbank"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dm := ex.(*dummy)
+	dm.UpdateBestPrice(100, 99)
+	dm.CreateOrder(0, 1, true, "BTC_JPY", "MARKET")
+	dm.CreateOrder(110, 0.5, false, "BTC_JPY", "LIMIT")
+	dm.UpdateLTP(111)
+
+	// bitbankの手数料はBTCで払い, メイカーはリベートを受け取る
+	if !near(dm.balances["BTC"], 1-0.0012-0.5+0.5*0.0002) || !near(dm.balances["JPY"], -100+55) {
+		t.Fatalf("balances %+v", dm.balances)
+	}
+
+	tiered := TieredFee{Tiers: []FeeTier{{Volume: 0, Taker: 0.002}, {Volume: 1000, Taker: 0.001, Maker: -0.0001}}}
+	if amount, currency := tiered.Fee(Trade{Quote: "USD", Price: 10, Size: 1, QuoteVolume: 1000}); !near(amount, 0.01) || currency != "USD" {
+		t.Errorf("fee %f %s", amount, currency)
+	}
+	// 現物とレバレッジ取引は手数料が違う
+	for _, c := range []struct {
+		name, symbol string
+		want         float64
+	}{
+		{"bitflyer", "FX_BTC_JPY", 0},
+		{"bitflyer", "BTC_JPY", 0.0015 * 5000000 * 0.1},
+		{"gmo", "BTC_JPY", 0},
+		{"gmo", "BTC", 0.0005 * 5000000 * 0.1},
+	} {
+		model, _ := FeeSchedule(c.name)
+		amount, currency := model.Fee(Trade{Symbol: c.symbol, Base: "BTC", Quote: "JPY", Price: 5000000, Size: 0.1})
+		if !near(amount, c.want) || currency != "JPY" {
+			t.Errorf("%s %s fee %f %s", c.name, c.symbol, amount, currency)
+		}
+	}
+	fx, _ := New(exchange.Key{SpecificParam: map[string]interface{}{"simulate": "bitflyer", "symbol": "FX_BTC_JPY"}})
+	fx.UpdateBestPrice(5000000, 4999000)
+	fx.CreateOrder(0, 0.1, true, "FX_BTC_JPY", "MARKET")
+	if balances := fx.(*dummy).balances; !near(balances["JPY"], -500000) {
+		t.Errorf("fx balances %+v", balances)
+	}
+	if _, err := FeeSchedule("unknown"); err == nil {
+		t.Error("unknown exchange must fail")
+	}
+}
+
+func TestSnapshotAndEventLog(t *testing.T) {
+	param := func() map[string]interface{} {
+		return map[string]interface{}{
+			"margin":       true,
+			"leverage":     10.0,
+			"balances":     map[string]float64{"JPY": 1000},
+			"entryLatency": NormalLatency{Mean: 10 * time.Millisecond, StdDev: 5 * time.Millisecond},
+		}
+	}
+	logged := param()
+	log := &bytes.Buffer{}
+	logged["eventLog"] = log
+	ex, _ := New(exchange.Key{SpecificParam: logged})
+	dm := ex.(*dummy)
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	dm.UpdateTime(start)
+	dm.UpdateBoard(board.Board{
+		Symbol: "FX_BTC_JPY",
+		Asks:   []base.Norm{{Price: 101, Size: 2}},
+		Bids:   []base.Norm{{Price: 99, Size: 2}},
+	})
+	initial, _ := dm.Snapshot()
+	log.Reset()
+
+	for i := 0; i < 20; i++ {
+		dm.CreateOrder(98+float64(i%5), 0.5, i%2 == 0, "FX_BTC_JPY", "LIMIT")
+		dm.UpdateExecution(execution.Execution{
+			ID:        id.NewID("bitflyer", "FX_BTC_JPY", fmt.Sprint(i)),
+			Norm:      base.Norm{Price: 97 + float64(i%7), Size: 0.3},
+			OccuredAt: start.Add(time.Duration(i) * 7 * time.Millisecond),
+		})
+	}
+	if !strings.Contains(log.String(), `"kind":"fill"`) {
+		t.Fatal("no fill is logged")
+	}
+	final, _ := dm.Snapshot()
+	if err := dm.EventLogErr(); err != nil {
+		t.Fatal(err)
+	}
+
+	// スナップショットからログを再生すると同じ状態になる
+	replayed, _ := New(exchange.Key{SpecificParam: param()})
+	if err := replayed.(Snapshotter).Restore(initial); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplayLog(replayed, log); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := replayed.(Snapshotter).Snapshot(); !bytes.Equal(got, final) {
+		t.Fatal("replayed state differs")
+	}
+
+	restored, _ := New(exchange.Key{SpecificParam: param()})
+	restored.(Snapshotter).Restore(final)
+	if got, _ := restored.(Snapshotter).Snapshot(); !bytes.Equal(got, final) {
+		t.Fatal("restored state differs")
+	}
+}
+
+func TestOrderFlags(t *testing.T) {
+	ex, _ := New(exchange.Key{})
+	dm := ex.(*dummy)
+	dm.UpdateBoard(board.Board{
+		Asks: []base.Norm{{Price: 101, Size: 1}, {Price: 102, Size: 1}},
+		Bids: []base.Norm{{Price: 99, Size: 1}},
+	})
+
+	if _, err := dm.CreateOrder(101, 1, true, "BTC_JPY", OrderType("LIMIT", PostOnly)); err != ErrPostOnlyWouldTake {
+		t.Fatalf("post only must be rejected: %v", err)
+	}
+	res, err := dm.CreateOrder(100, 1, true, "BTC_JPY", OrderType("LIMIT", PostOnly))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 訂正しても条件は保たれ, 拒否されたら元の注文が残る
+	if _, err := dm.EditOrder("BTC_JPY", res.ID.LocalID, 101, 1); err != ErrPostOnlyWouldTake {
+		t.Fatalf("edit must keep post only: %v", err)
+	}
+	orders, _ := dm.ActiveOrders("BTC_JPY")
+	if len(orders) != 1 || orders[0].Price != 100 || orders[0].OrderType != "LIMIT:POST_ONLY" {
+		t.Fatalf("orders %+v", orders)
+	}
+
+	if _, err := dm.CreateOrder(102, 3, true, "BTC_JPY", OrderType("LIMIT", FOK)); err != ErrFOKNotFilled {
+		t.Fatalf("fok must be rejected: %v", err)
+	}
+	res, err = dm.CreateOrder(102, 3, true, "BTC_JPY", OrderType("LIMIT", IOC))
+	if err != nil || !near(res.FilledSize, 2) {
+		t.Fatalf("ioc %+v %v", res, err)
+	}
+	if orders, _ := dm.ActiveOrders("BTC_JPY"); len(orders) != 1 {
+		t.Fatalf("ioc must not rest: %+v", orders)
+	}
+
+	// 買い建玉2に対して買いの決済注文は拒否, 売りは建玉まで減らす
+	if _, err := dm.CreateOrder(0, 1, true, "BTC_JPY", OrderType("MARKET", ReduceOnly)); err != ErrReduceOnly {
+		t.Fatalf("reduce only must be rejected: %v", err)
+	}
+	dm.UpdateBoard(board.Board{Bids: []base.Norm{{Price: 99, Size: 5}}})
+	res, err = dm.CreateOrder(0, 5, false, "BTC_JPY", OrderType("MARKET", ReduceOnly))
+	if err != nil || !near(res.FilledSize, 2) {
+		t.Fatalf("reduce only %+v %v", res, err)
+	}
+	if _, err := dm.CreateOrder(100, 1, true, "BTC_JPY", "LIMIT:GTD"); err == nil {
+		t.Error("unknown flag must fail")
+	}
+}
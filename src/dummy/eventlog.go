@@ -0,0 +1,119 @@
+package dummy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/interface/exchange"
+)
+
+// kinds of LogEntry. Fill is an output and the others are inputs.
+const (
+	LogCreateOrder     = "create_order"
+	LogEditOrder       = "edit_order"
+	LogCancelOrder     = "cancel_order"
+	LogCancelAllOrder  = "cancel_all_order"
+	LogUpdateLTP       = "update_ltp"
+	LogUpdateBestPrice = "update_best_price"
+	LogUpdateBoard     = "update_board"
+	LogUpdateExecution = "update_execution"
+	LogUpdateTime      = "update_time"
+	LogUpdateIndex     = "update_index_price"
+	LogFill            = "fill"
+)
+
+// LogEntry a line of the event log. SpecificParam eventLog : io.Writer
+// only fields of the Kind are set.
+type LogEntry struct {
+	Seq       int                  `json:"seq"`
+	Kind      string               `json:"kind"`
+	Symbol    string               `json:"symbol,omitempty"`
+	LocalID   string               `json:"local_id,omitempty"`
+	IsBuy     bool                 `json:"is_buy,omitempty"`
+	OrderType string               `json:"order_type,omitempty"`
+	Price     float64              `json:"price,omitempty"`
+	Size      float64              `json:"size,omitempty"`
+	BestAsk   float64              `json:"best_ask,omitempty"`
+	BestBid   float64              `json:"best_bid,omitempty"`
+	Board     *board.Board         `json:"board,omitempty"`
+	Execution *execution.Execution `json:"execution,omitempty"`
+	Time      *time.Time           `json:"time,omitempty"`
+	// fill
+	IsMaker     bool    `json:"is_maker,omitempty"`
+	Fee         float64 `json:"fee,omitempty"`
+	FeeCurrency string  `json:"fee_currency,omitempty"`
+}
+
+// EventLogErr first error of writing the event log. the log is stopped after an error.
+func (dm *dummy) EventLogErr() error {
+	return dm.logErr
+}
+
+// log 番号はログの有無に関わらず進めて, 状態を同じにする
+func (dm *dummy) log(e LogEntry) {
+	dm.logSeq++
+	if dm.logWriter == nil || dm.logErr != nil {
+		return
+	}
+	e.Seq = dm.logSeq
+	line, err := json.Marshal(e)
+	if err == nil {
+		_, err = dm.logWriter.Write(append(line, '\n'))
+	}
+	if err != nil {
+		dm.logErr = err
+	}
+}
+
+// ReplayLog apply inputs of the event log to ex, a dummy created with the same SpecificParam
+// (and restored from the snapshot the log starts from). the state is reproduced exactly.
+func ReplayLog(ex exchange.Exchange, r io.Reader) error {
+	dm, ok := ex.(*dummy)
+	if !ok {
+		return errors.New("exchange is not dummy.")
+	}
+	decoder := json.NewDecoder(r)
+	for {
+		e := LogEntry{}
+		err := decoder.Decode(&e)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// 元の呼び出しと同じエラーになるので結果は見ない
+		switch e.Kind {
+		case LogCreateOrder:
+			dm.CreateOrder(e.Price, e.Size, e.IsBuy, e.Symbol, e.OrderType)
+		case LogEditOrder:
+			dm.EditOrder(e.Symbol, e.LocalID, e.Price, e.Size)
+		case LogCancelOrder:
+			dm.CancelOrder(e.Symbol, e.LocalID)
+		case LogCancelAllOrder:
+			dm.CancelAllOrder(e.Symbol)
+		case LogUpdateLTP:
+			dm.UpdateSymbolLTP(e.Symbol, e.Price)
+		case LogUpdateBestPrice:
+			dm.UpdateSymbolBestPrice(e.Symbol, e.BestAsk, e.BestBid)
+		case LogUpdateBoard:
+			if e.Board != nil {
+				dm.UpdateBoard(*e.Board)
+			}
+		case LogUpdateExecution:
+			if e.Execution != nil {
+				dm.UpdateExecution(*e.Execution)
+			}
+		case LogUpdateTime:
+			if e.Time != nil {
+				dm.UpdateTime(*e.Time)
+			}
+		case LogUpdateIndex:
+			dm.UpdateIndexPrice(e.Symbol, e.Price)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package dummy
+
+import (
+	"fmt"
+	"math"
+)
+
+// Trade own fill given to FeeModel.
+type Trade struct {
+	Symbol  string
+	Base    string
+	Quote   string
+	IsBuy   bool
+	IsMaker bool
+	Price   float64
+	Size    float64
+	// BaseVolume, QuoteVolume own traded volume of the symbol before this trade.
+	// tiers are decided by the volume of the whole simulation, not by a rolling window.
+	BaseVolume  float64
+	QuoteVolume float64
+}
+
+// FeeModel fee of a fill. amount is paid in currency, negative amount is a rebate.
+// SpecificParam feeModel : dummy.FeeModel
+type FeeModel interface {
+	Fee(t Trade) (amount float64, currency string)
+}
+
+// FlatFee same rates for all fills.
+type FlatFee struct {
+	Maker float64
+	Taker float64
+	// InBase fee is paid in the base currency. e.g. bitbank
+	InBase bool
+	// Min minimum fee of a fill in the fee currency. rebates are not affected.
+	Min float64
+}
+
+func (f FlatFee) Fee(t Trade) (float64, string) {
+	rate := f.Taker
+	if t.IsMaker {
+		rate = f.Maker
+	}
+	return fee(t, rate, f.InBase, f.Min)
+}
+
+// FeeTier rates applied from Volume.
+type FeeTier struct {
+	Volume float64
+	Maker  float64
+	Taker  float64
+}
+
+// TieredFee rates by own traded volume. Tiers are in ascending order of Volume.
+type TieredFee struct {
+	Tiers []FeeTier
+	// ByBaseVolume tiers are decided by base volume (e.g. bitflyer BTC volume). quote volume by default.
+	ByBaseVolume bool
+	InBase       bool
+	Min          float64
+}
+
+func (f TieredFee) Fee(t Trade) (float64, string) {
+	volume := t.QuoteVolume
+	if f.ByBaseVolume {
+		volume = t.BaseVolume
+	}
+	tier := FeeTier{}
+	for _, v := range f.Tiers {
+		if volume < v.Volume {
+			break
+		}
+		tier = v
+	}
+	rate := tier.Taker
+	if t.IsMaker {
+		rate = tier.Maker
+	}
+	return fee(t, rate, f.InBase, f.Min)
+}
+
+// SymbolFee fee models by symbol, e.g. for derivatives without fees next to spot.
+type SymbolFee struct {
+	Symbols map[string]FeeModel
+	// Default fee model of the other symbols.
+	Default FeeModel
+}
+
+func (f SymbolFee) Fee(t Trade) (float64, string) {
+	if m, ok := f.Symbols[t.Symbol]; ok {
+		return m.Fee(t)
+	}
+	return f.Default.Fee(t)
+}
+
+func fee(t Trade, rate float64, inBase bool, min float64) (float64, string) {
+	amount, currency := rate*t.Price*t.Size, t.Quote
+	if inBase {
+		amount, currency = rate*t.Size, t.Base
+	}
+	if amount >= 0 && amount < min {
+		amount = min
+	}
+	return amount, currency
+}
+
+// FeeSchedule fee model of the exchange by the published schedule (2021). check the venue before relying on it.
+// name is the ExchangeName of the adapter. SpecificParam simulate : string
+func FeeSchedule(name string) (FeeModel, error) {
+	switch name {
+	case "bitflyer":
+		// 現物は直近30日のBTC取引量で決まる. Lightning FXは手数料なし
+		spot := TieredFee{
+			ByBaseVolume: true,
+			Tiers: []FeeTier{
+				{Volume: 0, Maker: 0.0015, Taker: 0.0015},
+				{Volume: 0.1, Maker: 0.0014, Taker: 0.0014},
+				{Volume: 1, Maker: 0.0013, Taker: 0.0013},
+				{Volume: 10, Maker: 0.0012, Taker: 0.0012},
+				{Volume: 50, Maker: 0.0011, Taker: 0.0011},
+				{Volume: 100, Maker: 0.0010, Taker: 0.0010},
+				{Volume: 200, Maker: 0.0009, Taker: 0.0009},
+				{Volume: 500, Maker: 0.0007, Taker: 0.0007},
+				{Volume: 1000, Maker: 0.0005, Taker: 0.0005},
+				{Volume: 2000, Maker: 0.0003, Taker: 0.0003},
+				{Volume: 5000, Maker: 0.0001, Taker: 0.0001},
+			},
+		}
+		return SymbolFee{Symbols: map[string]FeeModel{"FX_BTC_JPY": FlatFee{}}, Default: spot}, nil
+	case "bitbank":
+		return FlatFee{Maker: -0.0002, Taker: 0.0012, InBase: true}, nil
+	case "bybit":
+		return FlatFee{Maker: -0.00025, Taker: 0.00075}, nil
+	case "ftx":
+		// 直近30日のUSD取引量で決まる
+		return TieredFee{
+			Tiers: []FeeTier{
+				{Volume: 0, Maker: 0.0002, Taker: 0.0007},
+				{Volume: 2000000, Maker: 0.00015, Taker: 0.0006},
+				{Volume: 5000000, Maker: 0.0001, Taker: 0.00055},
+				{Volume: 10000000, Maker: 0.00005, Taker: 0.0005},
+				{Volume: 25000000, Maker: 0, Taker: 0.00045},
+				{Volume: 50000000, Maker: 0, Taker: 0.0004},
+			},
+		}, nil
+	case "gmo":
+		// 現物はBTC, レバレッジ取引はBTC_JPYの形の銘柄で, 取引手数料なし
+		leverage := map[string]FeeModel{}
+		for _, symbol := range []string{"BTC_JPY", "ETH_JPY", "BCH_JPY", "LTC_JPY", "XRP_JPY"} {
+			leverage[symbol] = FlatFee{}
+		}
+		return SymbolFee{Symbols: leverage, Default: FlatFee{Maker: -0.0001, Taker: 0.0005}}, nil
+	case "coincheck":
+		return FlatFee{}, nil
+	case "liquid":
+		return FlatFee{Maker: 0.001, Taker: 0.001}, nil
+	}
+	return nil, fmt.Errorf("fee schedule of %s not supported.", name)
+}
+
+// chargeFee pay the fee of a fill and count own volume. returns the fee paid.
+func (dm *dummy) chargeFee(m *market, isBuy, isMaker bool, price, size float64) (float64, string) {
+	amount, currency := dm.feeModel.Fee(Trade{
+		Symbol:      m.symbol,
+		Base:        m.base,
+		Quote:       m.quote,
+		IsBuy:       isBuy,
+		IsMaker:     isMaker,
+		Price:       price,
+		Size:        size,
+		BaseVolume:  m.baseVolume,
+		QuoteVolume: m.quoteVolume,
+	})
+	m.baseVolume += size
+	m.quoteVolume += math.Abs(price * size)
+	if dm.margin.enabled && currency == m.base {
+		// 証拠金取引の損益は決済通貨で管理する
+		amount, currency = amount*price, m.quote
+	}
+	dm.balances[currency] -= amount
+	return amount, currency
+}
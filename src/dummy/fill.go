@@ -0,0 +1,81 @@
+package dummy
+
+import (
+	"math"
+
+	"github.com/TTRSQ/ccew/domains/base"
+)
+
+// RestingOrder resting own order given to FillModel.
+type RestingOrder struct {
+	Price float64
+	Size  float64
+	// QueueAhead size queued ahead of the order. LevelSize is the size of the level seen last.
+	QueueAhead float64
+	LevelSize  float64
+}
+
+// FillModel decide fills of own orders.
+// SpecificParam fillModel : dummy.FillModel
+type FillModel interface {
+	// Take fills of an order crossing the board. levels are sorted from the best price.
+	// limit is ignored for market orders. fills must be in the order of levels.
+	Take(levels []base.Norm, isBuy bool, limit, size float64, market bool) []base.Norm
+	// Resting size of the resting order filled by a trade of volume at price
+	// and the volume consumed including the queue ahead. the model may update the queue of o.
+	Resting(o *RestingOrder, isBuy bool, price, volume float64) (filled, consumed float64)
+}
+
+// BoardFill walk the board for takers and fill resting orders by the volume traded through their price.
+// with QueuePosition, trades at the order price fill it after the queue ahead is consumed.
+type BoardFill struct {
+	QueuePosition bool
+}
+
+func (f BoardFill) Take(levels []base.Norm, isBuy bool, limit, size float64, market bool) []base.Norm {
+	fills := []base.Norm{}
+	filled := 0.0
+	for _, level := range levels {
+		if size-filled <= sizeEpsilon {
+			break
+		}
+		if !market && ((isBuy && level.Price > limit) || (!isBuy && level.Price < limit)) {
+			break
+		}
+		q := math.Min(level.Size, size-filled)
+		fills = append(fills, base.Norm{Price: level.Price, Size: q})
+		filled += q
+	}
+	return fills
+}
+
+func (f BoardFill) Resting(o *RestingOrder, isBuy bool, price, volume float64) (float64, float64) {
+	through := (isBuy && price < o.Price) || (!isBuy && price > o.Price)
+	atPrice := f.QueuePosition && price == o.Price
+	if !(through || atPrice) {
+		return 0, 0
+	}
+	consumed := 0.0
+	if atPrice {
+		consumed = math.Min(o.QueueAhead, volume)
+		o.QueueAhead -= consumed
+		o.LevelSize = math.Max(0, o.LevelSize-consumed)
+	}
+	q := math.Min(o.Size, volume-consumed)
+	return q, consumed + q
+}
+
+// TouchFill fill resting orders entirely once a trade touches their price, regardless of volume.
+// takers walk the board like BoardFill. it is optimistic and close to the old UpdateLTP behavior.
+type TouchFill struct{}
+
+func (f TouchFill) Take(levels []base.Norm, isBuy bool, limit, size float64, market bool) []base.Norm {
+	return BoardFill{}.Take(levels, isBuy, limit, size, market)
+}
+
+func (f TouchFill) Resting(o *RestingOrder, isBuy bool, price, volume float64) (float64, float64) {
+	if (isBuy && price <= o.Price) || (!isBuy && price >= o.Price) {
+		return o.Size, 0
+	}
+	return 0, 0
+}
@@ -0,0 +1,161 @@
+package dummy
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Funding cost schedule of a symbol. e.g. perpetual funding, FX swap points, leverage fee and borrow cost.
+// SpecificParam funding : []dummy.Funding
+type Funding struct {
+	Symbol string
+	// Interval, Offset settlement times are every Interval from UTC midnight shifted by Offset.
+	// e.g. bybit 8h, FTX 1h, bitflyer swap 24h
+	Interval time.Duration
+	Offset   time.Duration
+	// Rate fixed rate per settlement. positive rate means long pays and short receives.
+	Rate float64
+	// Rates time series of rates in time order. the last rate at or before the settlement is used instead of Rate.
+	Rates []FundingRate
+	// IndexPremium add premium of the mark price to the index price given by UpdateIndexPrice.
+	// the premium is clamped by PremiumCap if PremiumCap is positive.
+	IndexPremium bool
+	PremiumCap   float64
+	// Fee both long and short pay the absolute rate. e.g. GMO leverage fee.
+	Fee bool
+}
+
+// FundingRate rate effective from Time.
+type FundingRate struct {
+	Time time.Time
+	Rate float64
+}
+
+// FundingPayment a settlement recorded in the ledger. Amount is positive when received.
+type FundingPayment struct {
+	Time     time.Time
+	Symbol   string
+	Currency string
+	Rate     float64
+	Position float64
+	Price    float64
+	Amount   float64
+}
+
+// FundingAccount the dummy implements it.
+type FundingAccount interface {
+	// UpdateIndexPrice index price used by Funding.IndexPremium.
+	UpdateIndexPrice(symbol string, price float64) error
+	// Ledger payments in settlement order.
+	Ledger() []FundingPayment
+}
+
+func validateFundings(fundings []Funding) error {
+	for _, f := range fundings {
+		if f.Interval <= 0 {
+			return fmt.Errorf("funding interval of %s must be positive.", f.Symbol)
+		}
+	}
+	return nil
+}
+
+func (dm *dummy) UpdateIndexPrice(symbol string, price float64) error {
+	dm.log(LogEntry{Kind: LogUpdateIndex, Symbol: symbol, Price: price})
+	if symbol == "" {
+		symbol = dm.symbol
+	}
+	dm.indexPrices[symbol] = price
+	return nil
+}
+
+func (dm *dummy) Ledger() []FundingPayment {
+	return append([]FundingPayment{}, dm.ledger...)
+}
+
+// UpdateTime advance the event time. settlements until t are paid.
+func (dm *dummy) UpdateTime(t time.Time) error {
+	dm.log(LogEntry{Kind: LogUpdateTime, Time: &t})
+	dm.advance(t)
+	return nil
+}
+
+// advance 時刻を進め, 間に届くリクエストと精算を時刻順に処理する
+func (dm *dummy) advance(t time.Time) {
+	for len(dm.pending) > 0 && !dm.pending[0].at.After(t) {
+		req := dm.pending[0]
+		dm.pending = dm.pending[1:]
+		dm.settleUntil(req.at)
+		dm.process(req)
+	}
+	dm.settleUntil(t)
+}
+
+// settleUntil 時刻を進め, 間にある精算を行う. 最初の時刻より前の精算は行わない
+func (dm *dummy) settleUntil(t time.Time) {
+	if !t.After(dm.now) {
+		return
+	}
+	if !dm.now.IsZero() {
+		for i := range dm.fundings {
+			f := &dm.fundings[i]
+			for at := f.next(dm.now); !at.After(t); at = at.Add(f.Interval) {
+				dm.settleFunding(f, at)
+			}
+		}
+	}
+	dm.now = t
+}
+
+// next first settlement time after t.
+func (f *Funding) next(t time.Time) time.Time {
+	origin := time.Unix(0, 0).Add(f.Offset)
+	n := t.Sub(origin) / f.Interval
+	at := origin.Add(n * f.Interval)
+	for !at.After(t) {
+		at = at.Add(f.Interval)
+	}
+	return at
+}
+
+func (dm *dummy) settleFunding(f *Funding, at time.Time) {
+	// 取引していない銘柄は精算しない. 既定の銘柄を乗っ取らないように作らない
+	m, ok := dm.lookup(f.Symbol)
+	if !ok || math.Abs(m.position) <= sizeEpsilon || m.quote == "" {
+		return
+	}
+	price := m.markPrice()
+	rate := dm.fundingRate(f, m, at)
+	amount := -m.position * price * rate
+	if f.Fee {
+		amount = -math.Abs(m.position * price * rate)
+	}
+	dm.balances[m.quote] += amount
+	dm.ledger = append(dm.ledger, FundingPayment{
+		Time:     at,
+		Symbol:   m.symbol,
+		Currency: m.quote,
+		Rate:     rate,
+		Position: m.position,
+		Price:    price,
+		Amount:   amount,
+	})
+}
+
+func (dm *dummy) fundingRate(f *Funding, m *market, at time.Time) float64 {
+	rate := f.Rate
+	for _, r := range f.Rates {
+		if r.Time.After(at) {
+			break
+		}
+		rate = r.Rate
+	}
+	if index := dm.indexPrices[m.symbol]; f.IndexPremium && index > 0 {
+		premium := (m.markPrice() - index) / index
+		if f.PremiumCap > 0 {
+			premium = math.Max(-f.PremiumCap, math.Min(premium, f.PremiumCap))
+		}
+		rate += premium
+	}
+	return rate
+}
@@ -0,0 +1,146 @@
+package dummy
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+)
+
+// Latency delay until a request reaches the exchange.
+// SpecificParam entryLatency, cancelLatency, editLatency : dummy.Latency, latencySeed : int64
+// requests arrive when UpdateExecution or UpdateTime passes the delay. UpdateBoard, UpdateLTP and
+// UpdateBestPrice have no time and do not advance the clock.
+type Latency interface {
+	Sample(r *rand.Rand) time.Duration
+}
+
+// FixedLatency always the same delay.
+type FixedLatency time.Duration
+
+func (l FixedLatency) Sample(r *rand.Rand) time.Duration {
+	return time.Duration(l)
+}
+
+// NormalLatency normally distributed delay. samples below Min are Min.
+type NormalLatency struct {
+	Mean   time.Duration
+	StdDev time.Duration
+	Min    time.Duration
+}
+
+func (l NormalLatency) Sample(r *rand.Rand) time.Duration {
+	d := l.Mean + time.Duration(r.NormFloat64()*float64(l.StdDev))
+	if d < l.Min {
+		return l.Min
+	}
+	return d
+}
+
+// HistogramLatency empirical delay. Delays are drawn with Weights, equally if Weights is empty.
+type HistogramLatency struct {
+	Delays  []time.Duration
+	Weights []float64
+}
+
+func (l HistogramLatency) Sample(r *rand.Rand) time.Duration {
+	if len(l.Delays) == 0 {
+		return 0
+	}
+	if len(l.Weights) != len(l.Delays) {
+		return l.Delays[r.Intn(len(l.Delays))]
+	}
+	total := 0.0
+	for _, w := range l.Weights {
+		total += w
+	}
+	x := r.Float64() * total
+	for i, w := range l.Weights {
+		if x < w {
+			return l.Delays[i]
+		}
+		x -= w
+	}
+	return l.Delays[len(l.Delays)-1]
+}
+
+// request kinds delayed by latency.
+const (
+	entryRequest = iota
+	cancelRequest
+	editRequest
+)
+
+// pendingRequest 取引所に届く前のリクエスト
+type pendingRequest struct {
+	at        time.Time
+	seq       int
+	kind      int
+	symbol    string
+	localID   string
+	price     float64
+	size      float64
+	isBuy     bool
+	orderType string
+}
+
+func (dm *dummy) latency(l Latency) time.Duration {
+	if l == nil {
+		return 0
+	}
+	d := l.Sample(dm.rand)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// delay queue the request to be processed after the latency on the event clock.
+func (dm *dummy) delay(l Latency, req pendingRequest) {
+	dm.requestSeq++
+	req.seq = dm.requestSeq
+	req.at = dm.now.Add(dm.latency(l))
+	dm.pending = append(dm.pending, req)
+	sort.SliceStable(dm.pending, func(i, j int) bool {
+		if dm.pending[i].at.Equal(dm.pending[j].at) {
+			return dm.pending[i].seq < dm.pending[j].seq
+		}
+		return dm.pending[i].at.Before(dm.pending[j].at)
+	})
+}
+
+// process requests arrived at the exchange. errors are reported as events.
+func (dm *dummy) process(req pendingRequest) {
+	switch req.kind {
+	case entryRequest:
+		if _, err := dm.enterOrder(req.localID, req.price, req.size, req.isBuy, req.symbol, req.orderType); err != nil {
+			dm.emitRequest(req, orderevent.Rejected, err)
+		}
+	case cancelRequest:
+		if !dm.cancel(dm.market(req.symbol), req.localID) {
+			dm.emitRequest(req, orderevent.CancelRejected, errors.New("order not found."))
+		}
+	case editRequest:
+		if _, err := dm.replaceOrder(dm.market(req.symbol), req.localID, req.price, req.size); err != nil {
+			dm.emitRequest(req, orderevent.Rejected, err)
+		}
+	}
+}
+
+func (dm *dummy) emitRequest(req pendingRequest, typ orderevent.Type, err error) {
+	dm.emit(orderevent.Event{
+		ID:        id.NewID(dm.name, dm.market(req.symbol).symbol, req.localID),
+		Type:      typ,
+		IsBuy:     req.isBuy,
+		OrderType: req.orderType,
+		Norm: base.Norm{
+			Price: req.price,
+			Size:  req.size,
+		},
+		Reason: err.Error(),
+	})
+}
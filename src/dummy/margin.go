@@ -0,0 +1,257 @@
+package dummy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+)
+
+// MarginStatus collateral and margin of a collateral currency.
+type MarginStatus struct {
+	Currency string
+	// Collateral balance of the currency. realized pnl and fees are included.
+	Collateral    float64
+	UnrealizedPnL float64
+	// Equity Collateral + UnrealizedPnL
+	Equity float64
+	// InitialMargin margin of positions and resting orders by the initial margin rate.
+	InitialMargin float64
+	// MaintenanceMargin margin of positions by the maintenance margin rate.
+	MaintenanceMargin float64
+	// FreeMargin Equity - InitialMargin. orders are rejected if it goes negative.
+	FreeMargin float64
+}
+
+// MarginAccount the dummy implements it. available in margin mode.
+type MarginAccount interface {
+	Margin(currency string) (MarginStatus, error)
+}
+
+// marginConfig SpecificParam margin, leverage, initialMarginRate, maintenanceMarginRate, liquidationSlippage
+type marginConfig struct {
+	enabled bool
+	// initialRate, maintenanceRate 建玉の価値に対する証拠金の割合
+	initialRate     float64
+	maintenanceRate float64
+	// slippage 強制決済は評価価格からこの割合だけ不利な価格で約定する
+	slippage float64
+}
+
+func newMarginConfig(param map[string]interface{}) (marginConfig, error) {
+	c := marginConfig{}
+	if param["margin"] != nil {
+		c.enabled = param["margin"].(bool)
+	}
+	leverage := 1.0
+	if param["leverage"] != nil {
+		leverage = param["leverage"].(float64)
+	}
+	if leverage <= 0 {
+		return c, errors.New("leverage must be positive.")
+	}
+	c.initialRate = 1 / leverage
+	if param["initialMarginRate"] != nil {
+		c.initialRate = param["initialMarginRate"].(float64)
+	}
+	c.maintenanceRate = c.initialRate / 2
+	if param["maintenanceMarginRate"] != nil {
+		c.maintenanceRate = param["maintenanceMarginRate"].(float64)
+	}
+	if c.initialRate <= 0 || c.maintenanceRate <= 0 || c.maintenanceRate > c.initialRate {
+		return c, fmt.Errorf("invalid margin rates initial:%f maintenance:%f.", c.initialRate, c.maintenanceRate)
+	}
+	if param["liquidationSlippage"] != nil {
+		c.slippage = param["liquidationSlippage"].(float64)
+	}
+	return c, nil
+}
+
+// Margin return margin status of the collateral currency.
+func (dm *dummy) Margin(currency string) (MarginStatus, error) {
+	if !dm.margin.enabled {
+		return MarginStatus{}, errors.New("margin mode is disabled.")
+	}
+	status := MarginStatus{Currency: currency, Collateral: dm.balances[currency]}
+	for _, m := range dm.marginMarkets(currency) {
+		status.UnrealizedPnL += m.unrealizedPnL()
+		status.InitialMargin += m.exposure(0, 0, false) * dm.margin.initialRate
+		status.MaintenanceMargin += math.Abs(m.position) * m.markPrice() * dm.margin.maintenanceRate
+	}
+	status.Equity = status.Collateral + status.UnrealizedPnL
+	status.FreeMargin = status.Equity - status.InitialMargin
+	return status, nil
+}
+
+// checkMargin reject the order if it increases the initial margin beyond the equity.
+// orders reducing the position are always accepted.
+func (dm *dummy) checkMargin(m *market, isBuy bool, price, size float64) error {
+	if !dm.margin.enabled {
+		return nil
+	}
+	if price == 0 {
+		// 成行は最良気配で見積もる
+		price = m.bestAsk
+		if !isBuy {
+			price = m.bestBid
+		}
+	}
+	status, err := dm.Margin(m.quote)
+	if err != nil {
+		return err
+	}
+	before := m.exposure(0, 0, false) * dm.margin.initialRate
+	after := m.exposure(price, size, isBuy) * dm.margin.initialRate
+	if after > before && status.FreeMargin-(after-before) < 0 {
+		return fmt.Errorf("insufficient margin. free:%f required:%f", status.FreeMargin, after-before)
+	}
+	return nil
+}
+
+// checkLiquidation close all positions of a collateral currency whose equity is below the maintenance margin.
+func (dm *dummy) checkLiquidation() {
+	if !dm.margin.enabled {
+		return
+	}
+	currencies := map[string]bool{}
+	for _, m := range dm.markets {
+		if m.quote != "" && m.position != 0 {
+			currencies[m.quote] = true
+		}
+	}
+	codes := []string{}
+	for code := range currencies {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, currency := range codes {
+		status, _ := dm.Margin(currency)
+		if status.Equity > status.MaintenanceMargin {
+			continue
+		}
+		for _, m := range dm.marginMarkets(currency) {
+			dm.liquidate(m)
+		}
+	}
+}
+
+// liquidate cancel orders and close the position of m at the mark price with slippage.
+func (dm *dummy) liquidate(m *market) {
+	m.buyReqs = []boardElm{}
+	m.sellReqs = []boardElm{}
+	if math.Abs(m.position) <= sizeEpsilon {
+		return
+	}
+
+	isBuy := m.position < 0
+	size := math.Abs(m.position)
+	price := m.markPrice() * (1 - dm.margin.slippage)
+	if isBuy {
+		price = m.markPrice() * (1 + dm.margin.slippage)
+	}
+	fee, feeCurrency := dm.settle(m, isBuy, false, price, size)
+
+	dm.emit(orderevent.Event{
+		ID:        id.NewID(dm.name, m.symbol, dm.incrementalID()),
+		Type:      orderevent.Liquidated,
+		IsBuy:     isBuy,
+		OrderType: dm.OrderTypes().Market,
+		Norm: base.Norm{
+			Price: price,
+			Size:  size,
+		},
+		ExecutedSize: size,
+		Fill: &orderevent.Fill{
+			Norm: base.Norm{
+				Price: price,
+				Size:  size,
+			},
+			Fee:         fee,
+			FeeCurrency: feeCurrency,
+		},
+		Reason: "equity is below the maintenance margin.",
+	})
+}
+
+// settleMargin 証拠金取引では建玉と実現損益のみ変わる
+func (dm *dummy) settleMargin(m *market, isBuy bool, price, size float64) {
+	delta := size
+	if !isBuy {
+		delta = -size
+	}
+	// 反対売買の分は損益を確定する
+	if m.position*delta < 0 {
+		closed := math.Min(math.Abs(m.position), size)
+		pnl := (price - m.entryPrice) * closed
+		if m.position < 0 {
+			pnl = -pnl
+		}
+		dm.balances[m.quote] += pnl
+	}
+	next := m.position + delta
+	switch {
+	case math.Abs(next) <= sizeEpsilon:
+		next = 0
+		m.entryPrice = 0
+	case m.position*next < 0 || m.position == 0:
+		// ドテン, 新規
+		m.entryPrice = price
+	case math.Abs(next) > math.Abs(m.position):
+		m.entryPrice = (m.entryPrice*math.Abs(m.position) + price*size) / math.Abs(next)
+	}
+	m.position = next
+}
+
+// marginMarkets markets settled in the collateral currency.
+func (dm *dummy) marginMarkets(currency string) []*market {
+	ret := []*market{}
+	for _, m := range dm.markets {
+		if m.quote == currency {
+			ret = append(ret, m)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].symbol < ret[j].symbol })
+	return ret
+}
+
+// markPrice 評価価格. LTP, 仲値, 建値の順に使う
+func (m *market) markPrice() float64 {
+	if m.ltp > 0 {
+		return m.ltp
+	}
+	if m.bestAsk > 0 && m.bestBid > 0 {
+		return (m.bestAsk + m.bestBid) / 2
+	}
+	return m.entryPrice
+}
+
+func (m *market) unrealizedPnL() float64 {
+	if m.position == 0 {
+		return 0
+	}
+	return (m.markPrice() - m.entryPrice) * m.position
+}
+
+// exposure notional value of the larger side of position and resting orders.
+// an additional order of size at price can be given.
+func (m *market) exposure(price, size float64, isBuy bool) float64 {
+	long := math.Max(m.position, 0) * m.markPrice()
+	short := math.Max(-m.position, 0) * m.markPrice()
+	for _, v := range m.buyReqs {
+		long += v.Price * v.Size
+	}
+	for _, v := range m.sellReqs {
+		short += v.Price * v.Size
+	}
+	if isBuy {
+		long += price * size
+	} else {
+		short += price * size
+	}
+	return math.Max(long, short)
+}
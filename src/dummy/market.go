@@ -0,0 +1,158 @@
+package dummy
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/TTRSQ/ccew/domains/base"
+)
+
+// defaultBestAsk 価格が届く前の売り板. 成行はpricedになるまで受け付けない
+const defaultBestAsk = 100000000
+
+// quoteCurrencies 区切りのない銘柄 (BTCUSDT) の決済通貨. 長いものから照合する
+var quoteCurrencies = []string{"USDT", "USDC", "JPY", "USD", "EUR", "BTC", "ETH"}
+
+// market state of a symbol.
+type market struct {
+	symbol string
+	// base, quote 数量の通貨と価格の通貨
+	base  string
+	quote string
+
+	position float64
+	// entryPrice 証拠金取引の建値
+	entryPrice float64
+	// baseVolume, quoteVolume 自分の約定した量. 手数料のティアに使う
+	baseVolume  float64
+	quoteVolume float64
+	ltp         float64
+	bestAsk     float64
+	bestBid     float64
+	// priced 板か最良気配か約定を受け取った
+	priced bool
+	// quoted 板か最良気配を受け取った. それまでは最終約定価格を最良気配とする
+	quoted bool
+
+	// asks, bids 成行と板にぶつかる指値が消費する板
+	asks []base.Norm
+	bids []base.Norm
+
+	buyReqs  []boardElm
+	sellReqs []boardElm
+}
+
+func newMarket(symbol string) *market {
+	m := &market{
+		symbol:   symbol,
+		buyReqs:  []boardElm{},
+		sellReqs: []boardElm{},
+	}
+	m.setBestPrice(defaultBestAsk, 0)
+	return m
+}
+
+// setBestPrice 板がなければ最良気配に無限の数量があるとみなす
+func (m *market) setBestPrice(bestAsk, bestBid float64) {
+	m.asks = []base.Norm{{Price: bestAsk, Size: math.Inf(1)}}
+	m.bids = []base.Norm{}
+	if bestBid > 0 {
+		m.bids = append(m.bids, base.Norm{Price: bestBid, Size: math.Inf(1)})
+	}
+	m.bestAsk = bestAsk
+	m.bestBid = bestBid
+}
+
+// updateLTP 板がなければ最終約定価格で成行を約定させる
+func (m *market) updateLTP(price float64) {
+	m.ltp = price
+	m.priced = true
+	if !m.quoted {
+		m.setBestPrice(price, price)
+	}
+}
+
+func (m *market) updateBestPrice() {
+	if len(m.asks) > 0 {
+		m.bestAsk = m.asks[0].Price
+	}
+	if len(m.bids) > 0 {
+		m.bestBid = m.bids[0].Price
+	}
+}
+
+// market return the state of symbol. empty symbol is the default symbol.
+// without SpecificParam symbol, the first symbol used becomes the default one
+// and takes over prices given by UpdateLTP and UpdateBestPrice until then.
+func (dm *dummy) market(symbol string) *market {
+	if symbol == "" {
+		symbol = dm.symbol
+	}
+	if m, ok := dm.markets[symbol]; ok {
+		return m
+	}
+	if dm.symbol == "" {
+		m := dm.markets[""]
+		delete(dm.markets, "")
+		m.symbol = symbol
+		dm.symbol = symbol
+		dm.markets[symbol] = m
+		return m
+	}
+	m := newMarket(symbol)
+	dm.markets[symbol] = m
+	return m
+}
+
+// lookup return the state of symbol without creating it. empty symbol is the default symbol.
+func (dm *dummy) lookup(symbol string) (*market, bool) {
+	if symbol == "" {
+		symbol = dm.symbol
+	}
+	m, ok := dm.markets[symbol]
+	return m, ok
+}
+
+// currencies return base and quote currency of the market.
+func (dm *dummy) currencies(m *market) (string, string, error) {
+	if m.base != "" {
+		return m.base, m.quote, nil
+	}
+	if c, ok := dm.symbolCurrencies[m.symbol]; ok {
+		if len(c) != 2 {
+			return "", "", fmt.Errorf("currencies of %s must be [base, quote].", m.symbol)
+		}
+		m.base, m.quote = c[0], c[1]
+		return m.base, m.quote, nil
+	}
+	baseCurrency, quoteCurrency, ok := splitSymbol(m.symbol)
+	if !ok {
+		return "", "", fmt.Errorf("currencies of %s unknown. set SpecificParam currencies.", m.symbol)
+	}
+	m.base, m.quote = baseCurrency, quoteCurrency
+	return m.base, m.quote, nil
+}
+
+// splitSymbol BTC_JPY, FX_BTC_JPY, btc_jpy, BTC/USD, BTC-PERP, BTCUSDT の通貨を取り出す
+func splitSymbol(symbol string) (string, string, bool) {
+	s := strings.TrimPrefix(strings.ToUpper(symbol), "FX_")
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return r == '_' || r == '/' || r == '-'
+	})
+	switch len(parts) {
+	case 1:
+		for _, quote := range quoteCurrencies {
+			if len(s) > len(quote) && strings.HasSuffix(s, quote) {
+				return strings.TrimSuffix(s, quote), quote, true
+			}
+		}
+	case 2:
+		// 無期限先物はUSD建て
+		if parts[1] == "PERP" {
+			return parts[0], "USD", true
+		}
+		return parts[0], parts[1], true
+	}
+	return "", "", false
+}
@@ -0,0 +1,264 @@
+package dummy
+
+import (
+	"math"
+	"sort"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
+)
+
+// sizeEpsilon sizes smaller than this are treated as zero.
+const sizeEpsilon = 1e-12
+
+// assumptions of which orders are canceled when a level shrinks without trades. SpecificParam queueCancel.
+const (
+	// QueueCancelNone cancels are behind own order. the queue ahead shrinks only by trades.
+	QueueCancelNone = "none"
+	// QueueCancelProportional cancels are spread evenly over the level. default.
+	QueueCancelProportional = "proportional"
+	// QueueCancelFront cancels are ahead of own order.
+	QueueCancelFront = "front"
+)
+
+// UpdateBoard replace the board consumed by market orders and marketable limit orders.
+// liquidity taken by own orders is removed until the next board.
+// the board of b.Symbol is replaced. empty symbol is the default symbol.
+func (dm *dummy) UpdateBoard(b board.Board) error {
+	dm.log(LogEntry{Kind: LogUpdateBoard, Board: &b})
+	m := dm.market(b.Symbol)
+	m.asks = append([]base.Norm{}, b.Asks...)
+	m.bids = append([]base.Norm{}, b.Bids...)
+	sort.SliceStable(m.asks, func(i, j int) bool { return m.asks[i].Price < m.asks[j].Price })
+	sort.SliceStable(m.bids, func(i, j int) bool { return m.bids[i].Price > m.bids[j].Price })
+	m.updateBestPrice()
+	m.priced = true
+	m.quoted = true
+	if dm.queuePosition {
+		dm.updateQueues(m)
+	}
+	dm.checkLiquidation()
+	return nil
+}
+
+// updateQueues reduce the queue ahead of resting orders by cancels seen on the board.
+func (dm *dummy) updateQueues(m *market) {
+	update := func(v *boardElm, levelSize float64) {
+		decrease := v.LevelSize - levelSize
+		if decrease > 0 {
+			switch dm.queueCancel {
+			case QueueCancelProportional:
+				v.QueueAhead -= decrease * v.QueueAhead / v.LevelSize
+			case QueueCancelFront:
+				v.QueueAhead -= decrease
+			}
+		}
+		// 前に並んでいる数量は板の数量を超えない
+		v.QueueAhead = math.Max(0, math.Min(v.QueueAhead, levelSize))
+		v.LevelSize = levelSize
+	}
+	for i := range m.buyReqs {
+		update(&m.buyReqs[i], m.displayedSize(false, m.buyReqs[i].Price))
+	}
+	for i := range m.sellReqs {
+		update(&m.sellReqs[i], m.displayedSize(true, m.sellReqs[i].Price))
+	}
+}
+
+// displayedSize size of the level on the board. 数量の分からない最良気配は0とする
+func (m *market) displayedSize(isAsk bool, price float64) float64 {
+	levels := m.bids
+	if isAsk {
+		levels = m.asks
+	}
+	for _, level := range levels {
+		if level.Price == price && !math.IsInf(level.Size, 1) {
+			return level.Size
+		}
+	}
+	return 0
+}
+
+// UpdateExecution resting orders are filled by the volume traded through their price.
+// orders of e.Symbol are filled. empty symbol is the default symbol.
+func (dm *dummy) UpdateExecution(e execution.Execution) error {
+	dm.log(LogEntry{Kind: LogUpdateExecution, Execution: &e})
+	dm.advance(e.OccuredAt)
+	m := dm.market(e.Symbol)
+	m.updateLTP(e.Price)
+	dm.fillResting(m, e.Price, e.Size)
+	dm.checkLiquidation()
+	return nil
+}
+
+// take fill the order against the board as taker. returns filled size.
+// limit is ignored for market orders.
+func (dm *dummy) take(m *market, localID, orderType string, isBuy bool, limit, size float64, market bool) float64 {
+	levels := m.asks
+	if !isBuy {
+		levels = m.bids
+	}
+
+	filled := 0.0
+	for _, fill := range dm.fillModel.Take(levels, isBuy, limit, size, market) {
+		fee, feeCurrency := dm.settle(m, isBuy, false, fill.Price, fill.Size)
+		filled += fill.Size
+		dm.emitFill(m, localID, orderType, isBuy, false, fill, filled, size-filled, fee, feeCurrency)
+		// 約定した分の板を消す
+		for len(levels) > 0 && levels[0].Price != fill.Price {
+			levels = levels[1:]
+		}
+		if len(levels) > 0 {
+			levels[0].Size -= fill.Size
+			if levels[0].Size <= sizeEpsilon {
+				levels = levels[1:]
+			}
+		}
+	}
+
+	if isBuy {
+		m.asks = levels
+	} else {
+		m.bids = levels
+	}
+	m.updateBestPrice()
+	return filled
+}
+
+// fillResting fill resting orders of m by a trade of volume at price. better priced orders are filled first.
+func (dm *dummy) fillResting(m *market, price, volume float64) {
+	executedIDs := []string{}
+	fill := func(v *boardElm, isBuy bool, remaining float64) float64 {
+		if v.DelayCnt < dm.limitDelay || remaining <= sizeEpsilon {
+			return remaining
+		}
+		if v.ReduceOnly && m.reducible(isBuy) <= sizeEpsilon {
+			// 建玉がなくなった決済注文は取り消す
+			executedIDs = append(executedIDs, v.ID)
+			return remaining
+		}
+		q, consumed := dm.fillModel.Resting(&v.RestingOrder, isBuy, price, remaining)
+		q = math.Min(q, v.Size)
+		if v.ReduceOnly {
+			q = math.Min(q, m.reducible(isBuy))
+		}
+		if q <= sizeEpsilon {
+			return remaining - consumed
+		}
+		fee, feeCurrency := dm.settle(m, isBuy, true, v.Price, q)
+		v.Size -= q
+		v.Executed += q
+		dm.emitFill(m, v.ID, v.OrderType, isBuy, true, base.Norm{Price: v.Price, Size: q}, v.Executed, v.Size, fee, feeCurrency)
+		if v.Size <= sizeEpsilon {
+			executedIDs = append(executedIDs, v.ID)
+		}
+		return remaining - consumed
+	}
+
+	remaining := volume
+	for i := range m.buyReqs {
+		remaining = fill(&m.buyReqs[i], true, remaining)
+		m.buyReqs[i].DelayCnt++
+	}
+	remaining = volume
+	for i := range m.sellReqs {
+		remaining = fill(&m.sellReqs[i], false, remaining)
+		m.sellReqs[i].DelayCnt++
+	}
+
+	// 不要になったオーダー削除
+	for _, v := range executedIDs {
+		m.cancelOrder(v)
+	}
+}
+
+// settle update position and balances by a fill and pay the fee. returns the fee paid.
+// currencies of m must be resolved before the order is accepted.
+func (dm *dummy) settle(m *market, isBuy, isMaker bool, price, size float64) (float64, string) {
+	switch {
+	case dm.margin.enabled:
+		dm.settleMargin(m, isBuy, price, size)
+	case isBuy:
+		m.position += size
+		dm.balances[m.base] += size
+		dm.balances[m.quote] -= price * size
+	default:
+		m.position -= size
+		dm.balances[m.base] -= size
+		dm.balances[m.quote] += price * size
+	}
+	fee, feeCurrency := dm.chargeFee(m, isBuy, isMaker, price, size)
+	dm.log(LogEntry{
+		Kind:        LogFill,
+		Symbol:      m.symbol,
+		IsBuy:       isBuy,
+		Price:       price,
+		Size:        size,
+		IsMaker:     isMaker,
+		Fee:         fee,
+		FeeCurrency: feeCurrency,
+	})
+	return fee, feeCurrency
+}
+
+// addOrder rest the order. buyReqs and sellReqs are sorted by better price first.
+func (m *market) addOrder(isBuy bool, ele boardElm) {
+	if isBuy {
+		m.buyReqs = append(m.buyReqs, ele)
+		sort.SliceStable(m.buyReqs, func(i, j int) bool {
+			return m.buyReqs[i].Price > m.buyReqs[j].Price
+		})
+	} else {
+		m.sellReqs = append(m.sellReqs, ele)
+		sort.SliceStable(m.sellReqs, func(i, j int) bool {
+			return m.sellReqs[i].Price < m.sellReqs[j].Price
+		})
+	}
+}
+
+// find returns the resting order, isbuy, found
+func (m *market) find(id string) (boardElm, bool, bool) {
+	for _, v := range m.buyReqs {
+		if v.ID == id {
+			return v, true, true
+		}
+	}
+	for _, v := range m.sellReqs {
+		if v.ID == id {
+			return v, false, true
+		}
+	}
+	return boardElm{}, false, false
+}
+
+// cancelOrder returns canceled, isbuy
+func (m *market) cancelOrder(id string) (bool, bool) {
+	newBuyReqs := []boardElm{}
+	newSellReqs := []boardElm{}
+
+	canceled := false
+	isBuy := false
+
+	for _, v := range m.buyReqs {
+		if id != v.ID {
+			newBuyReqs = append(newBuyReqs, v)
+		} else {
+			canceled = true
+			isBuy = true
+		}
+	}
+
+	for _, v := range m.sellReqs {
+		if id != v.ID {
+			newSellReqs = append(newSellReqs, v)
+		} else {
+			canceled = true
+		}
+	}
+
+	m.buyReqs = newBuyReqs
+	m.sellReqs = newSellReqs
+
+	return canceled, isBuy
+}
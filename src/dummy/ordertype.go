@@ -0,0 +1,90 @@
+package dummy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// flags of order types. give them with OrderType, e.g. OrderType("LIMIT", PostOnly).
+const (
+	// IOC immediate or cancel. the remaining is canceled.
+	IOC = "IOC"
+	// FOK fill or kill. rejected unless filled entirely at once.
+	FOK = "FOK"
+	// PostOnly rejected if it would take liquidity.
+	PostOnly = "POST_ONLY"
+	// ReduceOnly only reduce the position. the size is reduced to the position.
+	ReduceOnly = "REDUCE_ONLY"
+)
+
+// errors of order entry.
+var (
+	ErrPostOnlyWouldTake = errors.New("post only order would take liquidity.")
+	ErrFOKNotFilled      = errors.New("fill or kill order can not be filled entirely.")
+	ErrReduceOnly        = errors.New("reduce only order would increase position.")
+	ErrNoPrice           = errors.New("no price of the symbol yet for a market order.")
+)
+
+// OrderType join the base order type ("LIMIT" or "MARKET") and flags. e.g. "LIMIT:POST_ONLY"
+func OrderType(orderType string, flags ...string) string {
+	return strings.Join(append([]string{orderType}, flags...), ":")
+}
+
+// orderSpec parsed order type.
+type orderSpec struct {
+	market     bool
+	ioc        bool
+	fok        bool
+	postOnly   bool
+	reduceOnly bool
+}
+
+func (dm *dummy) parseOrderType(orderType string) (orderSpec, error) {
+	spec := orderSpec{}
+	parts := strings.Split(orderType, ":")
+	switch parts[0] {
+	case dm.OrderTypes().Market:
+		spec.market = true
+	case dm.OrderTypes().Limit:
+	default:
+		return spec, fmt.Errorf("order type %s not supported.", orderType)
+	}
+	for _, flag := range parts[1:] {
+		switch flag {
+		case IOC:
+			spec.ioc = true
+		case FOK:
+			spec.fok = true
+		case PostOnly:
+			spec.postOnly = true
+		case ReduceOnly:
+			spec.reduceOnly = true
+		default:
+			return spec, fmt.Errorf("order type %s not supported.", orderType)
+		}
+	}
+	if spec.ioc && spec.fok {
+		return spec, fmt.Errorf("order type %s: IOC and FOK can not be used together.", orderType)
+	}
+	if spec.postOnly && (spec.market || spec.ioc || spec.fok) {
+		return spec, fmt.Errorf("order type %s: post only must be a resting limit order.", orderType)
+	}
+	return spec, nil
+}
+
+// rests return true if the remaining of the order is placed on the board.
+func (s orderSpec) rests() bool {
+	return !s.market && !s.ioc && !s.fok
+}
+
+// reducible size that reduces the position of m by the order side.
+func (m *market) reducible(isBuy bool) float64 {
+	if isBuy && m.position < 0 {
+		return -m.position
+	}
+	if !isBuy && m.position > 0 {
+		return m.position
+	}
+	return 0
+}
@@ -0,0 +1,259 @@
+package dummy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+)
+
+// snapshotVersion version of the snapshot format.
+const snapshotVersion = 1
+
+// Snapshotter the dummy implements it.
+// a snapshot holds the state, not the configuration. restore it to a dummy created with the same SpecificParam.
+type Snapshotter interface {
+	// Snapshot serialize open orders, balances, positions, the id counter, prices and the clock.
+	Snapshot() ([]byte, error)
+	Restore(data []byte) error
+	// EventLogErr first error of writing SpecificParam eventLog.
+	EventLogErr() error
+}
+
+// countingSource rand.Source counting draws, so the random state can be restored by the seed and the count.
+type countingSource struct {
+	src   rand.Source
+	seed  int64
+	draws int64
+}
+
+func newCountingSource(seed int64) *countingSource {
+	return &countingSource{src: rand.NewSource(seed), seed: seed}
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.seed = seed
+	s.draws = 0
+}
+
+// 保存用の型. mapは順序が決まらないのでスライスにする
+type state struct {
+	Version     int
+	IncID       int
+	Symbol      string
+	Balances    []amount
+	Markets     []marketState
+	Now         time.Time
+	IndexPrices []amount
+	Ledger      []FundingPayment
+	Pending     []requestState
+	RequestSeq  int
+	Seed        int64
+	Draws       int64
+	LogSeq      int
+}
+
+type amount struct {
+	Key   string
+	Value float64
+}
+
+type marketState struct {
+	Symbol      string
+	Base        string
+	Quote       string
+	Position    float64
+	EntryPrice  float64
+	BaseVolume  float64
+	QuoteVolume float64
+	LTP         float64
+	BestAsk     float64
+	BestBid     float64
+	Priced      bool
+	Quoted      bool
+	Asks        []base.Norm
+	Bids        []base.Norm
+	BuyReqs     []boardElm
+	SellReqs    []boardElm
+}
+
+type requestState struct {
+	At        time.Time
+	Seq       int
+	Kind      int
+	Symbol    string
+	LocalID   string
+	Price     float64
+	Size      float64
+	IsBuy     bool
+	OrderType string
+}
+
+func (dm *dummy) Snapshot() ([]byte, error) {
+	st := state{
+		Version:     snapshotVersion,
+		IncID:       dm.incID,
+		Symbol:      dm.symbol,
+		Balances:    amounts(dm.balances),
+		Now:         dm.now,
+		IndexPrices: amounts(dm.indexPrices),
+		Ledger:      dm.ledger,
+		RequestSeq:  dm.requestSeq,
+		Seed:        dm.randSource.seed,
+		Draws:       dm.randSource.draws,
+		LogSeq:      dm.logSeq,
+	}
+	symbols := []string{}
+	for symbol := range dm.markets {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		m := dm.markets[symbol]
+		st.Markets = append(st.Markets, marketState{
+			Symbol:      m.symbol,
+			Base:        m.base,
+			Quote:       m.quote,
+			Position:    m.position,
+			EntryPrice:  m.entryPrice,
+			BaseVolume:  m.baseVolume,
+			QuoteVolume: m.quoteVolume,
+			LTP:         m.ltp,
+			BestAsk:     m.bestAsk,
+			BestBid:     m.bestBid,
+			Priced:      m.priced,
+			Quoted:      m.quoted,
+			Asks:        m.asks,
+			Bids:        m.bids,
+			BuyReqs:     m.buyReqs,
+			SellReqs:    m.sellReqs,
+		})
+	}
+	for _, req := range dm.pending {
+		st.Pending = append(st.Pending, requestState{
+			At:        req.at,
+			Seq:       req.seq,
+			Kind:      req.kind,
+			Symbol:    req.symbol,
+			LocalID:   req.localID,
+			Price:     req.price,
+			Size:      req.size,
+			IsBuy:     req.isBuy,
+			OrderType: req.orderType,
+		})
+	}
+
+	// gobはInfやNaNもそのまま保存できる
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(st); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (dm *dummy) Restore(data []byte) error {
+	st := state{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&st); err != nil {
+		return err
+	}
+	if st.Version > snapshotVersion {
+		return fmt.Errorf("snapshot version %d is not supported.", st.Version)
+	}
+
+	dm.incID = st.IncID
+	dm.symbol = st.Symbol
+	dm.balances = map[string]float64{}
+	for _, v := range st.Balances {
+		dm.balances[v.Key] = v.Value
+	}
+	dm.indexPrices = map[string]float64{}
+	for _, v := range st.IndexPrices {
+		dm.indexPrices[v.Key] = v.Value
+	}
+	dm.now = st.Now
+	dm.ledger = st.Ledger
+	dm.requestSeq = st.RequestSeq
+	dm.logSeq = st.LogSeq
+	dm.markets = map[string]*market{}
+	for _, v := range st.Markets {
+		dm.markets[v.Symbol] = &market{
+			symbol:      v.Symbol,
+			base:        v.Base,
+			quote:       v.Quote,
+			position:    v.Position,
+			entryPrice:  v.EntryPrice,
+			baseVolume:  v.BaseVolume,
+			quoteVolume: v.QuoteVolume,
+			ltp:         v.LTP,
+			bestAsk:     v.BestAsk,
+			bestBid:     v.BestBid,
+			priced:      v.Priced,
+			quoted:      v.Quoted,
+			asks:        nonNilNorms(v.Asks),
+			bids:        nonNilNorms(v.Bids),
+			buyReqs:     nonNilElms(v.BuyReqs),
+			sellReqs:    nonNilElms(v.SellReqs),
+		}
+	}
+	dm.pending = nil
+	for _, v := range st.Pending {
+		dm.pending = append(dm.pending, pendingRequest{
+			at:        v.At,
+			seq:       v.Seq,
+			kind:      v.Kind,
+			symbol:    v.Symbol,
+			localID:   v.LocalID,
+			price:     v.Price,
+			size:      v.Size,
+			isBuy:     v.IsBuy,
+			orderType: v.OrderType,
+		})
+	}
+
+	// 乱数はシードから引いた回数だけ進める
+	dm.setSeed(st.Seed)
+	for i := int64(0); i < st.Draws; i++ {
+		dm.randSource.Int63()
+	}
+	dm.events = nil
+	return nil
+}
+
+func (dm *dummy) setSeed(seed int64) {
+	dm.randSource = newCountingSource(seed)
+	dm.rand = rand.New(dm.randSource)
+}
+
+func amounts(m map[string]float64) []amount {
+	ret := []amount{}
+	for k, v := range m {
+		ret = append(ret, amount{Key: k, Value: v})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Key < ret[j].Key })
+	return ret
+}
+
+// gobは空のスライスをnilにする
+func nonNilNorms(v []base.Norm) []base.Norm {
+	if v == nil {
+		return []base.Norm{}
+	}
+	return v
+}
+
+func nonNilElms(v []boardElm) []boardElm {
+	if v == nil {
+		return []boardElm{}
+	}
+	return v
+}
@@ -0,0 +1,100 @@
+package dummy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/interface/exchange"
+)
+
+type privateStream struct {
+	dm *dummy
+}
+
+// NewPrivateStream order events of the dummy ex, e.g. fills and liquidations.
+// events are kept only after the stream is created.
+func NewPrivateStream(ex exchange.Exchange) (exchange.PrivateStream, error) {
+	dm, ok := ex.(*dummy)
+	if !ok {
+		return nil, errors.New("exchange is not dummy.")
+	}
+	dm.streaming = true
+	return &privateStream{dm: dm}, nil
+}
+
+func (s *privateStream) Start() error {
+	return nil
+}
+
+func (s *privateStream) Close() error {
+	s.dm.streaming = false
+	s.dm.events = nil
+	return nil
+}
+
+func (s *privateStream) Read() (*orderevent.Event, error) {
+	if len(s.dm.events) == 0 {
+		return nil, nil
+	}
+	ev := s.dm.events[0]
+	s.dm.events = s.dm.events[1:]
+	return &ev, nil
+}
+
+// emitFill notify own fill. executed and remaining are sizes of the order after the fill.
+func (dm *dummy) emitFill(m *market, localID, orderType string, isBuy, isMaker bool, fill base.Norm, executed, remaining, fee float64, feeCurrency string) {
+	typ := orderevent.PartiallyFilled
+	if remaining <= sizeEpsilon {
+		typ = orderevent.Filled
+		remaining = 0
+	}
+	dm.emit(orderevent.Event{
+		ID:            id.NewID(dm.name, m.symbol, localID),
+		Type:          typ,
+		IsBuy:         isBuy,
+		OrderType:     orderType,
+		Norm:          fill,
+		ExecutedSize:  executed,
+		RemainingSize: remaining,
+		Fill: &orderevent.Fill{
+			ExecutionID: fmt.Sprint(dm.logSeq),
+			Norm:        fill,
+			Fee:         fee,
+			FeeCurrency: feeCurrency,
+			IsMaker:     isMaker,
+		},
+	})
+}
+
+// cancel remove the resting order and notify it. return false if not found.
+func (dm *dummy) cancel(m *market, localID string) bool {
+	v, isBuy, found := m.find(localID)
+	if !found {
+		return false
+	}
+	m.cancelOrder(localID)
+	dm.emit(orderevent.Event{
+		ID:        id.NewID(dm.name, m.symbol, localID),
+		Type:      orderevent.Canceled,
+		IsBuy:     isBuy,
+		OrderType: v.OrderType,
+		Norm: base.Norm{
+			Price: v.Price,
+			Size:  v.Size,
+		},
+		ExecutedSize:  v.Executed,
+		RemainingSize: v.Size,
+	})
+	return true
+}
+
+func (dm *dummy) emit(ev orderevent.Event) {
+	if !dm.streaming {
+		return
+	}
+	ev.OccuredAt = dm.now
+	dm.events = append(dm.events, ev)
+}
@@ -0,0 +1,121 @@
+package dummy
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Valuer the dummy implements it. values are marked to market.
+type Valuer interface {
+	// Equity value of all balances and positions in currency.
+	// empty currency is the quote currency of the default symbol.
+	Equity(currency string) (float64, error)
+	// Exposure notional value of all positions in currency.
+	Exposure(currency string) (float64, error)
+	// Convert amount of from into to by mark prices.
+	Convert(amount float64, from, to string) (float64, error)
+	// Currencies base and quote currency of symbol. empty symbol is the default symbol.
+	Currencies(symbol string) (string, string, error)
+}
+
+func (dm *dummy) Equity(currency string) (float64, error) {
+	currency, err := dm.valuationCurrency(currency)
+	if err != nil {
+		return 0, err
+	}
+	codes := []string{}
+	for code := range dm.balances {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	equity := 0.0
+	for _, code := range codes {
+		amount := dm.balances[code]
+		// 証拠金取引は建玉の評価損益も含める
+		if dm.margin.enabled {
+			for _, m := range dm.marginMarkets(code) {
+				amount += m.unrealizedPnL()
+			}
+		}
+		v, err := dm.convert(amount, code, currency)
+		if err != nil {
+			return 0, err
+		}
+		equity += v
+	}
+	return equity, nil
+}
+
+func (dm *dummy) Exposure(currency string) (float64, error) {
+	currency, err := dm.valuationCurrency(currency)
+	if err != nil {
+		return 0, err
+	}
+	exposure := 0.0
+	for _, m := range dm.sortedMarkets() {
+		if m.position == 0 {
+			continue
+		}
+		v, err := dm.convert(math.Abs(m.position)*m.markPrice(), m.quote, currency)
+		if err != nil {
+			return 0, err
+		}
+		exposure += v
+	}
+	return exposure, nil
+}
+
+func (dm *dummy) Convert(amount float64, from, to string) (float64, error) {
+	to, err := dm.valuationCurrency(to)
+	if err != nil {
+		return 0, err
+	}
+	return dm.convert(amount, from, to)
+}
+
+func (dm *dummy) Currencies(symbol string) (string, string, error) {
+	return dm.currencies(dm.market(symbol))
+}
+
+func (dm *dummy) valuationCurrency(currency string) (string, error) {
+	if currency != "" {
+		return currency, nil
+	}
+	_, quote, err := dm.Currencies("")
+	return quote, err
+}
+
+// convert amount of from into to by the mark price of a market of the two currencies.
+func (dm *dummy) convert(amount float64, from, to string) (float64, error) {
+	if amount == 0 || from == to {
+		return amount, nil
+	}
+	for _, m := range dm.sortedMarkets() {
+		price := m.markPrice()
+		if price <= 0 || m.symbol == "" {
+			continue
+		}
+		baseCurrency, quoteCurrency, err := dm.currencies(m)
+		if err != nil {
+			continue
+		}
+		if baseCurrency == from && quoteCurrency == to {
+			return amount * price, nil
+		}
+		if baseCurrency == to && quoteCurrency == from {
+			return amount / price, nil
+		}
+	}
+	return 0, fmt.Errorf("no price to convert %s to %s.", from, to)
+}
+
+func (dm *dummy) sortedMarkets() []*market {
+	ret := []*market{}
+	for _, m := range dm.markets {
+		ret = append(ret, m)
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].symbol < ret[j].symbol })
+	return ret
+}
@@ -2,14 +2,10 @@ package ftx
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
@@ -17,16 +13,25 @@ import (
 
 	"github.com/TTRSQ/ccew/domains/base"
 	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
 	"github.com/TTRSQ/ccew/domains/order"
 	"github.com/TTRSQ/ccew/domains/order/id"
 	"github.com/TTRSQ/ccew/domains/stock"
 	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/httpx"
+	"github.com/TTRSQ/ccew/util/ratelimit"
+	"github.com/TTRSQ/ccew/util/retry"
+	"github.com/TTRSQ/ccew/util/sign"
 )
 
 type ftx struct {
 	name string
 	host string
 	key  exchange.Key
+	// signKey APISecKeyの代わりに外部の署名プロセスを使える
+	signKey sign.Key
+
+	client *httpx.Client
 }
 
 // New return exchange obj.
@@ -35,10 +40,28 @@ func New(key exchange.Key) (exchange.Exchange, error) {
 	ftx.name = "ftx"
 	ftx.host = "ftx.com"
 
-	if key.APIKey == "" || key.APISecKey == "" {
-		return nil, errors.New("APIKey and APISecKey Required")
+	k, err := sign.KeyOf(key)
+	if err != nil {
+		return nil, err
+	}
+	// additional_keys 複数のキーを順番に使う
+	keys, err := sign.PoolOf(key)
+	if err != nil {
+		return nil, err
 	}
 	ftx.key = key
+	ftx.signKey = k
+	subaccount := ""
+	if val, exist := key.SpecificParam["FTX-SUBACCOUNT"]; exist {
+		subaccount = fmt.Sprint(val)
+	}
+
+	ftx.client = httpx.New(key, httpx.Options{
+		Name:        ftx.name,
+		RateLimiter: ratelimit.New(ratelimit.Ftx()),
+		Retry:       retry.Ftx(),
+		Signer:      sign.Ftx(keys, subaccount),
+	})
 
 	return &ftx, nil
 }
@@ -57,22 +80,34 @@ func (ftx *ftx) OrderTypes() exchange.OrderTypes {
 func (ftx *ftx) CreateOrder(price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error) {
 	// リクエスト
 	type Req struct {
-		Market string   `json:"market"`
-		Type   string   `json:"type"`
-		Side   string   `json:"side"`
-		Price  *float64 `json:"price"`
-		Size   float64  `json:"size"`
+		Market   string   `json:"market"`
+		Type     string   `json:"type"`
+		Side     string   `json:"side"`
+		Price    *float64 `json:"price"`
+		Size     float64  `json:"size"`
+		ClientID string   `json:"clientId"`
 	}
 
+	// clientIdがあると再送しても二重に発注されない
+	clientID := retry.NewClientOrderID()
 	res, err := ftx.postRequest("/api/orders", Req{
-		Market: symbol,
-		Type:   orderType,
-		Side:   map[bool]string{true: "buy", false: "sell"}[isBuy],
-		Price:  map[bool]*float64{true: &price, false: nil}[orderType == ftx.OrderTypes().Limit],
-		Size:   size,
+		Market:   symbol,
+		Type:     orderType,
+		Side:     map[bool]string{true: "buy", false: "sell"}[isBuy],
+		Price:    map[bool]*float64{true: &price, false: nil}[orderType == ftx.OrderTypes().Limit],
+		Size:     size,
+		ClientID: clientID,
 	})
 
 	if err != nil {
+		// 応答が失われた試行で発注済みなら再送は重複で拒否される. 発注済みの注文を返す
+		statusErr := &httpx.StatusError{}
+		if errors.As(err, &statusErr) {
+			res = []byte(statusErr.Body)
+		}
+		if retry.FtxDuplicate(res) {
+			return ftx.orderByClientID(symbol, clientID)
+		}
 		return nil, err
 	}
 
@@ -107,6 +142,30 @@ func (ftx *ftx) CreateOrder(price, size float64, isBuy bool, symbol, orderType s
 	}, nil
 }
 
+// orderByClientID the order placed with clientId clientID.
+func (ftx *ftx) orderByClientID(symbol, clientID string) (*order.Responce, error) {
+	res, err := ftx.getRequest("/api/orders/by_client_id/"+clientID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	type Res struct {
+		Success bool `json:"success"`
+		Result  struct {
+			ID         int     `json:"id"`
+			FilledSize float64 `json:"filledSize"`
+			ClientID   string  `json:"clientId"`
+		} `json:"result"`
+	}
+	resData := Res{}
+	json.Unmarshal(res, &resData)
+
+	return &order.Responce{
+		ID:         id.NewID(ftx.name, symbol, fmt.Sprint(resData.Result.ID)),
+		FilledSize: resData.Result.FilledSize,
+	}, nil
+}
+
 func (fx *ftx) LiquidationOrder(price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error) {
 	return nil, errors.New("EditOrder not supported.")
 }
@@ -367,6 +426,46 @@ func (ftx *ftx) Boards(symbol string) (board.Board, error) {
 	}, nil
 }
 
+func (ftx *ftx) Executions(symbol string) ([]execution.Execution, error) {
+	res, err := ftx.getRequest("/api/markets/"+symbol+"/trades", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// レスポンスの変換
+	type Res struct {
+		Success bool `json:"success"`
+		Result  []struct {
+			ID    int64     `json:"id"`
+			Price float64   `json:"price"`
+			Size  float64   `json:"size"`
+			Side  string    `json:"side"`
+			Time  time.Time `json:"time"`
+		} `json:"result"`
+	}
+	resData := Res{}
+	json.Unmarshal(res, &resData)
+	if !resData.Success {
+		return nil, errors.New(string(res))
+	}
+
+	// 返却値の作成
+	ret := []execution.Execution{}
+	for _, data := range resData.Result {
+		ret = append(ret, execution.Execution{
+			ID: id.NewID(ftx.name, symbol, fmt.Sprint(data.ID)),
+			Norm: base.Norm{
+				Price: data.Price,
+				Size:  data.Size,
+			},
+			IsBuy:     data.Side == "buy",
+			OccuredAt: data.Time,
+		})
+	}
+
+	return ret, nil
+}
+
 func (ftx *ftx) InScheduledMaintenance() bool {
 	// jst := utiltime.Jst()
 	// // 355 <= time <= 415で落とす
@@ -392,30 +491,13 @@ func (ftx *ftx) getRequest(path string, param interface{}) ([]byte, error) {
 	}
 
 	uri := url.URL{Scheme: "https", Host: ftx.host, Path: path, RawQuery: uparm.Encode()}
-	timestamp := fmt.Sprintf("%d", time.Now().UnixNano()/1000000)
 	req, err := http.NewRequest(
 		"GET",
 		uri.String(),
 		nil,
 	)
-
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	req.Header.Add("FTX-KEY", ftx.key.APIKey)
-	req.Header.Add("FTX-TS", timestamp)
-
-	rawSign := timestamp + "GET" + path
-	if uparm.Encode() != "" {
-		rawSign += "?" + uparm.Encode()
-	}
-	sign := ftx.makeHMAC(rawSign)
-
-	req.Header.Add("FTX-SIGN", sign)
-	val, exest := ftx.key.SpecificParam["FTX-SUBACCOUNT"]
-	if exest {
-		req.Header.Add("FTX-SUBACCOUNT", fmt.Sprint(val))
+		return nil, err
 	}
 
 	return ftx.request(req)
@@ -423,7 +505,6 @@ func (ftx *ftx) getRequest(path string, param interface{}) ([]byte, error) {
 
 func (ftx *ftx) postRequest(path string, param interface{}) ([]byte, error) {
 	url := url.URL{Scheme: "https", Host: ftx.host, Path: path}
-	timestamp := fmt.Sprintf("%d", time.Now().UnixNano()/1000000)
 	jsonParam, _ := json.Marshal(param)
 	req, _ := http.NewRequest(
 		"POST",
@@ -432,24 +513,12 @@ func (ftx *ftx) postRequest(path string, param interface{}) ([]byte, error) {
 	)
 
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("FTX-KEY", ftx.key.APIKey)
-	req.Header.Add("FTX-TS", timestamp)
-
-	rawSign := timestamp + "POST" + path + string(jsonParam)
-	sign := ftx.makeHMAC(rawSign)
-
-	req.Header.Add("FTX-SIGN", sign)
-	val, exest := ftx.key.SpecificParam["FTX-SUBACCOUNT"]
-	if exest {
-		req.Header.Add("FTX-SUBACCOUNT", fmt.Sprint(val))
-	}
 
 	return ftx.request(req)
 }
 
 func (ftx *ftx) deleteRequest(path string, param interface{}) ([]byte, error) {
 	url := url.URL{Scheme: "https", Host: ftx.host, Path: path}
-	timestamp := fmt.Sprintf("%d", time.Now().UnixNano()/1000000)
 	jsonParam, _ := json.Marshal(param)
 	req, _ := http.NewRequest(
 		"DELETE",
@@ -458,47 +527,19 @@ func (ftx *ftx) deleteRequest(path string, param interface{}) ([]byte, error) {
 	)
 
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("FTX-KEY", ftx.key.APIKey)
-	req.Header.Add("FTX-TS", timestamp)
-
-	rawSign := timestamp + "DELETE" + path + string(jsonParam)
-	sign := ftx.makeHMAC(rawSign)
-
-	req.Header.Add("FTX-SIGN", sign)
-	val, exest := ftx.key.SpecificParam["FTX-SUBACCOUNT"]
-	if exest {
-		req.Header.Add("FTX-SUBACCOUNT", fmt.Sprint(val))
-	}
 
 	return ftx.request(req)
 }
 
-func (ftx *ftx) makeHMAC(msg string) string {
-	mac := hmac.New(sha256.New, []byte(ftx.key.APISecKey))
-	mac.Write([]byte(msg))
-	return hex.EncodeToString(mac.Sum(nil))
+func (ftx *ftx) makeHMAC(msg string) (string, error) {
+	mac, err := ftx.signKey.HMAC([]byte(msg))
+	return hex.EncodeToString(mac), err
 }
 
 func (ftx *ftx) request(req *http.Request) ([]byte, error) {
-	client := new(http.Client)
-	resp, err := client.Do(req)
-
+	body, err := ftx.client.Do(req)
 	if err != nil {
-		errStr := fmt.Sprintf("err ==> %+v\nreq ==> %v\n", err, req)
-		return nil, errors.New(errStr)
-	}
-	if resp.StatusCode != 200 {
-		body, _ := ioutil.ReadAll(resp.Body)
-		errStr := ""
-		errStr += fmt.Sprintf("body ==> %s\n", string(body))
-		errStr += fmt.Sprintf("resp ==> %+v\nreq ==> %v\n", resp, req)
-		return nil, errors.New(errStr)
-	}
-
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	type errCheck struct {
@@ -511,7 +552,8 @@ func (ftx *ftx) request(req *http.Request) ([]byte, error) {
 		if err != nil {
 			msg = err.Error()
 		}
-		return nil, errors.New(msg)
+		// 本文はエラーの判別に使う
+		return body, errors.New(msg)
 	}
 
 	return body, err
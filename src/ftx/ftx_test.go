@@ -1,10 +1,16 @@
 package ftx
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/httpx/httpxtest"
+	"github.com/TTRSQ/ccew/util/retry"
 )
 
 func getExchange() exchange.Exchange {
@@ -23,3 +29,51 @@ func TestBoards(t *testing.T) {
 	}
 	fmt.Printf("result:%+v\n", board)
 }
+
+func TestCreateOrderRetry(t *testing.T) {
+	// 1回目は発注されたが応答が失われ, 再送は重複で拒否される
+	clientIDs := []string{}
+	transport := httpxtest.Transport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			if r.URL.Path != "/api/orders/by_client_id/"+clientIDs[0] {
+				t.Errorf("lookup %s", r.URL)
+			}
+			w.Write([]byte(`{"success":true,"result":{"id":12345,"filledSize":0.5,"clientId":"` + clientIDs[0] + `"}}`))
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		param := struct {
+			ClientID string `json:"clientId"`
+		}{}
+		json.Unmarshal(body, &param)
+		clientIDs = append(clientIDs, param.ClientID)
+		if len(clientIDs) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"success":false,"error":"Duplicate client order ID"}`))
+	}))
+	policy := retry.Ftx()
+	policy.BaseDelay = time.Millisecond
+	ftx, err := New(exchange.Key{APIKey: "key", APISecKey: "secret", SpecificParam: map[string]interface{}{
+		"transport": transport,
+		"retry":     policy,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ftx.CreateOrder(10000, 1, true, "BTC-PERP", "limit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 再送は同じclientIdで送る
+	if len(clientIDs) != 2 || clientIDs[0] == "" || clientIDs[0] != clientIDs[1] {
+		t.Fatal(clientIDs)
+	}
+	// 発注済みの注文を返す
+	if res.ID.LocalID != "12345" || res.FilledSize != 0.5 {
+		t.Fatalf("%+v", res)
+	}
+}
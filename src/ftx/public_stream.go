@@ -0,0 +1,257 @@
+package ftx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/ticker"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/wsconn"
+)
+
+type publicStream struct {
+	name     string
+	endpoint string
+	proxyURL *url.URL
+
+	mu     sync.Mutex
+	conn   *wsconn.Conn
+	topics []exchange.Topic
+	queue  *wsconn.Queue
+}
+
+// NewPublicStream return stream of trades, orderbook and ticker channels.
+func NewPublicStream(key exchange.Key) (exchange.PublicStream, error) {
+	ps := publicStream{}
+	ps.name = "ftx"
+	ps.endpoint = "wss://ftx.com/ws/"
+	if key.SpecificParam["proxyURL"] != nil {
+		ps.proxyURL = key.SpecificParam["proxyURL"].(*url.URL)
+	}
+	ps.queue = &wsconn.Queue{}
+
+	return &ps, nil
+}
+
+func (ps *publicStream) Subscribe(topics ...exchange.Topic) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.topics = append(ps.topics, topics...)
+	if ps.conn == nil {
+		return nil
+	}
+	return subscribeTopics(ps.conn, topics)
+}
+
+func (ps *publicStream) Start() error {
+	conn, err := wsconn.Dial(ps.endpoint, ps.proxyURL)
+	if err != nil {
+		return err
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if err := subscribeTopics(conn, ps.topics); err != nil {
+		conn.Close()
+		return err
+	}
+	// 板は接続ごとに作り直す
+	books := map[string]*board.Book{}
+	ps.conn = conn
+	conn.WakeOnClose(ps.queue)
+	conn.Listen(func(msg []byte) {
+		ps.handle(conn, books, msg)
+	})
+	return nil
+}
+
+func (ps *publicStream) Close() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return nil
+	}
+	err := ps.conn.Close()
+	ps.conn = nil
+	return err
+}
+
+// Ready receive when Read may return a message or the error of the connection.
+func (ps *publicStream) Ready() <-chan struct{} {
+	return ps.queue.Ready()
+}
+
+func (ps *publicStream) Read() (*exchange.Message, error) {
+	if v := ps.queue.Pop(); v != nil {
+		msg := v.(exchange.Message)
+		return &msg, nil
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return nil, errors.New("stream is not started.")
+	}
+	return nil, ps.conn.Err()
+}
+
+func (ps *publicStream) Ping() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return errors.New("stream is not started.")
+	}
+	return ps.conn.WriteJSON(wsReq{Op: "ping"})
+}
+
+func (ps *publicStream) LastReceived() time.Time {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return time.Time{}
+	}
+	return ps.conn.LastReceived()
+}
+
+func subscribeTopics(conn *wsconn.Conn, topics []exchange.Topic) error {
+	type Req struct {
+		Op      string `json:"op"`
+		Channel string `json:"channel"`
+		Market  string `json:"market"`
+	}
+	for _, topic := range topics {
+		channel := map[exchange.Channel]string{
+			exchange.ExecutionsChannel: "trades",
+			exchange.BoardChannel:      "orderbook",
+			exchange.TickerChannel:     "ticker",
+		}[topic.Channel]
+		if channel == "" {
+			return fmt.Errorf("channel %s not supported.", topic.Channel)
+		}
+		if err := conn.WriteJSON(Req{Op: "subscribe", Channel: channel, Market: topic.Symbol}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ps *publicStream) handle(conn *wsconn.Conn, books map[string]*board.Book, msg []byte) {
+	type Res struct {
+		Channel string          `json:"channel"`
+		Market  string          `json:"market"`
+		Type    string          `json:"type"`
+		Code    int             `json:"code"`
+		Msg     string          `json:"msg"`
+		Data    json.RawMessage `json:"data"`
+	}
+	resData := Res{}
+	if err := json.Unmarshal(msg, &resData); err != nil {
+		return
+	}
+	if resData.Type == "error" {
+		conn.Fail(fmt.Errorf("ftx stream error %d: %s", resData.Code, resData.Msg))
+		return
+	}
+
+	switch resData.Channel {
+	case "trades":
+		ps.handleTrades(resData.Market, resData.Data)
+	case "orderbook":
+		ps.handleOrderbook(books, resData.Market, resData.Type, resData.Data)
+	case "ticker":
+		ps.handleTicker(resData.Market, resData.Data)
+	}
+}
+
+func (ps *publicStream) handleTrades(market string, msg []byte) {
+	type Res []struct {
+		ID    int64     `json:"id"`
+		Price float64   `json:"price"`
+		Size  float64   `json:"size"`
+		Side  string    `json:"side"`
+		Time  time.Time `json:"time"`
+	}
+	resData := Res{}
+	json.Unmarshal(msg, &resData)
+
+	for _, data := range resData {
+		ps.queue.Push(exchange.Message{
+			Topic: exchange.Topic{Channel: exchange.ExecutionsChannel, Symbol: market},
+			Execution: &execution.Execution{
+				ID: id.NewID(ps.name, market, fmt.Sprint(data.ID)),
+				Norm: base.Norm{
+					Price: data.Price,
+					Size:  data.Size,
+				},
+				IsBuy:     data.Side == "buy",
+				OccuredAt: data.Time,
+			},
+		})
+	}
+}
+
+func (ps *publicStream) handleOrderbook(books map[string]*board.Book, market, typ string, msg []byte) {
+	type Res struct {
+		Bids [][2]float64 `json:"bids"`
+		Asks [][2]float64 `json:"asks"`
+	}
+	resData := Res{}
+	json.Unmarshal(msg, &resData)
+
+	book, exist := books[market]
+	if !exist {
+		book = board.NewBook()
+		books[market] = book
+	}
+	if typ == "partial" {
+		book.Reset(nil, nil)
+	} else if typ != "update" {
+		return
+	}
+	for _, v := range resData.Asks {
+		book.Update(true, v[0], v[1])
+	}
+	for _, v := range resData.Bids {
+		book.Update(false, v[0], v[1])
+	}
+
+	b := book.Board(ps.name, market, 0)
+	ps.queue.Push(exchange.Message{
+		Topic: exchange.Topic{Channel: exchange.BoardChannel, Symbol: market},
+		Board: &b,
+	})
+}
+
+func (ps *publicStream) handleTicker(market string, msg []byte) {
+	type Res struct {
+		Bid     float64 `json:"bid"`
+		Ask     float64 `json:"ask"`
+		BidSize float64 `json:"bidSize"`
+		AskSize float64 `json:"askSize"`
+		Last    float64 `json:"last"`
+		Time    float64 `json:"time"`
+	}
+	data := Res{}
+	json.Unmarshal(msg, &data)
+
+	ps.queue.Push(exchange.Message{
+		Topic: exchange.Topic{Channel: exchange.TickerChannel, Symbol: market},
+		Ticker: &ticker.Ticker{
+			ExchangeName: ps.name,
+			Symbol:       market,
+			BestBid:      data.Bid,
+			BestAsk:      data.Ask,
+			BestBidSize:  data.BidSize,
+			BestAskSize:  data.AskSize,
+			LTP:          data.Last,
+			OccuredAt:    time.Unix(0, int64(data.Time*float64(time.Second))),
+		},
+	})
+}
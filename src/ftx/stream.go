@@ -0,0 +1,300 @@
+package ftx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/wsconn"
+)
+
+type privateStream struct {
+	name     string
+	endpoint string
+	rest     *ftx
+	proxyURL *url.URL
+
+	conn  *wsconn.Conn
+	queue *wsconn.Queue
+
+	// fillsだけでは全約定か判定できないので注文の状態を持っておく
+	mu     sync.Mutex
+	orders map[string]*orderState
+}
+
+type orderState struct {
+	size     float64
+	filled   float64
+	accepted bool
+	done     bool
+}
+
+// NewPrivateStream return stream of orders and fills channels.
+func NewPrivateStream(key exchange.Key) (exchange.PrivateStream, error) {
+	rest, err := New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := privateStream{}
+	ps.name = "ftx"
+	ps.endpoint = "wss://ftx.com/ws/"
+	ps.rest = rest.(*ftx)
+	if key.SpecificParam["proxyURL"] != nil {
+		ps.proxyURL = key.SpecificParam["proxyURL"].(*url.URL)
+	}
+	ps.queue = &wsconn.Queue{}
+	ps.orders = map[string]*orderState{}
+
+	return &ps, nil
+}
+
+type wsReq struct {
+	Op      string      `json:"op"`
+	Channel string      `json:"channel,omitempty"`
+	Args    interface{} `json:"args,omitempty"`
+}
+
+func (ps *privateStream) Start() error {
+	conn, err := wsconn.Dial(ps.endpoint, ps.proxyURL)
+	if err != nil {
+		return err
+	}
+
+	// 認証. 成功時は応答がなく, 失敗時のみerrorが返る
+	type loginArgs struct {
+		Key        string `json:"key"`
+		Sign       string `json:"sign"`
+		Time       int64  `json:"time"`
+		Subaccount string `json:"subaccount,omitempty"`
+	}
+	ts := time.Now().UnixNano() / int64(time.Millisecond)
+	sign, err := ps.rest.makeHMAC(fmt.Sprintf("%dwebsocket_login", ts))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	args := loginArgs{
+		Key:  ps.rest.signKey.ID(),
+		Sign: sign,
+		Time: ts,
+	}
+	if val, exist := ps.rest.key.SpecificParam["FTX-SUBACCOUNT"]; exist {
+		args.Subaccount = fmt.Sprint(val)
+	}
+	if err := conn.WriteJSON(wsReq{Op: "login", Args: args}); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// 購読
+	for _, channel := range []string{"orders", "fills"} {
+		if err := conn.WriteJSON(wsReq{Op: "subscribe", Channel: channel}); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	ps.mu.Lock()
+	ps.orders = map[string]*orderState{}
+	ps.mu.Unlock()
+
+	ps.conn = conn
+	conn.WakeOnClose(ps.queue)
+	conn.Listen(ps.handle)
+	return nil
+}
+
+func (ps *privateStream) Close() error {
+	if ps.conn == nil {
+		return nil
+	}
+	return ps.conn.Close()
+}
+
+// Ready receive when Read may return a message or the error of the connection.
+func (ps *privateStream) Ready() <-chan struct{} {
+	return ps.queue.Ready()
+}
+
+func (ps *privateStream) Read() (*orderevent.Event, error) {
+	if v := ps.queue.Pop(); v != nil {
+		ev := v.(orderevent.Event)
+		return &ev, nil
+	}
+	if ps.conn == nil {
+		return nil, errors.New("stream is not started.")
+	}
+	return nil, ps.conn.Err()
+}
+
+// Ping ftxは15秒ごとのop:pingを推奨している
+func (ps *privateStream) Ping() error {
+	if ps.conn == nil {
+		return errors.New("stream is not started.")
+	}
+	return ps.conn.WriteJSON(wsReq{Op: "ping"})
+}
+
+func (ps *privateStream) LastReceived() time.Time {
+	if ps.conn == nil {
+		return time.Time{}
+	}
+	return ps.conn.LastReceived()
+}
+
+func (ps *privateStream) handle(msg []byte) {
+	type Res struct {
+		Channel string          `json:"channel"`
+		Type    string          `json:"type"`
+		Code    int             `json:"code"`
+		Msg     string          `json:"msg"`
+		Data    json.RawMessage `json:"data"`
+	}
+	resData := Res{}
+	if err := json.Unmarshal(msg, &resData); err != nil {
+		return
+	}
+	if resData.Type == "error" {
+		// 認証失敗などは接続を閉じて上位に知らせる
+		ps.conn.Fail(fmt.Errorf("code:%d msg:%s", resData.Code, resData.Msg))
+		return
+	}
+	if resData.Type != "update" {
+		return
+	}
+
+	switch resData.Channel {
+	case "orders":
+		ps.handleOrder(resData.Data)
+	case "fills":
+		ps.handleFill(resData.Data)
+	}
+}
+
+func (ps *privateStream) handleOrder(msg []byte) {
+	type Res struct {
+		ID            int       `json:"id"`
+		Market        string    `json:"market"`
+		Type          string    `json:"type"`
+		Side          string    `json:"side"`
+		Price         float64   `json:"price"`
+		Size          float64   `json:"size"`
+		Status        string    `json:"status"`
+		FilledSize    float64   `json:"filledSize"`
+		RemainingSize float64   `json:"remainingSize"`
+		CreatedAt     time.Time `json:"createdAt"`
+	}
+	data := Res{}
+	json.Unmarshal(msg, &data)
+
+	localID := fmt.Sprint(data.ID)
+	ev := orderevent.Event{
+		ID:        id.NewID(ps.name, data.Market, localID),
+		IsBuy:     data.Side == "buy",
+		OrderType: data.Type,
+		Norm: base.Norm{
+			Price: data.Price,
+			Size:  data.Size,
+		},
+		ExecutedSize:  data.FilledSize,
+		RemainingSize: data.RemainingSize,
+		OccuredAt:     time.Now(),
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	state, exist := ps.orders[localID]
+	if !exist {
+		state = &orderState{}
+		ps.orders[localID] = state
+	}
+	state.size = data.Size
+
+	switch data.Status {
+	case "new":
+		return
+	case "open":
+		// 約定による更新はfillsで流す. newの後のopenは受付として流す
+		if state.accepted || state.filled > 0 {
+			return
+		}
+		state.accepted = true
+		ev.Type = orderevent.Accepted
+	case "closed":
+		delete(ps.orders, localID)
+		if state.done {
+			return
+		}
+		ev.Type = orderevent.Canceled
+		if data.FilledSize >= data.Size {
+			ev.Type = orderevent.Filled
+		}
+	default:
+		return
+	}
+	ps.queue.Push(ev)
+}
+
+func (ps *privateStream) handleFill(msg []byte) {
+	type Res struct {
+		ID          int       `json:"id"`
+		Market      string    `json:"market"`
+		OrderID     int       `json:"orderId"`
+		Price       float64   `json:"price"`
+		Side        string    `json:"side"`
+		Size        float64   `json:"size"`
+		Fee         float64   `json:"fee"`
+		FeeCurrency string    `json:"feeCurrency"`
+		Liquidity   string    `json:"liquidity"`
+		Time        time.Time `json:"time"`
+	}
+	data := Res{}
+	json.Unmarshal(msg, &data)
+
+	localID := fmt.Sprint(data.OrderID)
+	ev := orderevent.Event{
+		ID:    id.NewID(ps.name, data.Market, localID),
+		Type:  orderevent.PartiallyFilled,
+		IsBuy: data.Side == "buy",
+		Fill: &orderevent.Fill{
+			ExecutionID: fmt.Sprint(data.ID),
+			Norm: base.Norm{
+				Price: data.Price,
+				Size:  data.Size,
+			},
+			Fee:         data.Fee,
+			FeeCurrency: data.FeeCurrency,
+			IsMaker:     data.Liquidity == "maker",
+		},
+		OccuredAt: data.Time,
+	}
+
+	ps.mu.Lock()
+	state, exist := ps.orders[localID]
+	if !exist {
+		state = &orderState{}
+		ps.orders[localID] = state
+	}
+	state.filled += data.Size
+	ev.Norm.Size = state.size
+	ev.ExecutedSize = state.filled
+	if state.size > 0 {
+		ev.RemainingSize = state.size - state.filled
+		if ev.RemainingSize <= 0 {
+			ev.RemainingSize = 0
+			ev.Type = orderevent.Filled
+			state.done = true
+		}
+	}
+	ps.mu.Unlock()
+
+	ps.queue.Push(ev)
+}
@@ -0,0 +1,57 @@
+package ftx
+
+import (
+	"testing"
+
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/util/wsconn"
+)
+
+func TestHandleOrdersAndFills(t *testing.T) {
+	ps := privateStream{name: "ftx", queue: &wsconn.Queue{}, orders: map[string]*orderState{}}
+	for _, msg := range []string{
+		`{"channel":"orders","type":"update","data":{"id":1,"market":"BTC-PERP","type":"limit","side":"buy","price":30000,"size":1,"status":"new","filledSize":0,"remainingSize":1}}`,
+		`{"channel":"orders","type":"update","data":{"id":1,"market":"BTC-PERP","type":"limit","side":"buy","price":30000,"size":1,"status":"open","filledSize":0,"remainingSize":1}}`,
+		`{"channel":"fills","type":"update","data":{"id":10,"market":"BTC-PERP","orderId":1,"price":30000,"side":"buy","size":0.4,"fee":0.1,"feeCurrency":"USD","liquidity":"maker","time":"2021-01-01T00:00:01Z"}}`,
+		`{"channel":"orders","type":"update","data":{"id":1,"market":"BTC-PERP","type":"limit","side":"buy","price":30000,"size":1,"status":"open","filledSize":0.4,"remainingSize":0.6}}`,
+		`{"channel":"fills","type":"update","data":{"id":11,"market":"BTC-PERP","orderId":1,"price":30000,"side":"buy","size":0.6,"fee":0.2,"feeCurrency":"USD","liquidity":"taker","time":"2021-01-01T00:00:02Z"}}`,
+		`{"channel":"orders","type":"update","data":{"id":1,"market":"BTC-PERP","type":"limit","side":"buy","price":30000,"size":1,"status":"closed","filledSize":1,"remainingSize":0}}`,
+		`{"channel":"orders","type":"update","data":{"id":2,"market":"BTC-PERP","type":"limit","side":"sell","price":31000,"size":1,"status":"closed","filledSize":0,"remainingSize":0}}`,
+		`{"type":"subscribed","channel":"fills"}`,
+	} {
+		ps.handle([]byte(msg))
+	}
+
+	// 全約定はfillsで判定し, closedは重ねて流さない
+	want := []struct {
+		typ     orderevent.Type
+		localID string
+	}{
+		{orderevent.Accepted, "1"},
+		{orderevent.PartiallyFilled, "1"},
+		{orderevent.Filled, "1"},
+		{orderevent.Canceled, "2"},
+	}
+	for i, w := range want {
+		v := ps.queue.Pop()
+		if v == nil {
+			t.Fatalf("event %d not found", i)
+		}
+		got := v.(orderevent.Event)
+		if got.Type != w.typ || got.ID.LocalID != w.localID {
+			t.Errorf("event %d: %s %s", i, got.Type, got.ID.LocalID)
+		}
+		if i == 1 && (got.Fill == nil || got.Fill.Size != 0.4 || !got.Fill.IsMaker || got.ExecutedSize != 0.4 || got.RemainingSize != 0.6) {
+			t.Errorf("fill %+v %+v", got, got.Fill)
+		}
+		if i == 2 && (got.ExecutedSize != 1 || got.RemainingSize != 0) {
+			t.Errorf("filled %+v", got)
+		}
+	}
+	if ps.queue.Pop() != nil {
+		t.Error("unexpected event")
+	}
+	if len(ps.orders) != 0 {
+		t.Errorf("orders %+v", ps.orders)
+	}
+}
@@ -2,13 +2,9 @@ package gmo
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -18,24 +14,24 @@ import (
 
 	"github.com/TTRSQ/ccew/domains/base"
 	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
 	"github.com/TTRSQ/ccew/domains/order"
 	"github.com/TTRSQ/ccew/domains/order/id"
 	"github.com/TTRSQ/ccew/domains/stock"
 	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/httpx"
+	"github.com/TTRSQ/ccew/util/ratelimit"
+	"github.com/TTRSQ/ccew/util/retry"
+	"github.com/TTRSQ/ccew/util/sign"
 )
 
-type keyStruct struct {
-	id  string
-	sec string
-}
-
 type gmo struct {
-	key  keyStruct
 	host string
 	name string
 
-	proxyURL   *url.URL
-	httpClient *http.Client
+	client *httpx.Client
+	// authKey ws-authのトークンは発行したキーでしか延長, 削除できない
+	authKey string
 }
 
 // New return exchange obj.
@@ -44,26 +40,21 @@ func New(key exchange.Key) (exchange.Exchange, error) {
 	gmo.name = "gmo"
 	gmo.host = "api.coin.z.com"
 
-	if key.APIKey == "" || key.APISecKey == "" {
-		return nil, errors.New("APIKey and APISecKey Required")
-	}
-	gmo.key = keyStruct{
-		id:  key.APIKey,
-		sec: key.APISecKey,
-	}
-
-	gmo.httpClient = new(http.Client)
-	if key.SpecificParam["proxyURL"] != nil {
-		gmo.httpClient = &http.Client{
-			Transport: &http.Transport{
-				Proxy: http.ProxyURL(key.SpecificParam["proxyURL"].(*url.URL)),
-			},
-		}
+	// additional_keys 複数のキーを順番に使う
+	keys, err := sign.PoolOf(key)
+	if err != nil {
+		return nil, err
 	}
+	keys.Reject = sign.GmoRejected
+	authKey, _ := sign.KeyOf(key)
+	gmo.authKey = authKey.ID()
 
-	if key.SpecificParam["timeoutMS"] != nil {
-		gmo.httpClient.Timeout = time.Duration(key.SpecificParam["timeoutMS"].(int)) * time.Millisecond
-	}
+	gmo.client = httpx.New(key, httpx.Options{
+		Name:        gmo.name,
+		RateLimiter: ratelimit.New(ratelimit.Gmo()),
+		Retry:       retry.Gmo(),
+		Signer:      sign.Gmo(keys),
+	})
 
 	return &gmo, nil
 }
@@ -466,6 +457,65 @@ func (gmo *gmo) Boards(symbol string) (board.Board, error) {
 	}, nil
 }
 
+func (gmo *gmo) Executions(symbol string) ([]execution.Execution, error) {
+	type Req struct {
+		Symbol string `json:"symbol"`
+	}
+	res, err := gmo.getRequest("/public/v1/trades", &Req{
+		Symbol: symbol,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// レスポンスの変換
+	type Res struct {
+		Status int `json:"status"`
+		Data   struct {
+			List []struct {
+				Price     string    `json:"price"`
+				Side      string    `json:"side"`
+				Size      string    `json:"size"`
+				Timestamp time.Time `json:"timestamp"`
+			} `json:"list"`
+		} `json:"data"`
+	}
+	resData := Res{}
+	json.Unmarshal(res, &resData)
+	if resData.Status != 0 {
+		return nil, errors.New(string(res))
+	}
+
+	// 約定IDがないので時刻と同じ時刻の中での順番から作る
+	// 新しい順に返るので古い方から数えると次の取得でも変わらない
+	list := resData.Data.List
+	localIDs := make([]string, len(list))
+	seq := map[int64]int{}
+	for i := len(list) - 1; i >= 0; i-- {
+		ts := list[i].Timestamp.UnixNano()
+		localIDs[i] = fmt.Sprintf("%d-%d", ts, seq[ts])
+		seq[ts]++
+	}
+
+	// 返却値の作成
+	ret := []execution.Execution{}
+	for i, data := range list {
+		price, _ := strconv.ParseFloat(data.Price, 64)
+		size, _ := strconv.ParseFloat(data.Size, 64)
+		ret = append(ret, execution.Execution{
+			ID: id.NewID(gmo.name, symbol, localIDs[i]),
+			Norm: base.Norm{
+				Price: price,
+				Size:  size,
+			},
+			IsBuy:     data.Side == "BUY",
+			OccuredAt: data.Timestamp,
+		})
+	}
+
+	return ret, nil
+}
+
 func (gmo *gmo) InScheduledMaintenance() bool {
 	// jst := utiltime.Jst()
 	// // 355 <= time <= 415で落とす
@@ -498,12 +548,12 @@ func (gmo *gmo) getRequest(path string, param interface{}) ([]byte, error) {
 
 	req.Header.Add("Content-Type", "application/json")
 
-	pathSplited := strings.Split(path, "private")
-	if len(pathSplited) > 1 {
-		gmo.addSignature(req, "GET", pathSplited[1], nil)
+	// privateのみ署名する
+	if !strings.Contains(path, "private") {
+		req = sign.Public(req)
 	}
 
-	return gmo.request(req)
+	return gmo.client.Do(req)
 }
 
 func (gmo *gmo) postRequest(path string, param interface{}) ([]byte, error) {
@@ -517,12 +567,12 @@ func (gmo *gmo) postRequest(path string, param interface{}) ([]byte, error) {
 
 	req.Header.Add("Content-Type", "application/json")
 
-	pathSplited := strings.Split(path, "private")
-	if len(pathSplited) > 1 {
-		gmo.addSignature(req, "POST", pathSplited[1], param)
+	// privateのみ署名する
+	if !strings.Contains(path, "private") {
+		req = sign.Public(req)
 	}
 
-	return gmo.request(req)
+	return gmo.client.Do(req)
 }
 
 func structToQuery(data interface{}) string {
@@ -546,46 +596,6 @@ func structToQuery(data interface{}) string {
 	return strings.Join(queries, "&")
 }
 
-func (gmo *gmo) addSignature(req *http.Request, method, path string, param interface{}) {
-	key := gmo.key
-
-	timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
-	rawSig := timestamp + method + path
-	if param != nil {
-		byteParam, _ := json.Marshal(param)
-		rawSig += string(byteParam)
-	}
-
-	hc := hmac.New(sha256.New, []byte(key.sec))
-	hc.Write([]byte(rawSig))
-	sign := hex.EncodeToString(hc.Sum(nil))
-
-	req.Header.Add("API-KEY", key.id)
-	req.Header.Add("API-TIMESTAMP", timestamp)
-	req.Header.Add("API-SIGN", sign)
-}
-
-func (gmo *gmo) request(req *http.Request) ([]byte, error) {
-	resp, err := gmo.httpClient.Do(req)
-
-	if err != nil {
-		errStr := fmt.Sprintf("err ==> %+v\nreq ==> %v\n", err, req)
-		return nil, errors.New(errStr)
-	}
-	if resp.StatusCode != 200 {
-		body, _ := ioutil.ReadAll(resp.Body)
-		errStr := ""
-		errStr += fmt.Sprintf("body ==> %s\n", string(body))
-		errStr += fmt.Sprintf("resp ==> %+v\nreq ==> %v\n", resp, req)
-		return nil, errors.New(errStr)
-	}
-
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-
-	return body, err
-}
-
 func (gmo *gmo) UpdateLTP(lastTimePrice float64) error {
 	return errors.New("not supported.")
 }
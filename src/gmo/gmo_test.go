@@ -0,0 +1,32 @@
+package gmo
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/httpx/httpxtest"
+)
+
+func TestExecutionIDs(t *testing.T) {
+	trade := `{"price":"100","side":"BUY","size":"0.1","timestamp":"2021-01-01T00:00:00.123Z"}`
+	list := trade + "," + trade
+	transport := httpxtest.Transport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":0,"data":{"list":[` + list + `]}}`))
+	}))
+	ex, _ := New(exchange.Key{APIKey: "key", APISecKey: "secret", SpecificParam: map[string]interface{}{"transport": transport}})
+	reader := ex.(exchange.ExecutionsReader)
+
+	// 同じ時刻, 価格, 数量の約定も別の約定になる
+	first, err := reader.Executions("BTC")
+	if err != nil || len(first) != 2 || first[0].LocalID == first[1].LocalID {
+		t.Fatal(err, first)
+	}
+
+	// 新しい約定が先頭に増えても同じ約定のIDは変わらない
+	list = `{"price":"101","side":"SELL","size":"0.2","timestamp":"2021-01-01T00:00:00.456Z"},` + list
+	second, err := reader.Executions("BTC")
+	if err != nil || len(second) != 3 || second[1].LocalID != first[0].LocalID || second[2].LocalID != first[1].LocalID {
+		t.Fatal(err, first, second)
+	}
+}
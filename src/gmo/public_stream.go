@@ -0,0 +1,261 @@
+package gmo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/ticker"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/wsconn"
+)
+
+type publicStream struct {
+	name     string
+	endpoint string
+	proxyURL *url.URL
+
+	mu     sync.Mutex
+	conn   *wsconn.Conn
+	topics []exchange.Topic
+	queue  *wsconn.Queue
+}
+
+// NewPublicStream return stream of trades, orderbooks and ticker.
+func NewPublicStream(key exchange.Key) (exchange.PublicStream, error) {
+	ps := publicStream{}
+	ps.name = "gmo"
+	ps.endpoint = "wss://api.coin.z.com/ws/public/v1"
+	if key.SpecificParam["proxyURL"] != nil {
+		ps.proxyURL = key.SpecificParam["proxyURL"].(*url.URL)
+	}
+	ps.queue = &wsconn.Queue{}
+
+	return &ps, nil
+}
+
+func (ps *publicStream) Subscribe(topics ...exchange.Topic) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.topics = append(ps.topics, topics...)
+	if ps.conn == nil {
+		return nil
+	}
+	return subscribeTopics(ps.conn, topics)
+}
+
+func (ps *publicStream) Start() error {
+	conn, err := wsconn.Dial(ps.endpoint, ps.proxyURL)
+	if err != nil {
+		return err
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if err := subscribeTopics(conn, ps.topics); err != nil {
+		conn.Close()
+		return err
+	}
+	ps.conn = conn
+	conn.WakeOnClose(ps.queue)
+	conn.Listen(ps.handle)
+	return nil
+}
+
+func (ps *publicStream) Close() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return nil
+	}
+	err := ps.conn.Close()
+	ps.conn = nil
+	return err
+}
+
+// Ready receive when Read may return a message or the error of the connection.
+func (ps *publicStream) Ready() <-chan struct{} {
+	return ps.queue.Ready()
+}
+
+func (ps *publicStream) Read() (*exchange.Message, error) {
+	if v := ps.queue.Pop(); v != nil {
+		msg := v.(exchange.Message)
+		return &msg, nil
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return nil, errors.New("stream is not started.")
+	}
+	return nil, ps.conn.Err()
+}
+
+func (ps *publicStream) Ping() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return errors.New("stream is not started.")
+	}
+	return ps.conn.Ping()
+}
+
+func (ps *publicStream) LastReceived() time.Time {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.conn == nil {
+		return time.Time{}
+	}
+	return ps.conn.LastReceived()
+}
+
+// 購読は1秒に1回までの制限がある
+func subscribeTopics(conn *wsconn.Conn, topics []exchange.Topic) error {
+	type Req struct {
+		Command string `json:"command"`
+		Channel string `json:"channel"`
+		Symbol  string `json:"symbol"`
+	}
+	for i, topic := range topics {
+		channel := map[exchange.Channel]string{
+			exchange.ExecutionsChannel: "trades",
+			exchange.BoardChannel:      "orderbooks",
+			exchange.TickerChannel:     "ticker",
+		}[topic.Channel]
+		if channel == "" {
+			return fmt.Errorf("channel %s not supported.", topic.Channel)
+		}
+		if i > 0 {
+			time.Sleep(time.Second)
+		}
+		if err := conn.WriteJSON(Req{Command: "subscribe", Channel: channel, Symbol: topic.Symbol}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ps *publicStream) handle(msg []byte) {
+	type Res struct {
+		Channel string `json:"channel"`
+	}
+	resData := Res{}
+	if err := json.Unmarshal(msg, &resData); err != nil {
+		return
+	}
+
+	switch resData.Channel {
+	case "trades":
+		ps.handleTrade(msg)
+	case "orderbooks":
+		ps.handleOrderbook(msg)
+	case "ticker":
+		ps.handleTicker(msg)
+	}
+}
+
+func (ps *publicStream) handleTrade(msg []byte) {
+	type Res struct {
+		Price     string    `json:"price"`
+		Side      string    `json:"side"`
+		Size      string    `json:"size"`
+		Timestamp time.Time `json:"timestamp"`
+		Symbol    string    `json:"symbol"`
+	}
+	data := Res{}
+	json.Unmarshal(msg, &data)
+
+	price, _ := strconv.ParseFloat(data.Price, 64)
+	size, _ := strconv.ParseFloat(data.Size, 64)
+	// 約定IDは配信されない
+	ps.queue.Push(exchange.Message{
+		Topic: exchange.Topic{Channel: exchange.ExecutionsChannel, Symbol: data.Symbol},
+		Execution: &execution.Execution{
+			ID: id.NewID(ps.name, data.Symbol, ""),
+			Norm: base.Norm{
+				Price: price,
+				Size:  size,
+			},
+			IsBuy:     data.Side == "BUY",
+			OccuredAt: data.Timestamp,
+		},
+	})
+}
+
+func (ps *publicStream) handleOrderbook(msg []byte) {
+	type level struct {
+		Price string `json:"price"`
+		Size  string `json:"size"`
+	}
+	type Res struct {
+		Asks      []level   `json:"asks"`
+		Bids      []level   `json:"bids"`
+		Symbol    string    `json:"symbol"`
+		Timestamp time.Time `json:"timestamp"`
+	}
+	data := Res{}
+	json.Unmarshal(msg, &data)
+
+	toNorms := func(levels []level) []base.Norm {
+		ret := []base.Norm{}
+		for _, v := range levels {
+			price, _ := strconv.ParseFloat(v.Price, 64)
+			size, _ := strconv.ParseFloat(v.Size, 64)
+			ret = append(ret, base.Norm{Price: price, Size: size})
+		}
+		return ret
+	}
+
+	// 毎回スナップショットが届く
+	b := board.Board{
+		ExchangeName: ps.name,
+		Symbol:       data.Symbol,
+		Asks:         toNorms(data.Asks),
+		Bids:         toNorms(data.Bids),
+	}
+	if len(b.Asks) > 0 && len(b.Bids) > 0 {
+		b.MidPrice = (b.Asks[0].Price + b.Bids[0].Price) / 2
+	}
+	ps.queue.Push(exchange.Message{
+		Topic: exchange.Topic{Channel: exchange.BoardChannel, Symbol: data.Symbol},
+		Board: &b,
+	})
+}
+
+func (ps *publicStream) handleTicker(msg []byte) {
+	type Res struct {
+		Ask       string    `json:"ask"`
+		Bid       string    `json:"bid"`
+		Last      string    `json:"last"`
+		Volume    string    `json:"volume"`
+		Symbol    string    `json:"symbol"`
+		Timestamp time.Time `json:"timestamp"`
+	}
+	data := Res{}
+	json.Unmarshal(msg, &data)
+
+	ask, _ := strconv.ParseFloat(data.Ask, 64)
+	bid, _ := strconv.ParseFloat(data.Bid, 64)
+	last, _ := strconv.ParseFloat(data.Last, 64)
+	volume, _ := strconv.ParseFloat(data.Volume, 64)
+	ps.queue.Push(exchange.Message{
+		Topic: exchange.Topic{Channel: exchange.TickerChannel, Symbol: data.Symbol},
+		Ticker: &ticker.Ticker{
+			ExchangeName: ps.name,
+			Symbol:       data.Symbol,
+			BestBid:      bid,
+			BestAsk:      ask,
+			LTP:          last,
+			Volume:       volume,
+			OccuredAt:    data.Timestamp,
+		},
+	})
+}
@@ -0,0 +1,476 @@
+package gmo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/domains/stock"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/sign"
+	"github.com/TTRSQ/ccew/util/wsconn"
+)
+
+// アクセストークンの有効期限は60分なので余裕を持って延長する
+const tokenExtendInterval = 50 * time.Minute
+
+type privateStream struct {
+	name     string
+	endpoint string
+	rest     *gmo
+	proxyURL *url.URL
+
+	conn  *wsconn.Conn
+	queue *wsconn.Queue
+	token string
+	stop  chan struct{}
+
+	// positionID => 符号付きのsize
+	posMu     sync.Mutex
+	positions map[string]map[int]float64
+}
+
+// NewPrivateStream return stream of orderEvents, executionEvents and positionEvents.
+func NewPrivateStream(key exchange.Key) (exchange.PrivateStream, error) {
+	rest, err := New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := privateStream{}
+	ps.name = "gmo"
+	ps.endpoint = "wss://api.coin.z.com/ws/private/v1/"
+	ps.rest = rest.(*gmo)
+	if key.SpecificParam["proxyURL"] != nil {
+		ps.proxyURL = key.SpecificParam["proxyURL"].(*url.URL)
+	}
+	ps.queue = &wsconn.Queue{}
+	ps.positions = map[string]map[int]float64{}
+
+	return &ps, nil
+}
+
+func (ps *privateStream) Start() error {
+	// Closeせずに再開した場合は前の接続とトークンの延長を止める
+	ps.stopExtend()
+	if ps.conn != nil {
+		ps.conn.Close()
+		ps.conn = nil
+	}
+
+	// アクセストークンの発行
+	res, err := ps.rest.wsAuthRequest("POST", struct{}{})
+	if err != nil {
+		return err
+	}
+	type Res struct {
+		Status   int    `json:"status"`
+		Token    string `json:"data"`
+		Messages []struct {
+			MessageCode   string `json:"message_code"`
+			MessageString string `json:"message_string"`
+		} `json:"messages"`
+	}
+	resData := Res{}
+	json.Unmarshal(res, &resData)
+	if resData.Status != 0 {
+		return errors.New(fmt.Sprintf("%+v", resData.Messages))
+	}
+
+	conn, err := wsconn.Dial(ps.endpoint+resData.Token, ps.proxyURL)
+	if err != nil {
+		return err
+	}
+
+	// 購読 (1秒に1回までの制限がある)
+	type Req struct {
+		Command string `json:"command"`
+		Channel string `json:"channel"`
+	}
+	for i, channel := range []string{"orderEvents", "executionEvents", "positionEvents"} {
+		if i > 0 {
+			time.Sleep(time.Second)
+		}
+		if err := conn.WriteJSON(Req{Command: "subscribe", Channel: channel}); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	// 接続前からある建玉を取得しておく. 購読後に取得するので取りこぼさない
+	positions, err := ps.rest.allOpenPositions()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	ps.posMu.Lock()
+	ps.positions = positions
+	ps.posMu.Unlock()
+
+	ps.conn = conn
+	conn.WakeOnClose(ps.queue)
+	ps.token = resData.Token
+	ps.stop = make(chan struct{})
+	conn.Listen(ps.handle)
+	go ps.extendToken(ps.token, ps.stop)
+	return nil
+}
+
+func (ps *privateStream) Close() error {
+	if ps.conn == nil {
+		return nil
+	}
+	ps.stopExtend()
+	ps.rest.wsAuthRequest("DELETE", &tokenReq{Token: ps.token})
+	err := ps.conn.Close()
+	ps.conn = nil
+	return err
+}
+
+// Ready receive when Read may return a message or the error of the connection.
+func (ps *privateStream) Ready() <-chan struct{} {
+	return ps.queue.Ready()
+}
+
+func (ps *privateStream) Read() (*orderevent.Event, error) {
+	if v := ps.queue.Pop(); v != nil {
+		ev := v.(orderevent.Event)
+		return &ev, nil
+	}
+	if ps.conn == nil {
+		return nil, errors.New("stream is not started.")
+	}
+	return nil, ps.conn.Err()
+}
+
+func (ps *privateStream) Ping() error {
+	if ps.conn == nil {
+		return errors.New("stream is not started.")
+	}
+	return ps.conn.Ping()
+}
+
+func (ps *privateStream) LastReceived() time.Time {
+	if ps.conn == nil {
+		return time.Time{}
+	}
+	return ps.conn.LastReceived()
+}
+
+type tokenReq struct {
+	Token string `json:"token"`
+}
+
+func (ps *privateStream) stopExtend() {
+	if ps.stop != nil {
+		close(ps.stop)
+		ps.stop = nil
+	}
+}
+
+func (ps *privateStream) extendToken(token string, stop chan struct{}) {
+	ticker := time.NewTicker(tokenExtendInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// 延長に失敗した場合は期限切れで切断されるので, 再接続側で新しいトークンを発行する
+			ps.rest.wsAuthRequest("PUT", &tokenReq{Token: token})
+		}
+	}
+}
+
+func (ps *privateStream) handle(msg []byte) {
+	type Res struct {
+		Channel string `json:"channel"`
+	}
+	resData := Res{}
+	if err := json.Unmarshal(msg, &resData); err != nil {
+		return
+	}
+
+	switch resData.Channel {
+	case "orderEvents":
+		ps.handleOrderEvent(msg)
+	case "executionEvents":
+		ps.handleExecutionEvent(msg)
+	case "positionEvents":
+		ps.handlePositionEvent(msg)
+	}
+}
+
+func (ps *privateStream) handleOrderEvent(msg []byte) {
+	type Res struct {
+		OrderID           int       `json:"orderId"`
+		Symbol            string    `json:"symbol"`
+		Side              string    `json:"side"`
+		ExecutionType     string    `json:"executionType"`
+		OrderStatus       string    `json:"orderStatus"`
+		CancelType        string    `json:"cancelType"`
+		OrderTimestamp    time.Time `json:"orderTimestamp"`
+		OrderPrice        string    `json:"orderPrice"`
+		OrderSize         string    `json:"orderSize"`
+		OrderExecutedSize string    `json:"orderExecutedSize"`
+		MsgType           string    `json:"msgType"`
+	}
+	data := Res{}
+	json.Unmarshal(msg, &data)
+
+	price, _ := strconv.ParseFloat(data.OrderPrice, 64)
+	size, _ := strconv.ParseFloat(data.OrderSize, 64)
+	executedSize, _ := strconv.ParseFloat(data.OrderExecutedSize, 64)
+	ev := orderevent.Event{
+		ID:        id.NewID(ps.name, data.Symbol, fmt.Sprint(data.OrderID)),
+		IsBuy:     data.Side == "BUY",
+		OrderType: data.ExecutionType,
+		Norm: base.Norm{
+			Price: price,
+			Size:  size,
+		},
+		ExecutedSize:  executedSize,
+		RemainingSize: size - executedSize,
+		OccuredAt:     data.OrderTimestamp,
+	}
+
+	// 約定はexecutionEventsで流すので, ここでは状態の変化のみ扱う
+	switch data.OrderStatus {
+	case "ORDERED":
+		if data.MsgType == "ER" {
+			return
+		}
+		ev.Type = orderevent.Accepted
+	case "CANCELED":
+		ev.Type = orderevent.Canceled
+		ev.Reason = data.CancelType
+		switch data.CancelType {
+		case "EXPIRED_FAK", "EXPIRED_FOK", "EXPIRED_SOK":
+			ev.Type = orderevent.Expired
+		}
+	case "EXPIRED":
+		ev.Type = orderevent.Expired
+	default:
+		return
+	}
+	ps.queue.Push(ev)
+}
+
+func (ps *privateStream) handleExecutionEvent(msg []byte) {
+	type Res struct {
+		OrderID            int       `json:"orderId"`
+		ExecutionID        int       `json:"executionId"`
+		Symbol             string    `json:"symbol"`
+		ExecutionType      string    `json:"executionType"`
+		Side               string    `json:"side"`
+		ExecutionPrice     string    `json:"executionPrice"`
+		ExecutionSize      string    `json:"executionSize"`
+		ExecutionTimestamp time.Time `json:"executionTimestamp"`
+		Fee                string    `json:"fee"`
+		OrderPrice         string    `json:"orderPrice"`
+		OrderSize          string    `json:"orderSize"`
+		OrderExecutedSize  string    `json:"orderExecutedSize"`
+	}
+	data := Res{}
+	json.Unmarshal(msg, &data)
+
+	price, _ := strconv.ParseFloat(data.OrderPrice, 64)
+	size, _ := strconv.ParseFloat(data.OrderSize, 64)
+	executedSize, _ := strconv.ParseFloat(data.OrderExecutedSize, 64)
+	execPrice, _ := strconv.ParseFloat(data.ExecutionPrice, 64)
+	execSize, _ := strconv.ParseFloat(data.ExecutionSize, 64)
+	fee, _ := strconv.ParseFloat(data.Fee, 64)
+
+	ev := orderevent.Event{
+		ID:        id.NewID(ps.name, data.Symbol, fmt.Sprint(data.OrderID)),
+		Type:      orderevent.PartiallyFilled,
+		IsBuy:     data.Side == "BUY",
+		OrderType: data.ExecutionType,
+		Norm: base.Norm{
+			Price: price,
+			Size:  size,
+		},
+		ExecutedSize:  executedSize,
+		RemainingSize: size - executedSize,
+		Fill: &orderevent.Fill{
+			ExecutionID: fmt.Sprint(data.ExecutionID),
+			Norm: base.Norm{
+				Price: execPrice,
+				Size:  execSize,
+			},
+			Fee:         fee,
+			FeeCurrency: "JPY",
+		},
+		OccuredAt: data.ExecutionTimestamp,
+	}
+	if executedSize >= size {
+		ev.Type = orderevent.Filled
+	}
+	ps.queue.Push(ev)
+}
+
+func (ps *privateStream) handlePositionEvent(msg []byte) {
+	type Res struct {
+		PositionID int       `json:"positionId"`
+		Symbol     string    `json:"symbol"`
+		Side       string    `json:"side"`
+		Size       string    `json:"size"`
+		Timestamp  time.Time `json:"timestamp"`
+		MsgType    string    `json:"msgType"`
+	}
+	data := Res{}
+	json.Unmarshal(msg, &data)
+
+	size, _ := strconv.ParseFloat(data.Size, 64)
+	if data.Side == "SELL" {
+		size = -size
+	}
+
+	// GMOは建玉単位で通知されるので銘柄ごとに集計する
+	ps.posMu.Lock()
+	if ps.positions[data.Symbol] == nil {
+		ps.positions[data.Symbol] = map[int]float64{}
+	}
+	if data.MsgType == "CPR" {
+		delete(ps.positions[data.Symbol], data.PositionID)
+	} else {
+		ps.positions[data.Symbol][data.PositionID] = size
+	}
+	pos := stock.Stock{Symbol: data.Symbol}
+	for _, v := range ps.positions[data.Symbol] {
+		pos.Summary += v
+		if v > 0 {
+			pos.LongSize += v
+		} else {
+			pos.ShortSize -= v
+		}
+	}
+	ps.posMu.Unlock()
+
+	ps.queue.Push(orderevent.Event{
+		ID:        id.NewID(ps.name, data.Symbol, ""),
+		Type:      orderevent.PositionChanged,
+		Position:  &pos,
+		OccuredAt: data.Timestamp,
+	})
+}
+
+// return symbol => positionID => signed size of all symbols having positions.
+func (gmo *gmo) allOpenPositions() (map[string]map[int]float64, error) {
+	// 銘柄を指定しなければ全銘柄の集計が返る
+	res, err := gmo.getRequest("/private/v1/positionSummary", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	type Res struct {
+		Status int `json:"status"`
+		Data   struct {
+			List []struct {
+				Symbol string `json:"symbol"`
+			} `json:"list"`
+		} `json:"data"`
+		Messages []struct {
+			MessageCode   string `json:"message_code"`
+			MessageString string `json:"message_string"`
+		} `json:"messages"`
+	}
+	resData := Res{}
+	json.Unmarshal(res, &resData)
+	if resData.Status != 0 {
+		return nil, errors.New(fmt.Sprintf("%+v", resData.Messages))
+	}
+
+	ret := map[string]map[int]float64{}
+	for _, data := range resData.Data.List {
+		if ret[data.Symbol] != nil {
+			continue
+		}
+		positions, err := gmo.openPositions(data.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		ret[data.Symbol] = positions
+	}
+	return ret, nil
+}
+
+// openPositionsCount 1ページの取得件数. APIの上限
+const openPositionsCount = 100
+
+// return positionID => signed size.
+func (gmo *gmo) openPositions(symbol string) (map[int]float64, error) {
+	type Req struct {
+		Symbol string `json:"symbol"`
+		Page   int    `json:"page"`
+		Count  int    `json:"count"`
+	}
+	type Res struct {
+		Status int `json:"status"`
+		Data   struct {
+			List []struct {
+				PositionID int    `json:"positionId"`
+				Side       string `json:"side"`
+				Size       string `json:"size"`
+			} `json:"list"`
+		} `json:"data"`
+		Messages []struct {
+			MessageCode   string `json:"message_code"`
+			MessageString string `json:"message_string"`
+		} `json:"messages"`
+	}
+
+	ret := map[int]float64{}
+	// リストが尽きるまでページを進める
+	for page := 1; ; page++ {
+		res, err := gmo.getRequest("/private/v1/openPositions", &Req{
+			Symbol: symbol,
+			Page:   page,
+			Count:  openPositionsCount,
+		})
+		if err != nil {
+			return nil, err
+		}
+		resData := Res{}
+		json.Unmarshal(res, &resData)
+		if resData.Status != 0 {
+			return nil, errors.New(fmt.Sprintf("%+v", resData.Messages))
+		}
+
+		for _, data := range resData.Data.List {
+			size, _ := strconv.ParseFloat(data.Size, 64)
+			if data.Side == "SELL" {
+				size = -size
+			}
+			ret[data.PositionID] = size
+		}
+		if len(resData.Data.List) < openPositionsCount {
+			return ret, nil
+		}
+	}
+}
+
+// ws-authは署名にbodyを含めない. sign.Gmoが扱う
+// トークンは常に同じキーで発行, 延長, 削除する
+func (gmo *gmo) wsAuthRequest(method string, param interface{}) ([]byte, error) {
+	u := url.URL{Scheme: "https", Host: gmo.host, Path: "/private/v1/ws-auth"}
+	jsonParam, _ := json.Marshal(param)
+	req, _ := http.NewRequest(
+		method,
+		u.String(),
+		bytes.NewBuffer(jsonParam),
+	)
+
+	req.Header.Add("Content-Type", "application/json")
+
+	return gmo.client.Do(sign.Pin(req, gmo.authKey))
+}
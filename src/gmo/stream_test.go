@@ -0,0 +1,91 @@
+package gmo
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/httpx/httpxtest"
+	"github.com/TTRSQ/ccew/util/wsconn"
+)
+
+func TestHandlePrivateEvents(t *testing.T) {
+	// 接続前からある建玉はStartで取得済み
+	ps := privateStream{name: "gmo", queue: &wsconn.Queue{}, positions: map[string]map[int]float64{
+		"BTC_JPY": {1: 0.5},
+	}}
+	for _, msg := range []string{
+		`{"channel":"orderEvents","orderId":100,"symbol":"BTC_JPY","side":"BUY","executionType":"LIMIT","orderStatus":"ORDERED","orderTimestamp":"2021-01-01T00:00:00.123Z","orderPrice":"3000000","orderSize":"0.2","orderExecutedSize":"0","msgType":"NOR"}`,
+		`{"channel":"executionEvents","orderId":100,"executionId":7,"symbol":"BTC_JPY","executionType":"LIMIT","side":"BUY","executionPrice":"3000000","executionSize":"0.1","executionTimestamp":"2021-01-01T00:00:01Z","fee":"0","orderPrice":"3000000","orderSize":"0.2","orderExecutedSize":"0.1"}`,
+		`{"channel":"orderEvents","orderId":100,"symbol":"BTC_JPY","side":"BUY","executionType":"LIMIT","orderStatus":"ORDERED","orderTimestamp":"2021-01-01T00:00:00.123Z","orderPrice":"3000000","orderSize":"0.2","orderExecutedSize":"0.1","msgType":"ER"}`,
+		`{"channel":"positionEvents","positionId":2,"symbol":"BTC_JPY","side":"SELL","size":"0.2","timestamp":"2021-01-01T00:00:01Z","msgType":"OPR"}`,
+		`{"channel":"positionEvents","positionId":1,"symbol":"BTC_JPY","side":"BUY","size":"0.5","timestamp":"2021-01-01T00:00:02Z","msgType":"CPR"}`,
+		`{"channel":"orderEvents","orderId":101,"symbol":"BTC_JPY","side":"SELL","executionType":"MARKET","orderStatus":"CANCELED","cancelType":"EXPIRED_FAK","orderTimestamp":"2021-01-01T00:00:03Z","orderPrice":"0","orderSize":"0.1","orderExecutedSize":"0","msgType":"CAN"}`,
+	} {
+		ps.handle([]byte(msg))
+	}
+
+	want := []struct {
+		typ     orderevent.Type
+		localID string
+	}{
+		{orderevent.Accepted, "100"},
+		{orderevent.PartiallyFilled, "100"},
+		{orderevent.PositionChanged, ""},
+		{orderevent.PositionChanged, ""},
+		{orderevent.Expired, "101"},
+	}
+	summaries := []float64{0.3, -0.2}
+	for i, w := range want {
+		v := ps.queue.Pop()
+		if v == nil {
+			t.Fatalf("event %d not found", i)
+		}
+		got := v.(orderevent.Event)
+		if got.Type != w.typ || got.ID.LocalID != w.localID {
+			t.Errorf("event %d: %s %s", i, got.Type, got.ID.LocalID)
+		}
+		if i == 1 && (got.Fill == nil || got.Fill.ExecutionID != "7" || got.Fill.Size != 0.1 || got.RemainingSize != 0.1) {
+			t.Errorf("fill %+v %+v", got, got.Fill)
+		}
+		if w.typ == orderevent.PositionChanged {
+			want := summaries[0]
+			summaries = summaries[1:]
+			// 浮動小数点の誤差を許す
+			if got.Position == nil || got.Position.Summary-want > 1e-9 || want-got.Position.Summary > 1e-9 {
+				t.Errorf("position %+v want %v", got.Position, want)
+			}
+		}
+	}
+	if ps.queue.Pop() != nil {
+		t.Error("unexpected event")
+	}
+}
+
+func TestOpenPositionsPages(t *testing.T) {
+	// 1ページ目は上限まで埋まり, 2ページ目で尽きる
+	transport := httpxtest.Transport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		size := 0
+		if page == 1 {
+			size = openPositionsCount
+		} else if page == 2 {
+			size = 1
+		}
+		list := []string{}
+		for i := 0; i < size; i++ {
+			list = append(list, fmt.Sprintf(`{"positionId":%d,"side":"BUY","size":"0.1"}`, page*1000+i))
+		}
+		w.Write([]byte(`{"status":0,"data":{"list":[` + strings.Join(list, ",") + `]}}`))
+	}))
+	ex, _ := New(exchange.Key{APIKey: "key", APISecKey: "secret", SpecificParam: map[string]interface{}{"transport": transport}})
+
+	positions, err := ex.(*gmo).openPositions("BTC_JPY")
+	if err != nil || len(positions) != openPositionsCount+1 || positions[2000] != 0.1 {
+		t.Fatal(err, len(positions))
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -15,25 +14,22 @@ import (
 
 	"github.com/TTRSQ/ccew/domains/base"
 	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
 	"github.com/TTRSQ/ccew/domains/order"
 	"github.com/TTRSQ/ccew/domains/order/id"
 	"github.com/TTRSQ/ccew/domains/stock"
 	"github.com/TTRSQ/ccew/interface/exchange"
-	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/TTRSQ/ccew/util/httpx"
+	"github.com/TTRSQ/ccew/util/ratelimit"
+	"github.com/TTRSQ/ccew/util/retry"
+	"github.com/TTRSQ/ccew/util/sign"
 )
 
-type keyStruct struct {
-	id  string
-	sec string
-}
-
 type liquid struct {
-	keys       []keyStruct
-	host       string
-	name       string
-	keyIdx     int
-	httpClient *http.Client
-	useNetOut  bool
+	host      string
+	name      string
+	client    *httpx.Client
+	useNetOut bool
 }
 
 var productIDMap map[string]int
@@ -68,33 +64,18 @@ func New(key exchange.Key) (exchange.Exchange, error) {
 	lq.name = "liquid"
 	lq.host = "api.liquid.com"
 
-	if key.APIKey == "" || key.APISecKey == "" {
-		return nil, errors.New("APIKey and APISecKey Required")
-	}
-	lq.keys = []keyStruct{
-		{
-			id:  key.APIKey,
-			sec: key.APISecKey,
-		},
-	}
-
-	// nonceError回避用のkeyを追加する
-	_, exist := key.SpecificParam["additional_keys"]
-	if exist {
-		additionalKeys := key.SpecificParam["additional_keys"].([][]string)
-		for i := range additionalKeys {
-			lq.keys = append(lq.keys, keyStruct{
-				id:  additionalKeys[i][0],
-				sec: additionalKeys[i][1],
-			})
-		}
+	// additional_keys 複数のキーを順番に使う
+	keys, err := sign.PoolOf(key)
+	if err != nil {
+		return nil, err
 	}
 
-	lq.httpClient = new(http.Client)
-
-	if key.SpecificParam["timeoutMS"] != nil {
-		lq.httpClient.Timeout = time.Duration(key.SpecificParam["timeoutMS"].(int)) * time.Millisecond
-	}
+	lq.client = httpx.New(key, httpx.Options{
+		Name:        lq.name,
+		RateLimiter: ratelimit.New(ratelimit.Liquid()),
+		Retry:       retry.Liquid(),
+		Signer:      sign.Liquid(keys),
+	})
 
 	if key.SpecificParam["useNetOut"] != nil {
 		lq.useNetOut = key.SpecificParam["useNetOut"].(bool)
@@ -465,6 +446,51 @@ func (lq *liquid) Boards(symbol string) (board.Board, error) {
 	}, nil
 }
 
+func (lq *liquid) Executions(symbol string) ([]execution.Execution, error) {
+	type Req struct {
+		ProductID int `json:"product_id"`
+		Limit     int `json:"limit"`
+	}
+	res, err := lq.getRequest("/executions", &Req{
+		ProductID: productIDMap[symbol],
+		Limit:     100,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// レスポンスの変換
+	type Res struct {
+		Models []struct {
+			ID        int64  `json:"id"`
+			Quantity  string `json:"quantity"`
+			Price     string `json:"price"`
+			TakerSide string `json:"taker_side"`
+			CreatedAt int64  `json:"created_at"`
+		} `json:"models"`
+	}
+	resData := Res{}
+	json.Unmarshal(res, &resData)
+
+	// 返却値の作成
+	ret := []execution.Execution{}
+	for _, data := range resData.Models {
+		price, _ := strconv.ParseFloat(data.Price, 64)
+		size, _ := strconv.ParseFloat(data.Quantity, 64)
+		ret = append(ret, execution.Execution{
+			ID: id.NewID(lq.name, symbol, fmt.Sprint(data.ID)),
+			Norm: base.Norm{
+				Price: price,
+				Size:  size,
+			},
+			IsBuy:     data.TakerSide == "buy",
+			OccuredAt: time.Unix(data.CreatedAt, 0),
+		})
+	}
+
+	return ret, nil
+}
+
 func (lq *liquid) InScheduledMaintenance() bool {
 	// jst := utiltime.Jst()
 	// // 355 <= time <= 415で落とす
@@ -491,10 +517,9 @@ func (lq *liquid) getRequest(path string, param interface{}) ([]byte, error) {
 	)
 
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("X-Quoine-Auth", lq.makeSignature(path+"?"+query))
 	req.Header.Add("X-Quoine-API-Version", "2")
 
-	return lq.request(req)
+	return lq.client.Do(req)
 }
 
 func (lq *liquid) putRequest(path string, param interface{}) ([]byte, error) {
@@ -507,10 +532,9 @@ func (lq *liquid) putRequest(path string, param interface{}) ([]byte, error) {
 	)
 
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("X-Quoine-Auth", lq.makeSignature(path))
 	req.Header.Add("X-Quoine-API-Version", "2")
 
-	return lq.request(req)
+	return lq.client.Do(req)
 }
 
 func (lq *liquid) postRequest(path string, param interface{}) ([]byte, error) {
@@ -523,10 +547,9 @@ func (lq *liquid) postRequest(path string, param interface{}) ([]byte, error) {
 	)
 
 	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("X-Quoine-Auth", lq.makeSignature(path))
 	req.Header.Add("X-Quoine-API-Version", "2")
 
-	return lq.request(req)
+	return lq.client.Do(req)
 }
 
 func structToQuery(data interface{}) string {
@@ -550,61 +573,6 @@ func structToQuery(data interface{}) string {
 	return strings.Join(queries, "&")
 }
 
-func (lq *liquid) makeSignature(path string) string {
-	key := lq.getKey()
-
-	mySigningKey := []byte(key.sec)
-
-	type MyCustomClaims struct {
-		Path    string `json:"path"`
-		Nonce   string `json:"nonce"`
-		TokenId string `json:"token_id"`
-		jwt.StandardClaims
-	}
-
-	// Create the Claims
-	nonce := time.Now().UnixNano() / 1000000
-
-	claims := MyCustomClaims{
-		path,
-		fmt.Sprintf("%d", nonce),
-		fmt.Sprintf("%s", key.id),
-		jwt.StandardClaims{},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	sig, _ := token.SignedString(mySigningKey)
-
-	return sig
-}
-
-func (lq *liquid) getKey() keyStruct {
-	idx := lq.keyIdx
-	lq.keyIdx = (lq.keyIdx + 1) % len(lq.keys)
-	return lq.keys[idx]
-}
-
-func (lq *liquid) request(req *http.Request) ([]byte, error) {
-	resp, err := lq.httpClient.Do(req)
-
-	if err != nil {
-		errStr := fmt.Sprintf("err ==> %+v\nreq ==> %v\n", err, req)
-		return nil, errors.New(errStr)
-	}
-	if resp.StatusCode != 200 {
-		body, _ := ioutil.ReadAll(resp.Body)
-		errStr := ""
-		errStr += fmt.Sprintf("body ==> %s\n", string(body))
-		errStr += fmt.Sprintf("resp ==> %+v\nreq ==> %v\n", resp, req)
-		return nil, errors.New(errStr)
-	}
-
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-
-	return body, err
-}
-
 func (lq *liquid) UpdateLTP(lastTimePrice float64) error {
 	return errors.New("not supported.")
 }
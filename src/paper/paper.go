@@ -0,0 +1,298 @@
+package paper
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/order"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/domains/stock"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/src/dummy"
+)
+
+// paper 市場データは本物の取引所から, 注文は中のdummyで約定させる
+type paper struct {
+	real exchange.Exchange
+	// mu dummyはストリームと注文の両方から呼ばれる
+	mu sync.Mutex
+	dm exchange.Simulator
+}
+
+// New return exchange obj. market data is read from real and orders are filled by an embedded dummy.
+// key.SpecificParam is given to the dummy, e.g. balances. fees default to the schedule of real.
+func New(real exchange.Exchange, key exchange.Key) (exchange.Exchange, error) {
+	if real == nil {
+		return nil, errors.New("real exchange required.")
+	}
+	param := map[string]interface{}{}
+	for k, v := range key.SpecificParam {
+		param[k] = v
+	}
+	if param["name"] == nil {
+		param["name"] = real.ExchangeName()
+	}
+	if param["makerFee"] == nil && param["takerFee"] == nil && param["feeModel"] == nil && param["simulate"] == nil {
+		if _, err := dummy.FeeSchedule(real.ExchangeName()); err == nil {
+			param["simulate"] = real.ExchangeName()
+		}
+	}
+	dm, err := dummy.New(exchange.Key{SpecificParam: param})
+	if err != nil {
+		return nil, err
+	}
+	return &paper{real: real, dm: dm.(exchange.Simulator)}, nil
+}
+
+func (p *paper) OrderTypes() exchange.OrderTypes {
+	return p.real.OrderTypes()
+}
+
+func (p *paper) ExchangeName() string {
+	return p.real.ExchangeName()
+}
+
+func (p *paper) InScheduledMaintenance() bool {
+	return p.real.InScheduledMaintenance()
+}
+
+// Boards the board of real. it is also given to the dummy.
+func (p *paper) Boards(symbol string) (board.Board, error) {
+	b, err := p.real.Boards(symbol)
+	if err != nil {
+		return b, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fed := b
+	fed.Symbol = symbol
+	if err := p.now(); err != nil {
+		return b, err
+	}
+	return b, p.dm.UpdateBoard(fed)
+}
+
+func (p *paper) Executions(symbol string) ([]execution.Execution, error) {
+	reader, ok := p.real.(exchange.ExecutionsReader)
+	if !ok {
+		return nil, errors.New("not supported.")
+	}
+	return reader.Executions(symbol)
+}
+
+func (p *paper) CreateOrder(price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.now(); err != nil {
+		return nil, err
+	}
+	return p.dm.CreateOrder(price, size, isBuy, symbol, p.toDummy(orderType))
+}
+
+func (p *paper) LiquidationOrder(price, size float64, isBuy bool, symbol, orderType string) (*order.Responce, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.now(); err != nil {
+		return nil, err
+	}
+	return p.dm.LiquidationOrder(price, size, isBuy, symbol, p.toDummy(orderType))
+}
+
+func (p *paper) EditOrder(symbol, localID string, price, size float64) (*order.Order, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.now(); err != nil {
+		return nil, err
+	}
+	o, err := p.dm.EditOrder(symbol, localID, price, size)
+	if o != nil {
+		o.OrderType = p.toReal(o.OrderType)
+	}
+	return o, err
+}
+
+func (p *paper) CancelOrder(symbol, localID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.now(); err != nil {
+		return err
+	}
+	return p.dm.CancelOrder(symbol, localID)
+}
+
+func (p *paper) CancelAllOrder(symbol string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.now(); err != nil {
+		return err
+	}
+	return p.dm.CancelAllOrder(symbol)
+}
+
+func (p *paper) ActiveOrders(symbol string) ([]order.Order, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	orders, err := p.dm.ActiveOrders(symbol)
+	for i := range orders {
+		orders[i].OrderType = p.toReal(orders[i].OrderType)
+	}
+	return orders, err
+}
+
+func (p *paper) Stocks(symbol string) (stock.Stock, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dm.Stocks(symbol)
+}
+
+func (p *paper) Balance() ([]base.Balance, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dm.Balance()
+}
+
+func (p *paper) UpdateLTP(ltp float64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dm.UpdateLTP(ltp)
+}
+
+func (p *paper) UpdateBestPrice(bestAsk, bestBid float64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dm.UpdateBestPrice(bestAsk, bestBid)
+}
+
+// now 遅延中の注文を実時間で届ける
+func (p *paper) now() error {
+	return p.dm.UpdateTime(time.Now())
+}
+
+// apply feed a message of the real stream to the dummy.
+func (p *paper) apply(msg *exchange.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.now(); err != nil {
+		return err
+	}
+	switch {
+	case msg.Execution != nil:
+		e := *msg.Execution
+		if e.Symbol == "" {
+			e.Symbol = msg.Symbol
+		}
+		return p.dm.UpdateExecution(e)
+	case msg.Board != nil:
+		b := *msg.Board
+		if b.Symbol == "" {
+			b.Symbol = msg.Symbol
+		}
+		return p.dm.UpdateBoard(b)
+	case msg.Ticker != nil:
+		if msg.Ticker.BestAsk == 0 || msg.Ticker.BestBid == 0 {
+			return nil
+		}
+		return p.dm.UpdateSymbolBestPrice(msg.Symbol, msg.Ticker.BestAsk, msg.Ticker.BestBid)
+	}
+	return nil
+}
+
+// toDummy, toReal 本物の注文種別 (limit, Limit..) とdummyの注文種別を変換する. フラグはそのまま
+func (p *paper) toDummy(orderType string) string {
+	return convertOrderType(orderType, p.real.OrderTypes(), p.dm.OrderTypes())
+}
+
+func (p *paper) toReal(orderType string) string {
+	return convertOrderType(orderType, p.dm.OrderTypes(), p.real.OrderTypes())
+}
+
+func convertOrderType(orderType string, from, to exchange.OrderTypes) string {
+	parts := strings.SplitN(orderType, ":", 2)
+	switch parts[0] {
+	case from.Limit:
+		parts[0] = to.Limit
+	case from.Market:
+		parts[0] = to.Market
+	}
+	return strings.Join(parts, ":")
+}
+
+type publicStream struct {
+	p      *paper
+	public exchange.PublicStream
+}
+
+// NewPublicStream messages of public pass through, and each message feeds the dummy of ex before it is read.
+// read it (directly or by stream.Hub) to keep simulated fills live.
+func NewPublicStream(ex exchange.Exchange, public exchange.PublicStream) (exchange.PublicStream, error) {
+	p, ok := ex.(*paper)
+	if !ok {
+		return nil, errors.New("exchange is not paper.")
+	}
+	return &publicStream{p: p, public: public}, nil
+}
+
+func (s *publicStream) Subscribe(topics ...exchange.Topic) error {
+	return s.public.Subscribe(topics...)
+}
+
+func (s *publicStream) Start() error {
+	return s.public.Start()
+}
+
+func (s *publicStream) Close() error {
+	return s.public.Close()
+}
+
+func (s *publicStream) Read() (*exchange.Message, error) {
+	msg, err := s.public.Read()
+	if err != nil || msg == nil {
+		return msg, err
+	}
+	return msg, s.p.apply(msg)
+}
+
+type privateStream struct {
+	p      *paper
+	events exchange.PrivateStream
+}
+
+// NewPrivateStream simulated order events of ex, e.g. fills.
+func NewPrivateStream(ex exchange.Exchange) (exchange.PrivateStream, error) {
+	p, ok := ex.(*paper)
+	if !ok {
+		return nil, errors.New("exchange is not paper.")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	events, err := dummy.NewPrivateStream(p.dm)
+	if err != nil {
+		return nil, err
+	}
+	return &privateStream{p: p, events: events}, nil
+}
+
+func (s *privateStream) Start() error {
+	return nil
+}
+
+func (s *privateStream) Close() error {
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+	return s.events.Close()
+}
+
+func (s *privateStream) Read() (*orderevent.Event, error) {
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+	ev, err := s.events.Read()
+	if ev != nil {
+		ev.OrderType = s.p.toReal(ev.OrderType)
+	}
+	return ev, err
+}
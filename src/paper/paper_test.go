@@ -0,0 +1,81 @@
+package paper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/src/dummy"
+)
+
+type fakePublicStream struct {
+	messages []exchange.Message
+}
+
+func (f *fakePublicStream) Subscribe(topics ...exchange.Topic) error {
+	return nil
+}
+
+func (f *fakePublicStream) Start() error {
+	return nil
+}
+
+func (f *fakePublicStream) Close() error {
+	return nil
+}
+
+func (f *fakePublicStream) Read() (*exchange.Message, error) {
+	if len(f.messages) == 0 {
+		return nil, nil
+	}
+	msg := f.messages[0]
+	f.messages = f.messages[1:]
+	return &msg, nil
+}
+
+func TestPaper(t *testing.T) {
+	// 本物の代わりにdummyを使う. 注文は本物に届かない
+	real, _ := dummy.New(exchange.Key{SpecificParam: map[string]interface{}{"name": "bitflyer"}})
+	ex, err := New(real, exchange.Key{SpecificParam: map[string]interface{}{
+		"balances": map[string]float64{"JPY": 10000},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := &fakePublicStream{}
+	stream, _ := NewPublicStream(ex, public)
+	private, _ := NewPrivateStream(ex)
+
+	// 価格が届く前の成行は受け付けない
+	if _, err := ex.CreateOrder(0, 1, true, "BTC_JPY", ex.OrderTypes().Market); err != dummy.ErrNoPrice {
+		t.Fatal(err)
+	}
+
+	res, err := ex.CreateOrder(99, 1, true, "BTC_JPY", ex.OrderTypes().Limit)
+	if err != nil || res.ID.ExchangeName != "bitflyer" {
+		t.Fatal(err, res)
+	}
+	if orders, _ := real.ActiveOrders("BTC_JPY"); len(orders) != 0 {
+		t.Fatalf("real orders %+v", orders)
+	}
+
+	public.messages = append(public.messages, exchange.Message{
+		Topic:     exchange.Topic{Channel: exchange.ExecutionsChannel, Symbol: "BTC_JPY"},
+		Execution: &execution.Execution{Norm: base.Norm{Price: 98, Size: 2}, OccuredAt: time.Now()},
+	})
+	if msg, err := stream.Read(); err != nil || msg.Execution.Price != 98 {
+		t.Fatal(err, msg)
+	}
+	ev, _ := private.Read()
+	if ev == nil || ev.Type != orderevent.Filled || ev.Fill.Price != 99 {
+		t.Fatalf("event %+v", ev)
+	}
+	balances, _ := ex.Balance()
+	// bitflyerの手数料表が使われる
+	if balances[3].Size != 1 || balances[4].CurrencyCode != "JPY" || balances[4].Size >= 10000-99 {
+		t.Errorf("balances %+v", balances)
+	}
+}
@@ -0,0 +1,533 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/domains/ticker"
+	"github.com/TTRSQ/ccew/interface/exchange"
+)
+
+// Policy what to do when a subscriber does not keep up.
+type Policy int
+
+const (
+	// Block wait for the subscriber. slow subscriber delays all others.
+	Block Policy = iota
+	// DropOldest drop the oldest buffered message.
+	DropOldest
+	// ConflateLatest keep only the latest board and ticker per symbol.
+	// executions and order events are never conflated and blocks like Block.
+	ConflateLatest
+)
+
+// SubscribeOptions options of Hub.SubscribeWithOptions. zero value uses default.
+type SubscribeOptions struct {
+	// Buffer size of each channel. default 1024. boards and tickers of ConflateLatest are not buffered.
+	Buffer int
+	Policy Policy
+}
+
+// Notifier streams implementing it are waited on instead of polled by Hub.
+// streams of the adapters, pollers and supervisors of them implement it.
+type Notifier interface {
+	// Ready receive when Read may return a message or an error. nil means Read must be polled.
+	Ready() <-chan struct{}
+}
+
+// Hub fan-out messages of one PublicStream and one PrivateStream of an exchange to subscribers.
+type Hub struct {
+	public  exchange.PublicStream
+	private exchange.PrivateStream
+
+	mu         sync.Mutex
+	subscribed map[exchange.Topic]bool
+	subs       map[*Subscription]struct{}
+	started    bool
+	closed     bool
+	err        error
+
+	done chan struct{}
+}
+
+// NewHub public or private may be nil. wrap them with SupervisePublic / SupervisePrivate to reconnect.
+func NewHub(public exchange.PublicStream, private exchange.PrivateStream) *Hub {
+	return &Hub{
+		public:     public,
+		private:    private,
+		subscribed: map[exchange.Topic]bool{},
+		subs:       map[*Subscription]struct{}{},
+		done:       make(chan struct{}),
+	}
+}
+
+// Start start streams and delivering.
+func (h *Hub) Start() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.started {
+		return errors.New("hub is already started.")
+	}
+	if h.public != nil {
+		if err := h.public.Start(); err != nil {
+			return err
+		}
+	}
+	if h.private != nil {
+		if err := h.private.Start(); err != nil {
+			if h.public != nil {
+				h.public.Close()
+			}
+			return err
+		}
+	}
+	h.started = true
+	go h.pump()
+	return nil
+}
+
+// Close close streams and all subscriptions.
+func (h *Hub) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	close(h.done)
+	h.mu.Unlock()
+
+	h.closeSubscriptions()
+
+	var err error
+	if h.public != nil {
+		err = h.public.Close()
+	}
+	if h.private != nil {
+		if e := h.private.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Err return the error which stopped the hub.
+func (h *Hub) Err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
+
+// Subscribe SubscribeWithOptions with default options.
+func (h *Hub) Subscribe(ctx context.Context, topics ...exchange.Topic) (*Subscription, error) {
+	return h.SubscribeWithOptions(ctx, SubscribeOptions{}, topics...)
+}
+
+// SubscribeWithOptions subscribe topics. channels of Subscription are closed when ctx is done or the hub is closed.
+// OrderEventsChannel with empty Symbol receives events of all symbols. other channels need Symbol.
+func (h *Hub) SubscribeWithOptions(ctx context.Context, opt SubscribeOptions, topics ...exchange.Topic) (*Subscription, error) {
+	if len(topics) == 0 {
+		return nil, errors.New("topics required.")
+	}
+	if opt.Buffer <= 0 {
+		opt.Buffer = 1024
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, errors.New("hub is closed.")
+	}
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	// 未購読のTopicのみ購読する. PublicStreamに購読解除はないので購読は残る
+	newTopics := []exchange.Topic{}
+	for _, topic := range topics {
+		if topic.Channel == exchange.OrderEventsChannel {
+			if h.private == nil {
+				return nil, errors.New("private stream is not set.")
+			}
+			continue
+		}
+		if h.public == nil {
+			return nil, errors.New("public stream is not set.")
+		}
+		if topic.Symbol == "" {
+			return nil, errors.New("symbol required except for order events.")
+		}
+		if !h.subscribed[topic] {
+			newTopics = append(newTopics, topic)
+		}
+	}
+	if len(newTopics) > 0 {
+		if err := h.public.Subscribe(newTopics...); err != nil {
+			return nil, err
+		}
+		for _, topic := range newTopics {
+			h.subscribed[topic] = true
+		}
+	}
+
+	sub := newSubscription(topics, opt)
+	h.subs[sub] = struct{}{}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-h.done:
+		}
+		h.mu.Lock()
+		delete(h.subs, sub)
+		h.mu.Unlock()
+		sub.close()
+	}()
+	return sub, nil
+}
+
+// OnExecution call f for each execution of symbol until ctx is done.
+func (h *Hub) OnExecution(ctx context.Context, symbol string, f func(execution.Execution)) error {
+	sub, err := h.Subscribe(ctx, exchange.Topic{Channel: exchange.ExecutionsChannel, Symbol: symbol})
+	if err != nil {
+		return err
+	}
+	go func() {
+		for ex := range sub.Executions {
+			f(ex)
+		}
+	}()
+	return nil
+}
+
+// OnBoard call f with the latest board of symbol until ctx is done. boards are conflated while f is running.
+func (h *Hub) OnBoard(ctx context.Context, symbol string, f func(board.Board)) error {
+	sub, err := h.SubscribeWithOptions(ctx, SubscribeOptions{Policy: ConflateLatest}, exchange.Topic{Channel: exchange.BoardChannel, Symbol: symbol})
+	if err != nil {
+		return err
+	}
+	go func() {
+		for b := range sub.Boards {
+			f(b)
+		}
+	}()
+	return nil
+}
+
+// OnTicker call f with the latest ticker of symbol until ctx is done. tickers are conflated while f is running.
+func (h *Hub) OnTicker(ctx context.Context, symbol string, f func(ticker.Ticker)) error {
+	sub, err := h.SubscribeWithOptions(ctx, SubscribeOptions{Policy: ConflateLatest}, exchange.Topic{Channel: exchange.TickerChannel, Symbol: symbol})
+	if err != nil {
+		return err
+	}
+	go func() {
+		for t := range sub.Tickers {
+			f(t)
+		}
+	}()
+	return nil
+}
+
+// OnOrderEvent call f for each order event of symbol until ctx is done. empty symbol means all symbols.
+func (h *Hub) OnOrderEvent(ctx context.Context, symbol string, f func(orderevent.Event)) error {
+	sub, err := h.Subscribe(ctx, exchange.Topic{Channel: exchange.OrderEventsChannel, Symbol: symbol})
+	if err != nil {
+		return err
+	}
+	go func() {
+		for ev := range sub.OrderEvents {
+			f(ev)
+		}
+	}()
+	return nil
+}
+
+func (h *Hub) pump() {
+	publicReady, publicPolled := readyOf(h.public)
+	privateReady, privatePolled := readyOf(h.private)
+	for {
+		select {
+		case <-h.done:
+			return
+		default:
+		}
+
+		received := false
+		if h.public != nil {
+			msg, err := h.public.Read()
+			if err != nil {
+				h.fail(err)
+				return
+			}
+			if msg != nil {
+				received = true
+				h.deliver(msg)
+			}
+		}
+		if h.private != nil {
+			ev, err := h.private.Read()
+			if err != nil {
+				h.fail(err)
+				return
+			}
+			if ev != nil {
+				received = true
+				h.deliver(&exchange.Message{
+					Topic:      exchange.Topic{Channel: exchange.OrderEventsChannel, Symbol: ev.ID.Symbol},
+					OrderEvent: ev,
+				})
+			}
+		}
+		if received {
+			continue
+		}
+
+		// 読み切ったら通知を待つ. 通知できないストリームがあればそれだけポーリングする
+		var poll <-chan time.Time
+		if publicPolled || privatePolled {
+			poll = time.After(time.Millisecond)
+		}
+		select {
+		case <-h.done:
+			return
+		case <-publicReady:
+		case <-privateReady:
+		case <-poll:
+		}
+	}
+}
+
+// readyOf return Ready of s. polled is true if s is set but can not notify.
+func readyOf(s interface{}) (<-chan struct{}, bool) {
+	if s == nil {
+		return nil, false
+	}
+	if n, ok := s.(Notifier); ok {
+		if ready := n.Ready(); ready != nil {
+			return ready, false
+		}
+	}
+	return nil, true
+}
+
+func (h *Hub) deliver(msg *exchange.Message) {
+	h.mu.Lock()
+	subs := make([]*Subscription, 0, len(h.subs))
+	for sub := range h.subs {
+		if sub.match(msg.Topic) {
+			subs = append(subs, sub)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.deliver(msg)
+	}
+}
+
+// fail stop the hub by the error of stream.
+func (h *Hub) fail(err error) {
+	h.mu.Lock()
+	h.err = err
+	h.mu.Unlock()
+	h.closeSubscriptions()
+}
+
+func (h *Hub) closeSubscriptions() {
+	h.mu.Lock()
+	subs := h.subs
+	h.subs = map[*Subscription]struct{}{}
+	h.mu.Unlock()
+	for sub := range subs {
+		sub.close()
+	}
+}
+
+// Subscription typed channels of subscribed topics. only channels of subscribed Channel receive values.
+type Subscription struct {
+	Executions  <-chan execution.Execution
+	Boards      <-chan board.Board
+	Tickers     <-chan ticker.Ticker
+	OrderEvents <-chan orderevent.Event
+
+	topics []exchange.Topic
+	policy Policy
+
+	executions  chan execution.Execution
+	boards      chan board.Board
+	tickers     chan ticker.Ticker
+	orderEvents chan orderevent.Event
+
+	// mu guards sends and close of channels.
+	mu       sync.Mutex
+	closed   bool
+	done     chan struct{}
+	doneOnce sync.Once
+
+	// ConflateLatest 用. forwardが送信し, boards, tickersを閉じる
+	latestBoards  map[string]board.Board
+	latestTickers map[string]ticker.Ticker
+	notify        chan struct{}
+	forwarded     chan struct{}
+}
+
+func newSubscription(topics []exchange.Topic, opt SubscribeOptions) *Subscription {
+	sub := &Subscription{
+		topics:      topics,
+		policy:      opt.Policy,
+		executions:  make(chan execution.Execution, opt.Buffer),
+		orderEvents: make(chan orderevent.Event, opt.Buffer),
+		done:        make(chan struct{}),
+	}
+	// ConflateLatest の板とTickerは読まれるまで最新のものだけforwardが持つ
+	if sub.policy == ConflateLatest {
+		sub.boards = make(chan board.Board)
+		sub.tickers = make(chan ticker.Ticker)
+	} else {
+		sub.boards = make(chan board.Board, opt.Buffer)
+		sub.tickers = make(chan ticker.Ticker, opt.Buffer)
+	}
+	sub.Executions = sub.executions
+	sub.Boards = sub.boards
+	sub.Tickers = sub.tickers
+	sub.OrderEvents = sub.orderEvents
+	if sub.policy == ConflateLatest {
+		sub.latestBoards = map[string]board.Board{}
+		sub.latestTickers = map[string]ticker.Ticker{}
+		sub.notify = make(chan struct{}, 1)
+		sub.forwarded = make(chan struct{})
+		go sub.forward()
+	}
+	return sub
+}
+
+func (s *Subscription) match(topic exchange.Topic) bool {
+	for _, t := range s.topics {
+		// 銘柄の省略はOrderEventsChannelのみ
+		if t.Channel == topic.Channel && (t.Symbol == topic.Symbol || (t.Symbol == "" && t.Channel == exchange.OrderEventsChannel)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subscription) deliver(msg *exchange.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	switch {
+	case msg.Execution != nil:
+		s.send(s.executions, *msg.Execution)
+	case msg.Board != nil:
+		if s.policy == ConflateLatest {
+			s.latestBoards[msg.Board.Symbol] = *msg.Board
+			s.wakeForward()
+			return
+		}
+		s.send(s.boards, *msg.Board)
+	case msg.Ticker != nil:
+		if s.policy == ConflateLatest {
+			s.latestTickers[msg.Ticker.Symbol] = *msg.Ticker
+			s.wakeForward()
+			return
+		}
+		s.send(s.tickers, *msg.Ticker)
+	case msg.OrderEvent != nil:
+		s.send(s.orderEvents, *msg.OrderEvent)
+	}
+}
+
+// send send v to ch by the policy. DropOldest は空きができるまで古いものを捨てる
+func (s *Subscription) send(ch, v interface{}) {
+	c, x := reflect.ValueOf(ch), reflect.ValueOf(v)
+	for !c.TrySend(x) {
+		if s.policy != DropOldest {
+			reflect.Select([]reflect.SelectCase{
+				{Dir: reflect.SelectSend, Chan: c, Send: x},
+				{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.done)},
+			})
+			return
+		}
+		c.TryRecv()
+	}
+}
+
+func (s *Subscription) wakeForward() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// forward send the latest boards and tickers. boards and tickers are not buffered, so a board waiting for
+// the subscriber is replaced by a newer one of the symbol.
+func (s *Subscription) forward() {
+	defer close(s.forwarded)
+	defer close(s.boards)
+	defer close(s.tickers)
+	boards := map[string]board.Board{}
+	tickers := map[string]ticker.Ticker{}
+	for {
+		// 送信待ちを最新のもので置き換えてから送る
+		s.mu.Lock()
+		for symbol, b := range s.latestBoards {
+			boards[symbol] = b
+		}
+		for symbol, t := range s.latestTickers {
+			tickers[symbol] = t
+		}
+		s.latestBoards = map[string]board.Board{}
+		s.latestTickers = map[string]ticker.Ticker{}
+		s.mu.Unlock()
+
+		var boardCh chan board.Board
+		var b board.Board
+		for _, b = range boards {
+			boardCh = s.boards
+			break
+		}
+		var tickerCh chan ticker.Ticker
+		var t ticker.Ticker
+		for _, t = range tickers {
+			tickerCh = s.tickers
+			break
+		}
+		select {
+		case <-s.done:
+			return
+		case <-s.notify:
+		case boardCh <- b:
+			delete(boards, b.Symbol)
+		case tickerCh <- t:
+			delete(tickers, t.Symbol)
+		}
+	}
+}
+
+func (s *Subscription) close() {
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.executions)
+	close(s.orderEvents)
+	if s.policy == ConflateLatest {
+		return
+	}
+	close(s.boards)
+	close(s.tickers)
+}
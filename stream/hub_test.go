@@ -0,0 +1,188 @@
+package stream
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/wsconn"
+)
+
+type fakePublicStream struct {
+	mu       sync.Mutex
+	topics   []exchange.Topic
+	messages []exchange.Message
+}
+
+func (f *fakePublicStream) Subscribe(topics ...exchange.Topic) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.topics = append(f.topics, topics...)
+	return nil
+}
+
+func (f *fakePublicStream) Start() error {
+	return nil
+}
+
+func (f *fakePublicStream) Close() error {
+	return nil
+}
+
+func (f *fakePublicStream) Read() (*exchange.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.messages) == 0 {
+		return nil, nil
+	}
+	msg := f.messages[0]
+	f.messages = f.messages[1:]
+	return &msg, nil
+}
+
+func (f *fakePublicStream) push(msgs ...exchange.Message) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, msgs...)
+}
+
+func TestHubFanOut(t *testing.T) {
+	public := &fakePublicStream{}
+	hub := NewHub(public, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topic := exchange.Topic{Channel: exchange.ExecutionsChannel, Symbol: "BTC_JPY"}
+	sub1, err := hub.Subscribe(ctx, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub2, err := hub.SubscribeWithOptions(ctx, SubscribeOptions{Policy: ConflateLatest}, topic,
+		exchange.Topic{Channel: exchange.BoardChannel, Symbol: "BTC_JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同じTopicは1度だけ購読される
+	if len(public.topics) != 2 {
+		t.Fatalf("subscribed topics %+v", public.topics)
+	}
+	if _, err := hub.Subscribe(ctx, exchange.Topic{Channel: exchange.OrderEventsChannel}); err == nil {
+		t.Error("order events without private stream must fail")
+	}
+	// 銘柄の省略は注文イベントのみ
+	if _, err := hub.Subscribe(ctx, exchange.Topic{Channel: exchange.BoardChannel}); err == nil {
+		t.Error("board without symbol must fail")
+	}
+	if (&Subscription{topics: []exchange.Topic{{Channel: exchange.ExecutionsChannel}}}).match(topic) {
+		t.Error("empty symbol must not match executions")
+	}
+	if !(&Subscription{topics: []exchange.Topic{{Channel: exchange.OrderEventsChannel}}}).match(exchange.Topic{Channel: exchange.OrderEventsChannel, Symbol: "BTC_JPY"}) {
+		t.Error("empty symbol must match order events of all symbols")
+	}
+
+	// 板はsub2が読むまでに最新のものだけ残る
+	for i := 1; i <= 3; i++ {
+		public.push(exchange.Message{
+			Topic: exchange.Topic{Channel: exchange.BoardChannel, Symbol: "BTC_JPY"},
+			Board: &board.Board{Symbol: "BTC_JPY", MidPrice: float64(i)},
+		})
+	}
+	public.push(exchange.Message{
+		Topic:     topic,
+		Execution: &execution.Execution{Norm: base.Norm{Price: 100, Size: 1}},
+	})
+	if err := hub.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Close()
+
+	timeout := time.After(3 * time.Second)
+	for _, sub := range []*Subscription{sub1, sub2} {
+		select {
+		case ex := <-sub.Executions:
+			if ex.Price != 100 {
+				t.Errorf("execution %+v", ex)
+			}
+		case <-timeout:
+			t.Fatal("execution is not delivered")
+		}
+	}
+	// 途中の板は捨てられる
+	select {
+	case b := <-sub2.Boards:
+		if b.MidPrice != 3 {
+			t.Fatalf("stale board %+v", b)
+		}
+	case <-timeout:
+		t.Fatal("latest board is not delivered")
+	}
+	select {
+	case b := <-sub2.Boards:
+		t.Fatalf("stale board %+v", b)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case _, ok := <-sub1.Executions:
+		if ok {
+			t.Error("unexpected execution")
+		}
+	case <-timeout:
+		t.Fatal("subscription is not closed")
+	}
+}
+
+// notifyingStream 通知できるストリーム. Readの回数を数える
+type notifyingStream struct {
+	fakePublicStream
+	queue wsconn.Queue
+	reads int32
+}
+
+func (n *notifyingStream) Read() (*exchange.Message, error) {
+	atomic.AddInt32(&n.reads, 1)
+	if v := n.queue.Pop(); v != nil {
+		msg := v.(exchange.Message)
+		return &msg, nil
+	}
+	return nil, nil
+}
+
+func (n *notifyingStream) Ready() <-chan struct{} {
+	return n.queue.Ready()
+}
+
+func TestHubWaitsForNotifier(t *testing.T) {
+	public := &notifyingStream{}
+	hub := NewHub(public, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	topic := exchange.Topic{Channel: exchange.ExecutionsChannel, Symbol: "BTC_JPY"}
+	sub, _ := hub.Subscribe(ctx, topic)
+	if err := hub.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Close()
+
+	// データがなければReadしない
+	time.Sleep(50 * time.Millisecond)
+	if reads := atomic.LoadInt32(&public.reads); reads > 1 {
+		t.Fatalf("idle reads %d", reads)
+	}
+	public.queue.Push(exchange.Message{Topic: topic, Execution: &execution.Execution{Norm: base.Norm{Price: 100, Size: 1}}})
+	select {
+	case ex := <-sub.Executions:
+		if ex.Price != 100 {
+			t.Errorf("execution %+v", ex)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("execution is not delivered")
+	}
+}
@@ -0,0 +1,474 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/order"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/domains/ticker"
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/wsconn"
+)
+
+// Pacer spread requests evenly within a rate budget.
+// share one Pacer between pollers of the same exchange to keep the total budget.
+type Pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewPacer requestsPerSecond must be positive.
+func NewPacer(requestsPerSecond float64) *Pacer {
+	return &Pacer{interval: time.Duration(float64(time.Second) / requestsPerSecond)}
+}
+
+// Wait until the next request is allowed. return false if done is closed.
+func (p *Pacer) Wait(done <-chan struct{}) bool {
+	p.mu.Lock()
+	now := time.Now()
+	at := p.next
+	if at.Before(now) {
+		at = now
+	}
+	p.next = at.Add(p.interval)
+	p.mu.Unlock()
+
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-done:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// PollOptions options of pollers. zero value uses default.
+type PollOptions struct {
+	// Pacer default 1 request per second.
+	Pacer *Pacer
+	// MaxFailures consecutive request errors before Read returns the error. default 5.
+	MaxFailures int
+	// SeenIDs number of execution ids kept for dedupe per symbol. default 10000.
+	SeenIDs int
+}
+
+func (o PollOptions) withDefault() PollOptions {
+	if o.Pacer == nil {
+		o.Pacer = NewPacer(1)
+	}
+	if o.MaxFailures == 0 {
+		o.MaxFailures = 5
+	}
+	if o.SeenIDs == 0 {
+		o.SeenIDs = 10000
+	}
+	return o
+}
+
+// polling common part of Poller and OrderPoller.
+type polling struct {
+	opt   PollOptions
+	queue *wsconn.Queue
+
+	mu       sync.Mutex
+	done     chan struct{}
+	err      error
+	failures int
+}
+
+func (p *polling) start(step func(done <-chan struct{})) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done != nil {
+		return errors.New("poller is already started.")
+	}
+	p.done = make(chan struct{})
+	p.err = nil
+	p.failures = 0
+	go func(done chan struct{}) {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			step(done)
+		}
+	}(p.done)
+	return nil
+}
+
+func (p *polling) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done == nil {
+		return nil
+	}
+	close(p.done)
+	p.done = nil
+	return nil
+}
+
+// request call f within the rate budget. return false if the poller is closed or f fails.
+func (p *polling) request(done <-chan struct{}, f func() error) bool {
+	if !p.opt.Pacer.Wait(done) {
+		return false
+	}
+	err := f()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		p.failures = 0
+		return true
+	}
+	p.failures++
+	if p.failures >= p.opt.MaxFailures {
+		p.err = err
+		p.queue.Wake()
+	}
+	return false
+}
+
+// Ready receive when Read may return a message or an error.
+func (p *polling) Ready() <-chan struct{} {
+	return p.queue.Ready()
+}
+
+func (p *polling) read() (interface{}, error) {
+	if v := p.queue.Pop(); v != nil {
+		return v, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done == nil {
+		return nil, errors.New("poller is not started.")
+	}
+	return nil, p.err
+}
+
+// Poller exchange.PublicStream on top of REST Boards and Executions. executions need exchange.ExecutionsReader.
+type Poller struct {
+	*polling
+	ex exchange.Exchange
+
+	topicsMu sync.Mutex
+	topics   []exchange.Topic
+}
+
+// pollState 前回のポーリング結果. Startごとに作り直し, ポーリングのgoroutineのみが触る
+type pollState struct {
+	seen       map[string]map[string]bool
+	seenOrder  map[string][]string
+	prevBoards map[string]board.Board
+}
+
+// NewPoller poll ex for subscribed topics.
+// the first poll of executions only remembers ids, later polls emit unseen executions in time order.
+// boards are emitted with Levels when changed. tickers are made of best levels of the board.
+func NewPoller(ex exchange.Exchange, opt PollOptions) *Poller {
+	return &Poller{
+		polling: &polling{opt: opt.withDefault(), queue: &wsconn.Queue{}},
+		ex:      ex,
+	}
+}
+
+func (p *Poller) Subscribe(topics ...exchange.Topic) error {
+	for _, topic := range topics {
+		switch topic.Channel {
+		case exchange.ExecutionsChannel:
+			if _, ok := p.ex.(exchange.ExecutionsReader); !ok {
+				return fmt.Errorf("channel %s not supported by %s.", topic.Channel, p.ex.ExchangeName())
+			}
+		case exchange.BoardChannel, exchange.TickerChannel:
+		default:
+			return fmt.Errorf("channel %s not supported.", topic.Channel)
+		}
+	}
+	p.topicsMu.Lock()
+	defer p.topicsMu.Unlock()
+	p.topics = append(p.topics, topics...)
+	return nil
+}
+
+func (p *Poller) Start() error {
+	st := &pollState{
+		seen:       map[string]map[string]bool{},
+		seenOrder:  map[string][]string{},
+		prevBoards: map[string]board.Board{},
+	}
+	return p.start(func(done <-chan struct{}) {
+		p.poll(st, done)
+	})
+}
+
+func (p *Poller) Close() error {
+	return p.close()
+}
+
+func (p *Poller) Read() (*exchange.Message, error) {
+	v, err := p.read()
+	if v == nil {
+		return nil, err
+	}
+	msg := v.(exchange.Message)
+	return &msg, nil
+}
+
+// poll request each symbol once.
+func (p *Poller) poll(st *pollState, done <-chan struct{}) {
+	p.topicsMu.Lock()
+	boards := map[string]bool{}
+	tickers := map[string]bool{}
+	executions := []string{}
+	boardSymbols := []string{}
+	for _, topic := range p.topics {
+		switch topic.Channel {
+		case exchange.ExecutionsChannel:
+			if !contains(executions, topic.Symbol) {
+				executions = append(executions, topic.Symbol)
+			}
+		case exchange.BoardChannel, exchange.TickerChannel:
+			if topic.Channel == exchange.BoardChannel {
+				boards[topic.Symbol] = true
+			} else {
+				tickers[topic.Symbol] = true
+			}
+			if !contains(boardSymbols, topic.Symbol) {
+				boardSymbols = append(boardSymbols, topic.Symbol)
+			}
+		}
+	}
+	p.topicsMu.Unlock()
+
+	if len(executions) == 0 && len(boardSymbols) == 0 {
+		// 購読がなければ予算だけ消費して待つ
+		p.opt.Pacer.Wait(done)
+		return
+	}
+	for _, symbol := range executions {
+		p.request(done, func() error {
+			return p.pollExecutions(st, symbol)
+		})
+	}
+	for _, symbol := range boardSymbols {
+		p.request(done, func() error {
+			return p.pollBoard(st, symbol, boards[symbol], tickers[symbol])
+		})
+	}
+}
+
+func (p *Poller) pollExecutions(st *pollState, symbol string) error {
+	executions, err := p.ex.(exchange.ExecutionsReader).Executions(symbol)
+	if err != nil {
+		return err
+	}
+
+	seen, first := st.seen[symbol], false
+	if seen == nil {
+		seen, first = map[string]bool{}, true
+		st.seen[symbol] = seen
+	}
+	sort.SliceStable(executions, func(i, j int) bool {
+		return executions[i].OccuredAt.Before(executions[j].OccuredAt)
+	})
+	for i := range executions {
+		ex := executions[i]
+		if seen[ex.LocalID] {
+			continue
+		}
+		seen[ex.LocalID] = true
+		st.seenOrder[symbol] = append(st.seenOrder[symbol], ex.LocalID)
+		if first {
+			continue
+		}
+		p.queue.Push(exchange.Message{
+			Topic:     exchange.Topic{Channel: exchange.ExecutionsChannel, Symbol: symbol},
+			Execution: &ex,
+		})
+	}
+
+	// 古いidから忘れる
+	if over := len(st.seenOrder[symbol]) - p.opt.SeenIDs; over > 0 {
+		for _, localID := range st.seenOrder[symbol][:over] {
+			delete(seen, localID)
+		}
+		st.seenOrder[symbol] = st.seenOrder[symbol][over:]
+	}
+	return nil
+}
+
+func (p *Poller) pollBoard(st *pollState, symbol string, emitBoard, emitTicker bool) error {
+	b, err := p.ex.Boards(symbol)
+	if err != nil {
+		return err
+	}
+	if b.ExchangeName == "" {
+		b.ExchangeName = p.ex.ExchangeName()
+	}
+	if b.Symbol == "" {
+		b.Symbol = symbol
+	}
+
+	prev, exist := st.prevBoards[symbol]
+	st.prevBoards[symbol] = b
+	levels := board.Diff(prev, b)
+	if exist && len(levels) == 0 {
+		return nil
+	}
+	now := time.Now()
+
+	if emitBoard {
+		ret := b
+		p.queue.Push(exchange.Message{
+			Topic:  exchange.Topic{Channel: exchange.BoardChannel, Symbol: symbol},
+			Board:  &ret,
+			Levels: levels,
+		})
+	}
+	if emitTicker {
+		t := ticker.Ticker{
+			ExchangeName: b.ExchangeName,
+			Symbol:       symbol,
+			OccuredAt:    now,
+		}
+		if len(b.Bids) > 0 {
+			t.BestBid, t.BestBidSize = b.Bids[0].Price, b.Bids[0].Size
+		}
+		if len(b.Asks) > 0 {
+			t.BestAsk, t.BestAskSize = b.Asks[0].Price, b.Asks[0].Size
+		}
+		p.queue.Push(exchange.Message{
+			Topic:  exchange.Topic{Channel: exchange.TickerChannel, Symbol: symbol},
+			Ticker: &t,
+		})
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderPoller exchange.PrivateStream on top of REST ActiveOrders.
+type OrderPoller struct {
+	*polling
+	ex      exchange.Exchange
+	symbols []string
+}
+
+// NewOrderPoller poll ActiveOrders of symbols and report differences between polls.
+// the first poll only remembers orders. a decrease of size is reported as PartiallyFilled,
+// an order disappeared from ActiveOrders is reported as Closed since REST can not tell filled from canceled.
+func NewOrderPoller(ex exchange.Exchange, symbols []string, opt PollOptions) *OrderPoller {
+	return &OrderPoller{
+		polling: &polling{opt: opt.withDefault(), queue: &wsconn.Queue{}},
+		ex:      ex,
+		symbols: symbols,
+	}
+}
+
+func (p *OrderPoller) Start() error {
+	// 前回の注文. Startごとに作り直す
+	prevOrders := map[string]map[string]order.Order{}
+	return p.start(func(done <-chan struct{}) {
+		p.poll(prevOrders, done)
+	})
+}
+
+func (p *OrderPoller) Close() error {
+	return p.close()
+}
+
+func (p *OrderPoller) Read() (*orderevent.Event, error) {
+	v, err := p.read()
+	if v == nil {
+		return nil, err
+	}
+	ev := v.(orderevent.Event)
+	return &ev, nil
+}
+
+func (p *OrderPoller) poll(prevOrders map[string]map[string]order.Order, done <-chan struct{}) {
+	if len(p.symbols) == 0 {
+		p.opt.Pacer.Wait(done)
+		return
+	}
+	for _, symbol := range p.symbols {
+		p.request(done, func() error {
+			return p.pollOrders(prevOrders, symbol)
+		})
+	}
+}
+
+func (p *OrderPoller) pollOrders(prevOrders map[string]map[string]order.Order, symbol string) error {
+	orders, err := p.ex.ActiveOrders(symbol)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	current := map[string]order.Order{}
+	for _, ord := range orders {
+		current[ord.LocalID] = ord
+	}
+	prev, exist := prevOrders[symbol]
+	prevOrders[symbol] = current
+	if !exist {
+		return nil
+	}
+
+	event := func(ord order.Order, typ orderevent.Type) orderevent.Event {
+		return orderevent.Event{
+			ID:            ord.ID,
+			Type:          typ,
+			IsBuy:         ord.IsBuy,
+			OrderType:     ord.OrderType,
+			Norm:          ord.Norm,
+			RemainingSize: ord.Size,
+			OccuredAt:     now,
+		}
+	}
+	for _, ord := range orders {
+		before, exist := prev[ord.LocalID]
+		switch {
+		case !exist:
+			p.queue.Push(event(ord, orderevent.Accepted))
+		case ord.Size < before.Size:
+			ev := event(ord, orderevent.PartiallyFilled)
+			ev.Fill = &orderevent.Fill{Norm: base.Norm{Price: ord.Price, Size: before.Size - ord.Size}}
+			p.queue.Push(ev)
+		case ord.Price != before.Price || ord.Size > before.Size:
+			// 注文の変更
+			p.queue.Push(event(ord, orderevent.Accepted))
+		}
+	}
+
+	// 消えた注文. 順序を決めるためにidでソートする
+	gone := []string{}
+	for localID := range prev {
+		if _, exist := current[localID]; !exist {
+			gone = append(gone, localID)
+		}
+	}
+	sort.Strings(gone)
+	for _, localID := range gone {
+		ev := event(prev[localID], orderevent.Closed)
+		ev.RemainingSize = 0
+		p.queue.Push(ev)
+	}
+	return nil
+}
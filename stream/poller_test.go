@@ -0,0 +1,189 @@
+package stream
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/board"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/order"
+	"github.com/TTRSQ/ccew/domains/order/id"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/interface/exchange"
+)
+
+// fakeExchange 必要なメソッドのみ実装する
+type fakeExchange struct {
+	exchange.Exchange
+
+	mu         sync.Mutex
+	executions []execution.Execution
+	board      board.Board
+	orders     []order.Order
+}
+
+func (f *fakeExchange) ExchangeName() string {
+	return "fake"
+}
+
+func (f *fakeExchange) Executions(symbol string) ([]execution.Execution, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]execution.Execution{}, f.executions...), nil
+}
+
+func (f *fakeExchange) Boards(symbol string) (board.Board, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.board, nil
+}
+
+func (f *fakeExchange) ActiveOrders(symbol string) ([]order.Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]order.Order{}, f.orders...), nil
+}
+
+func fakeExecution(localID string, sec int64) execution.Execution {
+	return execution.Execution{
+		ID:        id.NewID("fake", "BTC_JPY", localID),
+		Norm:      base.Norm{Price: 100, Size: 1},
+		OccuredAt: time.Unix(sec, 0),
+	}
+}
+
+func TestPollerDedupeAndDiff(t *testing.T) {
+	ex := &fakeExchange{
+		executions: []execution.Execution{fakeExecution("1", 1)},
+		board:      board.Board{Asks: []base.Norm{{Price: 101, Size: 1}}, Bids: []base.Norm{{Price: 99, Size: 1}}},
+	}
+	p := NewPoller(ex, PollOptions{Pacer: NewPacer(1000)})
+	p.Subscribe(
+		exchange.Topic{Channel: exchange.ExecutionsChannel, Symbol: "BTC_JPY"},
+		exchange.Topic{Channel: exchange.BoardChannel, Symbol: "BTC_JPY"},
+	)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	read := func() *exchange.Message {
+		timeout := time.After(3 * time.Second)
+		for {
+			msg, err := p.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg != nil {
+				return msg
+			}
+			select {
+			case <-timeout:
+				t.Fatal("message not received")
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	// 初回の板は全レベルが差分になる
+	msg := read()
+	if msg.Board == nil || len(msg.Levels) != 2 {
+		t.Fatalf("first board %+v", msg)
+	}
+
+	ex.mu.Lock()
+	// 新しい順に返る取引所もある
+	ex.executions = []execution.Execution{fakeExecution("3", 3), fakeExecution("2", 2), fakeExecution("1", 1)}
+	ex.board = board.Board{Asks: []base.Norm{{Price: 101, Size: 2}}}
+	ex.mu.Unlock()
+
+	got := []string{}
+	var levels []board.Level
+	for len(got) < 2 || levels == nil {
+		msg := read()
+		switch {
+		case msg.Execution != nil:
+			got = append(got, msg.Execution.LocalID)
+		case msg.Board != nil:
+			levels = msg.Levels
+		}
+	}
+	if got[0] != "2" || got[1] != "3" {
+		t.Errorf("executions %v", got)
+	}
+	want := []board.Level{{IsAsk: true, Price: 101, Size: 2}, {IsAsk: false, Price: 99, Size: 0}}
+	if len(levels) != len(want) || levels[0] != want[0] || levels[1] != want[1] {
+		t.Errorf("levels %+v", levels)
+	}
+}
+
+// boardsOnly Executionsのない取引所
+type boardsOnly struct {
+	exchange.Exchange
+}
+
+func (b boardsOnly) ExchangeName() string {
+	return "boards"
+}
+
+func TestPollerWithoutExecutions(t *testing.T) {
+	p := NewPoller(boardsOnly{}, PollOptions{})
+	if err := p.Subscribe(exchange.Topic{Channel: exchange.ExecutionsChannel, Symbol: "BTC_JPY"}); err == nil {
+		t.Error("executions need exchange.ExecutionsReader")
+	}
+	if err := p.Subscribe(exchange.Topic{Channel: exchange.BoardChannel, Symbol: "BTC_JPY"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOrderPoller(t *testing.T) {
+	ord := order.Order{
+		ID:      id.NewID("fake", "BTC_JPY", "A"),
+		Request: order.Request{Norm: base.Norm{Price: 100, Size: 2}, IsBuy: true},
+	}
+	ex := &fakeExchange{orders: []order.Order{ord}}
+	p := NewOrderPoller(ex, []string{"BTC_JPY"}, PollOptions{Pacer: NewPacer(1000)})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	read := func() *orderevent.Event {
+		timeout := time.After(3 * time.Second)
+		for {
+			ev, err := p.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev != nil {
+				return ev
+			}
+			select {
+			case <-timeout:
+				t.Fatal("event not received")
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	// 初回のポーリングが終わるまで待つ
+	time.Sleep(20 * time.Millisecond)
+	ex.mu.Lock()
+	ord.Size = 0.5
+	ex.orders = []order.Order{ord}
+	ex.mu.Unlock()
+	ev := read()
+	if ev.Type != orderevent.PartiallyFilled || ev.Fill == nil || ev.Fill.Size != 1.5 {
+		t.Fatalf("partial fill %+v", ev)
+	}
+
+	ex.mu.Lock()
+	ex.orders = nil
+	ex.mu.Unlock()
+	ev = read()
+	if ev.Type != orderevent.Closed || !ev.IsDone() {
+		t.Fatalf("closed %+v", ev)
+	}
+}
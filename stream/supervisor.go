@@ -0,0 +1,517 @@
+package stream
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+	"github.com/TTRSQ/ccew/interface/exchange"
+)
+
+// State connection state of supervised stream.
+type State string
+
+const (
+	// Connecting (re)connecting to the exchange.
+	Connecting State = "CONNECTING"
+	// Connected stream is alive.
+	Connected State = "CONNECTED"
+	// Disconnected stream is down. reconnect will be tried.
+	Disconnected State = "DISCONNECTED"
+	// Closed stream is closed by Close.
+	Closed State = "CLOSED"
+)
+
+// ErrStale no message is received for Options.StaleAfter.
+var ErrStale = errors.New("stream is stale.")
+
+// Gap time window in which messages may be missed.
+type Gap struct {
+	From time.Time
+	To   time.Time
+}
+
+// StateEvent notification of state change.
+type StateEvent struct {
+	State State
+	Err   error
+	At    time.Time
+	// Gap is set when the stream is reconnected.
+	Gap *Gap
+}
+
+// Options of supervisor. zero value uses default.
+type Options struct {
+	// PingInterval default 15s.
+	PingInterval time.Duration
+	// StaleAfter default 60s.
+	StaleAfter time.Duration
+	// MinBackoff default 1s.
+	MinBackoff time.Duration
+	// MaxBackoff default 60s.
+	MaxBackoff time.Duration
+	// Backfill is called after reconnect of Stream. returned executions are read before new ones.
+	Backfill func(gap Gap) ([]execution.Execution, error)
+	// BackfillEvents is called after reconnect of PrivateStream.
+	BackfillEvents func(gap Gap) ([]orderevent.Event, error)
+}
+
+func (o Options) withDefault() Options {
+	if o.PingInterval == 0 {
+		o.PingInterval = 15 * time.Second
+	}
+	if o.StaleAfter == 0 {
+		o.StaleAfter = 60 * time.Second
+	}
+	if o.MinBackoff == 0 {
+		o.MinBackoff = time.Second
+	}
+	if o.MaxBackoff == 0 {
+		o.MaxBackoff = 60 * time.Second
+	}
+	return o
+}
+
+// streams implement these optionally.
+type pinger interface {
+	Ping() error
+}
+
+type lastReceiver interface {
+	LastReceived() time.Time
+}
+
+type closer interface {
+	Close() error
+}
+
+type starter interface {
+	Start() error
+}
+
+// supervisor common part of Supervisor and PrivateSupervisor.
+type supervisor struct {
+	inner starter
+	opt   Options
+	rnd   *rand.Rand
+
+	// startMu guards Start and Close of inner.
+	startMu sync.Mutex
+	// mu guards state and other calls to inner.
+	mu       sync.Mutex
+	state    State
+	lastMsg  time.Time
+	lastPing time.Time
+	downAt   time.Time
+	backlog  []interface{}
+	backfill func(gap Gap) ([]interface{}, error)
+
+	states chan StateEvent
+	wake   chan struct{}
+	done   chan struct{}
+	// ready innerのReadyと再接続後のbacklogを知らせる
+	ready chan struct{}
+}
+
+func newSupervisor(inner starter, opt Options) *supervisor {
+	return &supervisor{
+		inner:  inner,
+		opt:    opt.withDefault(),
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		state:  Disconnected,
+		states: make(chan StateEvent, 64),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+// Ready receive when Read may return a message. nil if the inner stream is not a Notifier, then poll Read.
+func (s *supervisor) Ready() <-chan struct{} {
+	if _, ok := s.inner.(Notifier); !ok {
+		return nil
+	}
+	return s.ready
+}
+
+func (s *supervisor) notify() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Start connect and start supervising. the first connection error is returned as is.
+func (s *supervisor) Start() error {
+	s.setState(Connecting, nil, nil)
+	if err := s.inner.Start(); err != nil {
+		s.setState(Disconnected, err, nil)
+		return err
+	}
+	s.mu.Lock()
+	s.lastMsg = time.Now()
+	s.lastPing = time.Now()
+	s.mu.Unlock()
+	s.setState(Connected, nil, nil)
+
+	go s.run()
+	return nil
+}
+
+// Close stop supervising and close the stream.
+func (s *supervisor) Close() error {
+	s.mu.Lock()
+	if s.state == Closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.state = Closed
+	close(s.done)
+	s.mu.Unlock()
+
+	select {
+	case s.states <- StateEvent{State: Closed, At: time.Now()}:
+	default:
+	}
+
+	// 再接続中であればStartが終わるのを待ってから閉じる
+	s.startMu.Lock()
+	defer s.startMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.inner.(closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// States return channel of state changes. events are dropped when it is full.
+func (s *supervisor) States() <-chan StateEvent {
+	return s.states
+}
+
+// State return current state.
+func (s *supervisor) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *supervisor) setState(state State, err error, gap *Gap) {
+	s.mu.Lock()
+	if s.state == Closed {
+		s.mu.Unlock()
+		return
+	}
+	s.state = state
+	s.mu.Unlock()
+
+	select {
+	case s.states <- StateEvent{State: state, Err: err, At: time.Now(), Gap: gap}:
+	default:
+	}
+}
+
+// read call f with inner when connected. f returns true if a message is read.
+func (s *supervisor) read(f func() (bool, error)) (interface{}, bool) {
+	s.mu.Lock()
+	if len(s.backlog) > 0 {
+		v := s.backlog[0]
+		s.backlog = s.backlog[1:]
+		s.mu.Unlock()
+		return v, true
+	}
+	if s.state != Connected {
+		s.mu.Unlock()
+		return nil, false
+	}
+	received, err := f()
+	if err != nil {
+		s.mu.Unlock()
+		s.disconnect(err)
+		return nil, false
+	}
+	if received {
+		s.lastMsg = time.Now()
+	}
+	s.mu.Unlock()
+	return nil, false
+}
+
+func (s *supervisor) disconnect(err error) {
+	s.mu.Lock()
+	if s.state != Connected {
+		s.mu.Unlock()
+		return
+	}
+	s.downAt = s.lastMsg
+	if lr, ok := s.inner.(lastReceiver); ok && lr.LastReceived().After(s.downAt) {
+		s.downAt = lr.LastReceived()
+	}
+	s.mu.Unlock()
+
+	s.setState(Disconnected, err, nil)
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *supervisor) run() {
+	ticker := time.NewTicker(s.checkInterval())
+	defer ticker.Stop()
+	var innerReady <-chan struct{}
+	if n, ok := s.inner.(Notifier); ok {
+		innerReady = n.Ready()
+	}
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+			s.reconnect()
+		case <-ticker.C:
+			s.check()
+		case <-innerReady:
+			s.notify()
+		}
+	}
+}
+
+func (s *supervisor) checkInterval() time.Duration {
+	d := s.opt.PingInterval
+	if s.opt.StaleAfter/2 < d {
+		d = s.opt.StaleAfter / 2
+	}
+	if d > time.Second {
+		d = time.Second
+	}
+	return d
+}
+
+// check send ping and detect stale connection.
+func (s *supervisor) check() {
+	s.mu.Lock()
+	if s.state != Connected {
+		s.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	var err error
+	if p, ok := s.inner.(pinger); ok && now.Sub(s.lastPing) >= s.opt.PingInterval {
+		s.lastPing = now
+		err = p.Ping()
+	}
+	last := s.lastMsg
+	if lr, ok := s.inner.(lastReceiver); ok && lr.LastReceived().After(last) {
+		last = lr.LastReceived()
+	}
+	s.mu.Unlock()
+
+	if err == nil && now.Sub(last) > s.opt.StaleAfter {
+		err = ErrStale
+	}
+	if err != nil {
+		s.disconnect(err)
+	}
+}
+
+func (s *supervisor) reconnect() {
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-s.done:
+			return
+		case <-time.After(s.backoff(attempt)):
+		}
+
+		s.setState(Connecting, nil, nil)
+		if err := s.restart(); err != nil {
+			s.setState(Disconnected, err, nil)
+			continue
+		}
+
+		now := time.Now()
+		gap := &Gap{From: s.downAt, To: now}
+		var backlog []interface{}
+		var err error
+		if s.backfill != nil {
+			backlog, err = s.backfill(*gap)
+		}
+
+		s.mu.Lock()
+		s.backlog = append(s.backlog, backlog...)
+		s.lastMsg = now
+		s.lastPing = now
+		s.mu.Unlock()
+		s.setState(Connected, err, gap)
+		s.notify()
+		return
+	}
+}
+
+// restart close and start inner. 再接続で認証, 購読もやり直される
+func (s *supervisor) restart() error {
+	s.startMu.Lock()
+	defer s.startMu.Unlock()
+	select {
+	case <-s.done:
+		return errors.New("stream is closed.")
+	default:
+	}
+
+	s.mu.Lock()
+	if c, ok := s.inner.(closer); ok {
+		c.Close()
+	}
+	s.mu.Unlock()
+	return s.inner.Start()
+}
+
+// backoff exponential backoff with jitter. returns 0 for the first attempt.
+func (s *supervisor) backoff(attempt int) time.Duration {
+	if attempt == 0 {
+		return 0
+	}
+	d := s.opt.MinBackoff
+	for i := 1; i < attempt && d < s.opt.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > s.opt.MaxBackoff {
+		d = s.opt.MaxBackoff
+	}
+	// [d/2, d)
+	return d/2 + time.Duration(s.rnd.Int63n(int64(d/2)+1))
+}
+
+// Supervisor exchange.Stream with reconnect.
+type Supervisor struct {
+	*supervisor
+	stream exchange.Stream
+}
+
+// Supervise wrap s. Read returns no execution while the stream is down.
+func Supervise(s exchange.Stream, opt Options) *Supervisor {
+	sv := &Supervisor{
+		supervisor: newSupervisor(s, opt),
+		stream:     s,
+	}
+	if sv.opt.Backfill != nil {
+		sv.supervisor.backfill = func(gap Gap) ([]interface{}, error) {
+			executions, err := sv.opt.Backfill(gap)
+			ret := make([]interface{}, len(executions))
+			for i := range executions {
+				ret[i] = executions[i]
+			}
+			return ret, err
+		}
+	}
+	return sv
+}
+
+// Read Execution, error. the error of the stream is handled by supervisor.
+func (sv *Supervisor) Read() (execution.Execution, error) {
+	ret := execution.Execution{}
+	v, ok := sv.read(func() (bool, error) {
+		var err error
+		ret, err = sv.stream.Read()
+		return ret != (execution.Execution{}), err
+	})
+	if ok {
+		return v.(execution.Execution), nil
+	}
+	return ret, nil
+}
+
+// PrivateSupervisor exchange.PrivateStream with reconnect.
+type PrivateSupervisor struct {
+	*supervisor
+	stream exchange.PrivateStream
+}
+
+// SupervisePrivate wrap s. Read returns nil while the stream is down.
+func SupervisePrivate(s exchange.PrivateStream, opt Options) *PrivateSupervisor {
+	sv := &PrivateSupervisor{
+		supervisor: newSupervisor(s, opt),
+		stream:     s,
+	}
+	if sv.opt.BackfillEvents != nil {
+		sv.supervisor.backfill = func(gap Gap) ([]interface{}, error) {
+			events, err := sv.opt.BackfillEvents(gap)
+			ret := make([]interface{}, len(events))
+			for i := range events {
+				ret[i] = events[i]
+			}
+			return ret, err
+		}
+	}
+	return sv
+}
+
+// Read Event, error. the error of the stream is handled by supervisor.
+func (sv *PrivateSupervisor) Read() (*orderevent.Event, error) {
+	var ret *orderevent.Event
+	v, ok := sv.read(func() (bool, error) {
+		var err error
+		ret, err = sv.stream.Read()
+		return ret != nil, err
+	})
+	if ok {
+		ev := v.(orderevent.Event)
+		return &ev, nil
+	}
+	return ret, nil
+}
+
+// PublicSupervisor exchange.PublicStream with reconnect. topics are subscribed again on reconnect.
+type PublicSupervisor struct {
+	*supervisor
+	stream exchange.PublicStream
+}
+
+// SupervisePublic wrap s. Read returns nil while the stream is down.
+func SupervisePublic(s exchange.PublicStream, opt Options) *PublicSupervisor {
+	sv := &PublicSupervisor{
+		supervisor: newSupervisor(s, opt),
+		stream:     s,
+	}
+	if sv.opt.Backfill != nil {
+		sv.supervisor.backfill = func(gap Gap) ([]interface{}, error) {
+			executions, err := sv.opt.Backfill(gap)
+			ret := make([]interface{}, len(executions))
+			for i := range executions {
+				ex := executions[i]
+				ret[i] = exchange.Message{
+					Topic:     exchange.Topic{Channel: exchange.ExecutionsChannel, Symbol: ex.ID.Symbol},
+					Execution: &ex,
+				}
+			}
+			return ret, err
+		}
+	}
+	return sv
+}
+
+// Subscribe topics. 再接続時もinnerが覚えている購読をやり直す
+func (sv *PublicSupervisor) Subscribe(topics ...exchange.Topic) error {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	return sv.stream.Subscribe(topics...)
+}
+
+// Read Message, error. the error of the stream is handled by supervisor.
+func (sv *PublicSupervisor) Read() (*exchange.Message, error) {
+	var ret *exchange.Message
+	v, ok := sv.read(func() (bool, error) {
+		var err error
+		ret, err = sv.stream.Read()
+		return ret != nil, err
+	})
+	if ok {
+		msg := v.(exchange.Message)
+		return &msg, nil
+	}
+	return ret, nil
+}
@@ -0,0 +1,150 @@
+package stream
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TTRSQ/ccew/domains/base"
+	"github.com/TTRSQ/ccew/domains/execution"
+	"github.com/TTRSQ/ccew/domains/orderevent"
+)
+
+type fakePrivateStream struct {
+	mu      sync.Mutex
+	starts  int
+	failing bool
+	events  []orderevent.Event
+}
+
+func (f *fakePrivateStream) Start() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.starts++
+	f.failing = false
+	return nil
+}
+
+func (f *fakePrivateStream) Close() error {
+	return nil
+}
+
+func (f *fakePrivateStream) Read() (*orderevent.Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failing {
+		return nil, errors.New("connection reset")
+	}
+	if len(f.events) == 0 {
+		return nil, nil
+	}
+	ev := f.events[0]
+	f.events = f.events[1:]
+	return &ev, nil
+}
+
+func waitState(t *testing.T, sv *PrivateSupervisor, want State) StateEvent {
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case ev := <-sv.States():
+			if ev.State == want {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("state %s not reached", want)
+		}
+	}
+}
+
+func TestSupervisePrivateReconnect(t *testing.T) {
+	inner := &fakePrivateStream{}
+	sv := SupervisePrivate(inner, Options{
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 5 * time.Millisecond,
+		BackfillEvents: func(gap Gap) ([]orderevent.Event, error) {
+			if gap.To.Before(gap.From) {
+				t.Errorf("invalid gap %+v", gap)
+			}
+			return []orderevent.Event{{Type: orderevent.Filled}}, nil
+		},
+	})
+	if err := sv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer sv.Close()
+	waitState(t, sv, Connected)
+
+	inner.mu.Lock()
+	inner.failing = true
+	inner.mu.Unlock()
+
+	// エラーはsupervisorが吸収する
+	if ev, err := sv.Read(); ev != nil || err != nil {
+		t.Fatalf("unexpected read %+v %v", ev, err)
+	}
+	waitState(t, sv, Disconnected)
+	connected := waitState(t, sv, Connected)
+	if connected.Gap == nil {
+		t.Fatal("gap is not reported")
+	}
+
+	ev, err := sv.Read()
+	if err != nil || ev == nil || ev.Type != orderevent.Filled {
+		t.Fatalf("backfilled event is not read: %+v %v", ev, err)
+	}
+	inner.mu.Lock()
+	if inner.starts != 2 {
+		t.Errorf("starts %d != 2", inner.starts)
+	}
+	inner.mu.Unlock()
+}
+
+type fakeStream struct {
+	executions []execution.Execution
+}
+
+func (f *fakeStream) Start() error {
+	return nil
+}
+
+func (f *fakeStream) Read() (execution.Execution, error) {
+	if len(f.executions) == 0 {
+		return execution.Execution{}, nil
+	}
+	ex := f.executions[0]
+	f.executions = f.executions[1:]
+	return ex, nil
+}
+
+func TestSuperviseStale(t *testing.T) {
+	inner := &fakeStream{executions: []execution.Execution{{Norm: base.Norm{Price: 1, Size: 1}}}}
+	sv := Supervise(inner, Options{
+		PingInterval: 10 * time.Millisecond,
+		StaleAfter:   30 * time.Millisecond,
+		MinBackoff:   time.Millisecond,
+		MaxBackoff:   time.Millisecond,
+	})
+	if err := sv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer sv.Close()
+
+	ex, _ := sv.Read()
+	if ex.Price != 1 {
+		t.Fatalf("execution is not read: %+v", ex)
+	}
+
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case ev := <-sv.States():
+			if ev.State == Disconnected && ev.Err == ErrStale {
+				return
+			}
+		case <-timeout:
+			t.Fatal("stale is not detected")
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package httpx
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/ratelimit"
+	"github.com/TTRSQ/ccew/util/retry"
+	"github.com/TTRSQ/ccew/util/sign"
+)
+
+// DefaultMaxBodyBytes limit of response bodies if Options.MaxBodyBytes is not set.
+const DefaultMaxBodyBytes = 16 << 20
+
+// ErrBodyTooLarge returned when a response body is over Options.MaxBodyBytes.
+var ErrBodyTooLarge = errors.New("response body too large.")
+
+// StatusError non 2xx response. Body is cut at Options.MaxBodyBytes.
+type StatusError struct {
+	Exchange   string
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s %s: status %d: %s", e.Exchange, e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+// Hooks observe every attempt of a request, e.g. for logging and metrics.
+// the request is signed, so headers can include API keys and signatures.
+type Hooks struct {
+	// Request called before an attempt is sent.
+	Request func(req *http.Request)
+	// Response called after an attempt with the response (body unread) or the error.
+	Response func(req *http.Request, resp *http.Response, err error, elapsed time.Duration)
+}
+
+// Options of a client.
+type Options struct {
+	// Name exchange name used in errors.
+	Name string
+	// ProxyURL proxy of requests. nil uses the proxy of the environment.
+	ProxyURL *url.URL
+	// Timeout of a whole request including retries. 0 means no timeout.
+	Timeout   time.Duration
+	TLSConfig *tls.Config
+	// UserAgent User-Agent header. empty keeps the default of net/http.
+	UserAgent string
+	// MaxBodyBytes limit of response bodies. default DefaultMaxBodyBytes.
+	MaxBodyBytes int64
+	// Transport replaces the keep-alive transport of the client. ProxyURL and TLSConfig are ignored then.
+	Transport http.RoundTripper
+	// WrapTransport wrap the transport, the keep-alive one with ProxyURL and TLSConfig or Transport.
+	WrapTransport func(next http.RoundTripper) http.RoundTripper
+	// RateLimiter budget of requests. nil means unlimited.
+	RateLimiter *ratelimit.Limiter
+	// Retry policy of requests.
+	Retry retry.Policy
+	// Signer sign a request before every attempt, so that retries get a fresh timestamp or nonce.
+	// nil and requests marked by sign.Public are sent as they are.
+	Signer sign.Signer
+	Hooks  Hooks
+}
+
+// Client HTTP client of an exchange. it keeps connections alive between requests, so create one per
+// adapter and reuse it. it is safe for concurrent use.
+type Client struct {
+	name      string
+	userAgent string
+	http      *http.Client
+}
+
+// New client of an exchange. opt holds the defaults of the exchange, which are overridden by
+// SpecificParam of key:
+// proxyURL : *url.URL, timeoutMS : int, tlsConfig : *tls.Config, userAgent : string, maxBodyBytes : int,
+// transport : http.RoundTripper, wrapTransport : func(http.RoundTripper) http.RoundTripper, rateLimiter : *ratelimit.Limiter, retry : retry.Policy, hooks : httpx.Hooks
+func New(key exchange.Key, opt Options) *Client {
+	param := key.SpecificParam
+	if param["proxyURL"] != nil {
+		opt.ProxyURL = param["proxyURL"].(*url.URL)
+	}
+	if param["timeoutMS"] != nil {
+		opt.Timeout = time.Duration(param["timeoutMS"].(int)) * time.Millisecond
+	}
+	if param["tlsConfig"] != nil {
+		opt.TLSConfig = param["tlsConfig"].(*tls.Config)
+	}
+	if param["userAgent"] != nil {
+		opt.UserAgent = param["userAgent"].(string)
+	}
+	if param["maxBodyBytes"] != nil {
+		opt.MaxBodyBytes = int64(param["maxBodyBytes"].(int))
+	}
+	// transport 通信を差し替える. テストなどで使う
+	if param["transport"] != nil {
+		opt.Transport = param["transport"].(http.RoundTripper)
+	}
+	// wrapTransport 設定済みの通信を包む. dryrunなどで使う
+	if param["wrapTransport"] != nil {
+		opt.WrapTransport = param["wrapTransport"].(func(http.RoundTripper) http.RoundTripper)
+	}
+	// rateLimiter 取引所の制限を超えないように待つ. 同じキーやIPの間で共有できる
+	if param["rateLimiter"] != nil {
+		opt.RateLimiter = param["rateLimiter"].(*ratelimit.Limiter)
+	}
+	// retry 読み込みと重複しない注文は失敗しても再送する
+	if param["retry"] != nil {
+		opt.Retry = param["retry"].(retry.Policy)
+	}
+	if param["hooks"] != nil {
+		opt.Hooks = param["hooks"].(Hooks)
+	}
+	return NewClient(opt)
+}
+
+// NewClient client of opt.
+// each attempt goes through retry, rate limit, signing, hooks and the body limit in this order.
+func NewClient(opt Options) *Client {
+	if opt.MaxBodyBytes <= 0 {
+		opt.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	rt := opt.Transport
+	if rt == nil {
+		rt = baseTransport(opt)
+	}
+	if opt.WrapTransport != nil {
+		rt = opt.WrapTransport(rt)
+	}
+	rt = &limitTransport{max: opt.MaxBodyBytes, next: rt}
+	if opt.Hooks.Request != nil || opt.Hooks.Response != nil {
+		rt = &hookTransport{hooks: opt.Hooks, next: rt}
+	}
+	if opt.Signer != nil {
+		rt = &signTransport{signer: opt.Signer, next: rt}
+	}
+	if opt.RateLimiter != nil {
+		rt = opt.RateLimiter.Transport(rt)
+	}
+	rt = opt.Retry.Transport(rt)
+	return &Client{
+		name:      opt.Name,
+		userAgent: opt.UserAgent,
+		http:      &http.Client{Transport: rt, Timeout: opt.Timeout},
+	}
+}
+
+// baseTransport 取引所ごとに接続を使い回す
+func baseTransport(opt Options) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if opt.ProxyURL != nil {
+		t.Proxy = http.ProxyURL(opt.ProxyURL)
+	}
+	if opt.TLSConfig != nil {
+		t.TLSClientConfig = opt.TLSConfig.Clone()
+	}
+	// 注文と取得を並行しても接続を張り直さない
+	t.MaxIdleConnsPerHost = 16
+	return t
+}
+
+// Do send req and return the body of a 2xx response.
+// other statuses are *StatusError, and ratelimit.ErrRateLimited is returned as it is.
+func (c *Client) Do(req *http.Request) ([]byte, error) {
+	if c.userAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(err, ratelimit.ErrRateLimited) {
+			return nil, ratelimit.ErrRateLimited
+		}
+		return nil, fmt.Errorf("%s %s %s: %w", c.name, req.Method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return nil, &StatusError{
+			Exchange:   c.name,
+			Method:     req.Method,
+			Path:       req.URL.Path,
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s %s %s: %w", c.name, req.Method, req.URL.Path, err)
+	}
+	return body, nil
+}
+
+// signTransport 試行ごとに署名し直す. 元のリクエストは変更しない
+type signTransport struct {
+	signer sign.Signer
+	next   http.RoundTripper
+}
+
+func (t *signTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if sign.IsPublic(req) {
+		return t.next.RoundTrip(req)
+	}
+	var body []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+	// 署名に使ったキーの結果をキーの入れ替えに使う
+	r := sign.Track(req.Clone(req.Context()))
+	if req.Body != nil {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	if err := t.signer.Sign(r, body); err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(r)
+	sign.Done(r, resp, err)
+	return resp, err
+}
+
+type hookTransport struct {
+	hooks Hooks
+	next  http.RoundTripper
+}
+
+func (t *hookTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.hooks.Request != nil {
+		t.hooks.Request(req)
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if t.hooks.Response != nil {
+		t.hooks.Response(req, resp, err, time.Since(start))
+	}
+	return resp, err
+}
+
+// limitTransport 本文の読み込みを上限で止める. 再送や制限の調整で本文を読む層にも効く
+type limitTransport struct {
+	max  int64
+	next http.RoundTripper
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	resp.Body = &limitedBody{rc: resp.Body, left: t.max}
+	return resp, nil
+}
+
+type limitedBody struct {
+	rc   io.ReadCloser
+	left int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	// 上限を1バイト超えて読めたら大きすぎる
+	if int64(len(p)) > b.left+1 {
+		p = p[:b.left+1]
+	}
+	n, err := b.rc.Read(p)
+	b.left -= int64(n)
+	if b.left < 0 {
+		return n + int(b.left), ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.rc.Close()
+}
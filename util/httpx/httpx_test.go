@@ -0,0 +1,145 @@
+package httpx
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TTRSQ/ccew/interface/exchange"
+	"github.com/TTRSQ/ccew/util/ratelimit"
+	"github.com/TTRSQ/ccew/util/retry"
+	"github.com/TTRSQ/ccew/util/sign"
+)
+
+func TestClient(t *testing.T) {
+	var conns int32
+	failures := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		switch r.URL.Path {
+		case "/large":
+			w.Write([]byte(strings.Repeat("x", 100)))
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not found"}`))
+		default:
+			fmt.Fprintf(w, "%s|%s|%s", r.Header.Get("User-Agent"), r.Header.Get("SIGN"), body)
+		}
+	}))
+	server.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	signs := 0
+	attempts := 0
+	client := New(exchange.Key{SpecificParam: map[string]interface{}{
+		"userAgent":    "ccew-test",
+		"maxBodyBytes": 50,
+		"hooks": Hooks{Response: func(req *http.Request, resp *http.Response, err error, elapsed time.Duration) {
+			attempts++
+		}},
+	}}, Options{
+		Name:  "test",
+		Retry: retry.Policy{BaseDelay: time.Millisecond},
+		Signer: sign.Func(func(req *http.Request, body []byte) error {
+			signs++
+			req.Header.Set("SIGN", fmt.Sprintf("%d:%s", signs, body))
+			return nil
+		}),
+	})
+
+	// 再送のたびに署名し直す
+	failures = 1
+	req, _ := http.NewRequest("GET", server.URL+"/ok", nil)
+	body, err := client.Do(req)
+	if err != nil || string(body) != "ccew-test|2:|" || attempts != 2 {
+		t.Fatal(err, string(body), attempts)
+	}
+	req, _ = http.NewRequest("POST", server.URL+"/ok", strings.NewReader(`{"a":1}`))
+	body, err = client.Do(req)
+	if err != nil || string(body) != `ccew-test|3:{"a":1}|{"a":1}` {
+		t.Fatal(err, string(body))
+	}
+	// 接続を使い回す
+	if atomic.LoadInt32(&conns) != 1 {
+		t.Fatal(conns)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/missing", nil)
+	_, err = client.Do(req)
+	statusErr := &StatusError{}
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound || statusErr.Body != `{"error":"not found"}` || statusErr.Path != "/missing" {
+		t.Fatal(err)
+	}
+
+	req, _ = http.NewRequest("GET", server.URL+"/large", nil)
+	if _, err = client.Do(req); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := NewClient(Options{
+		Name:        "test",
+		RateLimiter: ratelimit.New(ratelimit.Config{Read: ratelimit.Limit{Requests: 1, Per: time.Hour}, FailFast: true}),
+	})
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	if _, err := client.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	if _, err := client.Do(req); err != ratelimit.ErrRateLimited {
+		t.Fatal(err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("ACCESS-KEY") == "a" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(r.Header.Get("ACCESS-KEY")))
+	}))
+	defer server.Close()
+
+	keys, _ := sign.PoolOf(exchange.Key{APIKey: "a", APISecKey: "secret", SpecificParam: map[string]interface{}{
+		"additional_keys": [][]string{{"b", "secret"}},
+	}})
+	client := NewClient(Options{Name: "test", Signer: sign.Bitbank(keys)})
+
+	// 拒否されたキーはローテーションから外れる
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	statusErr := &StatusError{}
+	if _, err := client.Do(req); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		req, _ = http.NewRequest("GET", server.URL, nil)
+		if body, err := client.Do(req); err != nil || string(body) != "b" {
+			t.Fatal(err, string(body))
+		}
+	}
+	if keys.Available() != 1 {
+		t.Fatal(keys.Available())
+	}
+}
@@ -0,0 +1,30 @@
+// Package httpxtest fakes exchange APIs in tests of adapters.
+package httpxtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+)
+
+// Transport http.RoundTripper answering every request by h in process, whatever the host is.
+// give it to an adapter by SpecificParam transport.
+func Transport(h http.Handler) http.RoundTripper {
+	return handlerTransport{handler: h}
+}
+
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// サーバーが受け取るリクエストと同じく本文を nil にしない
+	r := req.Clone(req.Context())
+	if r.Body == nil {
+		r.Body = http.NoBody
+	}
+	w := httptest.NewRecorder()
+	t.handler.ServeHTTP(w, r)
+	resp := w.Result()
+	resp.Request = req
+	return resp, nil
+}
@@ -0,0 +1,240 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited returned instead of sending a request when the budget is used up and FailFast is set.
+var ErrRateLimited = errors.New("rate limited.")
+
+// Class endpoint class. each class has its own budget, except Cancel, which shares the budget of Order.
+type Class string
+
+const (
+	// Read GET requests. market data and account queries.
+	Read Class = "read"
+	// Order new orders and edits.
+	Order Class = "order"
+	// Cancel cancels. they can use the reserve of the Order budget.
+	Cancel Class = "cancel"
+	// Shared the budget of Config.Shared, which every request also takes.
+	Shared Class = "shared"
+)
+
+// Limit Requests per Per.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Config budgets of an exchange. zero Limit means unlimited.
+type Config struct {
+	Read  Limit
+	Order Limit
+	// Shared budget of all classes, for exchanges limiting the total of requests.
+	Shared Limit
+	// CancelReserve tokens of the Order budget that only cancels can use, so cancels still pass
+	// while new orders wait. default a tenth of Order.Requests.
+	CancelReserve float64
+	// FailFast return ErrRateLimited instead of waiting.
+	FailFast bool
+	// Adjust update the budget from a response, e.g. by rate limit headers.
+	Adjust func(l *Limiter, class Class, resp *http.Response)
+}
+
+// bucket token bucket.
+type bucket struct {
+	capacity float64
+	// rate tokens per second.
+	rate   float64
+	tokens float64
+	last   time.Time
+	// until the exchange told us to stop until this time.
+	until time.Time
+}
+
+func newBucket(limit Limit, now time.Time) *bucket {
+	if limit.Requests <= 0 || limit.Per <= 0 {
+		return nil
+	}
+	return &bucket{
+		capacity: float64(limit.Requests),
+		rate:     float64(limit.Requests) / limit.Per.Seconds(),
+		tokens:   float64(limit.Requests),
+		last:     now,
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// wait time until a token above reserve is available. 0 means take it now.
+func (b *bucket) wait(now time.Time, reserve float64) time.Duration {
+	if now.Before(b.until) {
+		return b.until.Sub(now)
+	}
+	b.refill(now)
+	if b.tokens-reserve >= 1 {
+		return 0
+	}
+	return time.Duration((1 + reserve - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Limiter budgets of an exchange. share it between adapters using the same key or IP.
+type Limiter struct {
+	cfg Config
+
+	mu      sync.Mutex
+	buckets map[Class]*bucket
+	now     func() time.Time
+}
+
+// New limiter of cfg.
+func New(cfg Config) *Limiter {
+	l := &Limiter{cfg: cfg, now: time.Now}
+	l.buckets = map[Class]*bucket{
+		Read:   newBucket(cfg.Read, l.now()),
+		Order:  newBucket(cfg.Order, l.now()),
+		Shared: newBucket(cfg.Shared, l.now()),
+	}
+	if l.cfg.CancelReserve == 0 {
+		l.cfg.CancelReserve = math.Floor(float64(cfg.Order.Requests) / 10)
+	}
+	return l
+}
+
+// Classify class of req. non GET requests are orders, and cancels if the path says so.
+func Classify(req *http.Request) Class {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return Read
+	}
+	if req.Method == http.MethodDelete || strings.Contains(strings.ToLower(req.URL.Path), "cancel") {
+		return Cancel
+	}
+	return Order
+}
+
+// Wait take a token of class. it blocks until a token is available or ctx is done, or fails with
+// ErrRateLimited if FailFast is set.
+func (l *Limiter) Wait(ctx context.Context, class Class) error {
+	for {
+		d := l.take(class)
+		if d == 0 {
+			return nil
+		}
+		if l.cfg.FailFast {
+			return ErrRateLimited
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (l *Limiter) take(class Class) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	// 種別の枠と全体の枠の両方から取る
+	b, reserve := l.bucket(class)
+	shared := l.buckets[Shared]
+	d := time.Duration(0)
+	if b != nil {
+		d = b.wait(now, reserve)
+	}
+	if shared != nil {
+		if sd := shared.wait(now, 0); sd > d {
+			d = sd
+		}
+	}
+	if d == 0 {
+		if b != nil {
+			b.tokens--
+		}
+		if shared != nil {
+			shared.tokens--
+		}
+	}
+	return d
+}
+
+// bucket 取消は新規注文と同じ枠を使い, 予約分まで使える
+func (l *Limiter) bucket(class Class) (*bucket, float64) {
+	if class == Cancel {
+		return l.buckets[Order], 0
+	}
+	if class == Order {
+		return l.buckets[Order], l.cfg.CancelReserve
+	}
+	return l.buckets[class], 0
+}
+
+// Update set the budget of class from the exchange. remaining < 0 keeps the current tokens.
+// requests are held until reset if nothing remains.
+func (l *Limiter) Update(class Class, remaining float64, reset time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, _ := l.bucket(class)
+	if b == nil {
+		return
+	}
+	b.refill(l.now())
+	if remaining >= 0 {
+		b.tokens = math.Min(b.tokens, remaining)
+	}
+	if remaining == 0 && reset.After(b.until) {
+		b.until = reset
+	}
+}
+
+type transport struct {
+	l    *Limiter
+	next http.RoundTripper
+}
+
+// Transport http.RoundTripper sending through next (http.DefaultTransport if nil) within the budget.
+// the budget is adjusted by responses, and 429 holds the class for Retry-After (1s if absent).
+func (l *Limiter) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{l: l, next: next}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	l := t.l
+	class := Classify(req)
+	if err := l.Wait(req.Context(), class); err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		wait := time.Second
+		if sec, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			wait = time.Duration(sec) * time.Second
+		}
+		l.Update(class, 0, l.now().Add(wait))
+	}
+	if l.cfg.Adjust != nil {
+		l.cfg.Adjust(l, class, resp)
+	}
+	return resp, nil
+}
@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	l := New(Config{Order: Limit{Requests: 10, Per: 10 * time.Second}, CancelReserve: 2, FailFast: true})
+	l.now = func() time.Time { return now }
+	l.buckets[Order].last = now
+
+	ctx := context.Background()
+	for i := 0; i < 8; i++ {
+		if err := l.Wait(ctx, Order); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+	// 残りは取消用
+	if err := l.Wait(ctx, Order); err != ErrRateLimited {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(ctx, Cancel); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+	if err := l.Wait(ctx, Cancel); err != ErrRateLimited {
+		t.Fatal(err)
+	}
+	// 読み込みは制限なし
+	if err := l.Wait(ctx, Read); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(3 * time.Second)
+	if err := l.Wait(ctx, Order); err != nil {
+		t.Fatal(err)
+	}
+
+	// 取引所が残り0と言ったらリセットまで待つ
+	l.Update(Cancel, 0, now.Add(time.Minute))
+	now = now.Add(30 * time.Second)
+	if err := l.Wait(ctx, Cancel); err != ErrRateLimited {
+		t.Fatal(err)
+	}
+	now = now.Add(31 * time.Second)
+	if err := l.Wait(ctx, Cancel); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShared(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	cfg := Bitflyer()
+	cfg.FailFast = true
+	l := New(cfg)
+	l.now = func() time.Time { return now }
+	for _, b := range l.buckets {
+		b.last = now
+	}
+
+	// 注文と読み込みの合計で500回まで
+	ctx := context.Background()
+	for i := 0; i < 270; i++ {
+		if err := l.Wait(ctx, Order); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+	if err := l.Wait(ctx, Order); err != ErrRateLimited {
+		t.Fatal(err)
+	}
+	for i := 0; i < 230; i++ {
+		if err := l.Wait(ctx, Read); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+	if err := l.Wait(ctx, Read); err != ErrRateLimited {
+		t.Fatal(err)
+	}
+	// 取消の予約分が残っていても全体の枠は超えない
+	if err := l.Wait(ctx, Cancel); err != ErrRateLimited {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Second)
+	if err := l.Wait(ctx, Cancel); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	remaining := 2
+	reset := time.Now().Add(time.Hour).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remaining--
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	cfg := Bitflyer()
+	cfg.FailFast = true
+	client := &http.Client{Transport: New(cfg).Transport(nil)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "ok" {
+			t.Fatal(string(body))
+		}
+	}
+	if _, err := client.Get(server.URL); err == nil || remaining != 0 {
+		t.Fatal(err, remaining)
+	}
+
+	// 待つ場合はcontextで打ち切れる
+	cfg.FailFast = false
+	l := New(cfg)
+	l.Update(Read, 0, time.Now().Add(time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, Read); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+}
+
+func TestAdjustBybit(t *testing.T) {
+	l := New(Bybit())
+	resp := &http.Response{Body: ioutil.NopCloser(strings.NewReader(`{"ret_code":0,"rate_limit_status":0,"rate_limit_reset_ms":4102444800000}`))}
+	adjustBybit(l, Order, resp)
+	if body, _ := ioutil.ReadAll(resp.Body); len(body) == 0 {
+		t.Fatal("body is consumed")
+	}
+	if l.take(Cancel) == 0 {
+		t.Error("budget is not updated")
+	}
+}
@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// budgets of exchanges. they follow the published limits, and are conservative where a limit is not published.
+
+// Bitflyer 500 requests per 5 minutes in total, of which orders 300. adjusted by X-RateLimit headers.
+func Bitflyer() Config {
+	return Config{
+		Read:   Limit{Requests: 500, Per: 5 * time.Minute},
+		Order:  Limit{Requests: 300, Per: 5 * time.Minute},
+		Shared: Limit{Requests: 500, Per: 5 * time.Minute},
+		Adjust: adjustHeaders("X-RateLimit-Remaining", "X-RateLimit-Reset"),
+	}
+}
+
+// Bybit 120 reads and 100 orders per minute. adjusted by rate_limit_status and rate_limit_reset_ms of responses.
+func Bybit() Config {
+	return Config{
+		Read:   Limit{Requests: 120, Per: time.Minute},
+		Order:  Limit{Requests: 100, Per: time.Minute},
+		Adjust: adjustBybit,
+	}
+}
+
+// Gmo 20 GET and 20 POST requests per second.
+func Gmo() Config {
+	return Config{
+		Read:  Limit{Requests: 20, Per: time.Second},
+		Order: Limit{Requests: 20, Per: time.Second},
+	}
+}
+
+// Bitbank 10 queries and 6 updates per second.
+func Bitbank() Config {
+	return Config{
+		Read:  Limit{Requests: 10, Per: time.Second},
+		Order: Limit{Requests: 6, Per: time.Second},
+	}
+}
+
+// Coincheck 5 requests per second.
+func Coincheck() Config {
+	return Config{
+		Read:  Limit{Requests: 5, Per: time.Second},
+		Order: Limit{Requests: 5, Per: time.Second},
+	}
+}
+
+// Liquid 300 requests per 5 minutes.
+func Liquid() Config {
+	return Config{
+		Read:  Limit{Requests: 300, Per: 5 * time.Minute},
+		Order: Limit{Requests: 300, Per: 5 * time.Minute},
+	}
+}
+
+// Ftx 30 requests per second.
+func Ftx() Config {
+	return Config{
+		Read:  Limit{Requests: 30, Per: time.Second},
+		Order: Limit{Requests: 30, Per: time.Second},
+	}
+}
+
+// adjustHeaders remaining and reset (unix seconds) headers. they also update Shared if it is set.
+func adjustHeaders(remainingHeader, resetHeader string) func(l *Limiter, class Class, resp *http.Response) {
+	return func(l *Limiter, class Class, resp *http.Response) {
+		remaining, err := strconv.ParseFloat(resp.Header.Get(remainingHeader), 64)
+		if err != nil {
+			return
+		}
+		reset := time.Time{}
+		if sec, err := strconv.ParseInt(resp.Header.Get(resetHeader), 10, 64); err == nil {
+			reset = time.Unix(sec, 0)
+		}
+		l.Update(class, remaining, reset)
+		l.Update(Shared, remaining, reset)
+	}
+}
+
+// adjustBybit 本文の残り回数を読み, 本文は読み直せるように戻す
+func adjustBybit(l *Limiter, class Class, resp *http.Response) {
+	if resp.Body == nil {
+		return
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		// 読めなかったことは呼び出し元に伝える
+		resp.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+		return
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	status := struct {
+		RateLimitStatus  *float64 `json:"rate_limit_status"`
+		RateLimitResetMs int64    `json:"rate_limit_reset_ms"`
+	}{}
+	if json.Unmarshal(body, &status) != nil || status.RateLimitStatus == nil {
+		return
+	}
+	reset := time.Unix(0, status.RateLimitResetMs*int64(time.Millisecond))
+	l.Update(class, *status.RateLimitStatus, reset)
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
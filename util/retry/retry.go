@@ -0,0 +1,202 @@
+package retry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Policy retry policy of requests. reads (GET) are retried on timeouts, connection resets, 5xx and busy
+// responses. other requests are retried only if ClientOrderID says the exchange deduplicates them.
+type Policy struct {
+	// MaxAttempts attempts including the first. 1 disables retries. default 3.
+	MaxAttempts int
+	// BaseDelay, MaxDelay the delay doubles from BaseDelay up to MaxDelay, with jitter. default 200ms and 5s.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Busy exchange specific responses meaning try again later. body is the whole response body.
+	Busy func(resp *http.Response, body []byte) bool
+	// ClientOrderID return true if req carries a client order id. body is the request body.
+	ClientOrderID func(req *http.Request, body []byte) bool
+	// Hook called after every attempt, e.g. for logging.
+	Hook func(a Attempt)
+}
+
+// Attempt result of an attempt given to Policy.Hook.
+type Attempt struct {
+	Request *http.Request
+	// N 1 for the first attempt.
+	N        int
+	Response *http.Response
+	Err      error
+	// Retry true if another attempt follows after Wait.
+	Retry bool
+	Wait  time.Duration
+}
+
+type transport struct {
+	policy Policy
+	next   http.RoundTripper
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// Transport http.RoundTripper sending through next (http.DefaultTransport if nil) with retries by p.
+func (p Policy) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 200 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 5 * time.Second
+	}
+	return &transport{policy: p, next: next, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retryable, err := t.retryable(req)
+	if err != nil {
+		return nil, err
+	}
+	for n := 1; ; n++ {
+		attemptReq := req
+		if n > 1 {
+			if attemptReq, err = rewind(req); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := t.next.RoundTrip(attemptReq)
+		if err == nil && t.policy.Busy != nil {
+			err = t.peekBusy(resp)
+		}
+		retry := retryable && n < t.policy.MaxAttempts && shouldRetry(resp, err)
+		a := Attempt{Request: attemptReq, N: n, Response: resp, Err: err, Retry: retry}
+		if retry {
+			a.Wait = t.delay(n)
+		}
+		if t.policy.Hook != nil {
+			t.policy.Hook(a)
+		}
+		if !retry {
+			if err == errBusy {
+				return resp, nil
+			}
+			if err != nil && resp != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(a.Wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// errBusy 取引所が混雑を返した. 最後の試行ならレスポンスをそのまま返す
+var errBusy = errors.New("exchange is busy.")
+
+// retryable 読み込みと, 顧客注文IDで重複しない注文だけ再送する
+func (t *transport) retryable(req *http.Request) (bool, error) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return true, nil
+	}
+	if t.policy.ClientOrderID == nil || req.GetBody == nil {
+		return false, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return false, err
+	}
+	return t.policy.ClientOrderID(req, b), nil
+}
+
+func rewind(req *http.Request) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	return r, nil
+}
+
+// peekBusy 本文を読んで戻す
+func (t *transport) peekBusy(resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if t.policy.Busy(resp, body) {
+		return errBusy
+	}
+	return nil
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err == errBusy {
+		return true
+	}
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return true
+		}
+		return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+	}
+	return resp.StatusCode >= 500
+}
+
+// delay 指数的に増やし, 半分から全体の間でばらつかせる
+func (t *transport) delay(n int) time.Duration {
+	d := t.policy.BaseDelay << uint(n-1)
+	if d > t.policy.MaxDelay || d <= 0 {
+		d = t.policy.MaxDelay
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return d/2 + time.Duration(t.rand.Int63n(int64(d/2)+1))
+}
+
+// ClientOrderIDField ClientOrderID of a JSON body with a non empty field name.
+func ClientOrderIDField(name string) func(req *http.Request, body []byte) bool {
+	return func(req *http.Request, body []byte) bool {
+		fields := map[string]interface{}{}
+		if json.Unmarshal(body, &fields) != nil {
+			return false
+		}
+		v, ok := fields[name]
+		return ok && v != nil && v != ""
+	}
+}
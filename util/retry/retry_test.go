@@ -0,0 +1,75 @@
+package retry
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	failures := 0
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("system is busy"))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	attempts := []Attempt{}
+	policy := Bybit()
+	policy.BaseDelay = time.Millisecond
+	policy.Hook = func(a Attempt) { attempts = append(attempts, a) }
+	client := &http.Client{Transport: policy.Transport(nil)}
+
+	// 読み込みは再送する
+	failures = 2
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "ok" || len(attempts) != 3 || !attempts[0].Retry || attempts[2].Retry || attempts[1].Wait <= 0 {
+		t.Fatalf("%s %+v", body, attempts)
+	}
+
+	// 回数を超えたら最後のレスポンスを返す
+	failures, attempts = 5, nil
+	resp, err = client.Get(server.URL)
+	if err != nil || resp.StatusCode != http.StatusBadGateway || len(attempts) != 3 {
+		t.Fatal(err, resp, attempts)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	if string(body) != "system is busy" {
+		t.Fatal(string(body))
+	}
+
+	// 顧客注文IDのない注文は再送しない
+	failures, attempts = 1, nil
+	resp, err = client.Post(server.URL, "application/json", strings.NewReader(`{"symbol":"BTCUSD"}`))
+	if err != nil || resp.StatusCode != http.StatusBadGateway || len(attempts) != 1 {
+		t.Fatal(err, resp, attempts)
+	}
+
+	failures, attempts, bodies = 1, nil, nil
+	resp, err = client.Post(server.URL, "application/json", strings.NewReader(`{"symbol":"BTCUSD","order_link_id":"a1"}`))
+	if err != nil || resp.StatusCode != http.StatusOK || len(attempts) != 2 || bodies[0] != bodies[1] {
+		t.Fatal(err, resp, attempts, bodies)
+	}
+}
+
+func TestBusy(t *testing.T) {
+	resp := &http.Response{StatusCode: 200}
+	if !Bitbank().Busy(resp, []byte(`{"success":0,"data":{"code":70009}}`)) || Bitbank().Busy(resp, []byte(`{"success":1,"data":{}}`)) {
+		t.Error("bitbank busy")
+	}
+}
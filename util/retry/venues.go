@@ -0,0 +1,90 @@
+package retry
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// policies of exchanges. client order ids are recognized only where the exchange deduplicates them.
+
+// Bitflyer busy messages are retried.
+func Bitflyer() Policy {
+	return Policy{Busy: busyMessage}
+}
+
+// Bybit order_link_id makes orders retryable.
+func Bybit() Policy {
+	return Policy{Busy: busyMessage, ClientOrderID: ClientOrderIDField("order_link_id")}
+}
+
+// Ftx clientId makes orders retryable.
+func Ftx() Policy {
+	return Policy{Busy: busyMessage, ClientOrderID: ClientOrderIDField("clientId")}
+}
+
+// Gmo busy messages are retried.
+func Gmo() Policy {
+	return Policy{Busy: busyMessage}
+}
+
+// Bitbank error codes 70009 and 70011 (heavy traffic) are retried.
+func Bitbank() Policy {
+	return Policy{Busy: func(resp *http.Response, body []byte) bool {
+		res := struct {
+			Data struct {
+				Code int `json:"code"`
+			} `json:"data"`
+		}{}
+		if json.Unmarshal(body, &res) != nil {
+			return false
+		}
+		return res.Data.Code == 70009 || res.Data.Code == 70011
+	}}
+}
+
+// Coincheck busy messages are retried.
+func Coincheck() Policy {
+	return Policy{Busy: busyMessage}
+}
+
+// Liquid busy messages are retried.
+func Liquid() Policy {
+	return Policy{Busy: busyMessage}
+}
+
+// BybitDuplicate ret_code 30001, order_link_id used before. the order was placed by an attempt whose response was lost.
+func BybitDuplicate(body []byte) bool {
+	res := struct {
+		RetCode int `json:"ret_code"`
+	}{}
+	return json.Unmarshal(body, &res) == nil && res.RetCode == 30001
+}
+
+// FtxDuplicate clientId used before. the order was placed by an attempt whose response was lost.
+func FtxDuplicate(body []byte) bool {
+	res := struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+	}{}
+	if json.Unmarshal(body, &res) != nil || res.Success {
+		return false
+	}
+	msg := strings.ToLower(res.Error)
+	return strings.Contains(msg, "client") && (strings.Contains(msg, "duplicate") || strings.Contains(msg, "already"))
+}
+
+// NewClientOrderID random client order id (32 hex characters) making an order retryable.
+func NewClientOrderID() string {
+	b := make([]byte, 16)
+	crand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// busyMessage 成功以外で本文に busy を含む
+func busyMessage(resp *http.Response, body []byte) bool {
+	return resp.StatusCode/100 != 2 && bytes.Contains(bytes.ToLower(body), []byte("busy"))
+}
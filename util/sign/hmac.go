@@ -0,0 +1,88 @@
+package sign
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HMAC signer signing a message of the request by HMAC-SHA256 in hex.
+type HMAC struct {
+	Keys Keys
+	// Now clock of nonces. default time.Now.
+	Now func() time.Time
+	// Unit the nonce is the time in Unit.
+	Unit time.Duration
+	// Increasing make nonces of a key strictly increasing, for exchanges rejecting reused nonces.
+	Increasing bool
+	// Message message to sign.
+	Message func(req *http.Request, body []byte, nonce string) string
+	// Header set the API key, the nonce and the signature.
+	Header func(h http.Header, apiKey, nonce, sign string)
+}
+
+// Sign sign req.
+func (s *HMAC) Sign(req *http.Request, body []byte) error {
+	key, nonces := s.Keys.Next(req)
+	nonce := nonceOf(now(s.Now), s.Unit, s.Increasing, nonces)
+	mac, err := key.HMAC([]byte(s.Message(req, body, nonce)))
+	if err != nil {
+		return err
+	}
+	s.Header(req.Header, key.ID(), nonce, hex.EncodeToString(mac))
+	return nil
+}
+
+// JWT signer putting an HS256 JSON web token into a header.
+type JWT struct {
+	Keys Keys
+	// Now clock of nonces. default time.Now.
+	Now func() time.Time
+	// Unit the nonce is the time in Unit.
+	Unit time.Duration
+	// Increasing make nonces of a key strictly increasing, for exchanges rejecting reused nonces.
+	Increasing bool
+	// Header name of the header.
+	Header string
+	// Claims claims of req with the nonce, marshaled to JSON.
+	Claims func(req *http.Request, apiKey, nonce string) interface{}
+}
+
+// jwtHeader {"alg":"HS256","typ":"JWT"}
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Sign sign req.
+func (s *JWT) Sign(req *http.Request, body []byte) error {
+	key, nonces := s.Keys.Next(req)
+	nonce := nonceOf(now(s.Now), s.Unit, s.Increasing, nonces)
+	claims, err := json.Marshal(s.Claims(req, key.ID(), nonce))
+	if err != nil {
+		return err
+	}
+	token := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	mac, err := key.HMAC([]byte(token))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(s.Header, token+"."+base64.RawURLEncoding.EncodeToString(mac))
+	return nil
+}
+
+func now(f func() time.Time) time.Time {
+	if f == nil {
+		return time.Now()
+	}
+	return f()
+}
+
+// nonceOf t in unit. 同じキーで同じ時刻に2回署名しても重複しないようにできる
+func nonceOf(t time.Time, unit time.Duration, increasing bool, nonces *Nonce) string {
+	n := t.UnixNano() / int64(unit)
+	if increasing {
+		n = nonces.Next(n)
+	}
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,195 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/TTRSQ/ccew/interface/exchange"
+)
+
+// Nonce strictly increasing nonces of a key. safe for concurrent use.
+type Nonce struct {
+	mu   sync.Mutex
+	last int64
+}
+
+// Next t, or the last nonce + 1 if t is not larger than it.
+func (n *Nonce) Next(t int64) int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if t <= n.last {
+		t = n.last + 1
+	}
+	n.last = t
+	return t
+}
+
+// DefaultCooldown time a rejected key is out of rotation if Pool.Cooldown is not set.
+const DefaultCooldown = 30 * time.Second
+
+type member struct {
+	key   Key
+	nonce Nonce
+	// until 拒否されたキーはこの時刻まで使わない
+	until time.Time
+}
+
+// Pool keys used in turn. a key rejected by the exchange, e.g. by an auth error or a rate limit, is out of
+// rotation for Cooldown. if every key is out, the one coming back first is used. safe for concurrent use.
+type Pool struct {
+	// Cooldown default DefaultCooldown.
+	Cooldown time.Duration
+	// Reject true if resp rejects the key. body is the response body. default Rejected.
+	Reject func(resp *http.Response, body []byte) bool
+
+	mu      sync.Mutex
+	members []*member
+	next    int
+	now     func() time.Time
+}
+
+// NewPool pool of keys. keys must not be empty.
+func NewPool(keys ...Key) *Pool {
+	p := &Pool{now: time.Now}
+	for _, k := range keys {
+		p.members = append(p.members, &member{key: k})
+	}
+	return p
+}
+
+// PoolOf pool of an adapter: the key of KeyOf and SpecificParam additional_keys ([][]string{ [id, sec].. }).
+func PoolOf(key exchange.Key) (*Pool, error) {
+	k, err := KeyOf(key)
+	if err != nil {
+		return nil, err
+	}
+	keys := []Key{k}
+	// nonceError回避用のkeyを追加する
+	if key.SpecificParam["additional_keys"] != nil {
+		for _, pair := range key.SpecificParam["additional_keys"].([][]string) {
+			keys = append(keys, Secret{APIKey: pair[0], APISecKey: pair[1]})
+		}
+	}
+	return NewPool(keys...), nil
+}
+
+// Next key of req in turn, with its nonces. req marked by Pin uses the pinned key even if it is out of rotation.
+func (p *Pool) Next(req *http.Request) (Key, *Nonce) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	var m *member
+	if id, ok := req.Context().Value(pinKey{}).(string); ok {
+		for _, c := range p.members {
+			if c.key.ID() == id {
+				m = c
+				break
+			}
+		}
+	}
+	for i := 0; m == nil && i < len(p.members); i++ {
+		idx := (p.next + i) % len(p.members)
+		if !now.Before(p.members[idx].until) {
+			m = p.members[idx]
+			p.next = idx + 1
+		}
+	}
+	if m == nil {
+		m = p.members[0]
+		for _, c := range p.members {
+			if c.until.Before(m.until) {
+				m = c
+			}
+		}
+	}
+	if t, ok := req.Context().Value(trackKey{}).(*tracked); ok {
+		t.pool, t.member = p, m
+	}
+	return m.key, &m.nonce
+}
+
+// Available keys in rotation now.
+func (p *Pool) Available() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, m := range p.members {
+		if !p.now().Before(m.until) {
+			n++
+		}
+	}
+	return n
+}
+
+// Rejected 401, 403 and 429.
+func Rejected(resp *http.Response, body []byte) bool {
+	return resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden ||
+		resp.StatusCode == http.StatusTooManyRequests
+}
+
+func (p *Pool) observe(m *member, resp *http.Response) {
+	reject := p.Reject
+	if reject == nil {
+		reject = Rejected
+	}
+	// 本文を読んで戻す. 読めなかったことは呼び出し元に伝える
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		resp.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+		return
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if !reject(resp, body) {
+		return
+	}
+	cooldown := p.Cooldown
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m.until = p.now().Add(cooldown)
+}
+
+type pinKey struct{}
+
+// Pin make req signed by the key of id, e.g. to keep a session bound to the key. unknown id is ignored.
+func Pin(req *http.Request, id string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), pinKey{}, id))
+}
+
+type trackKey struct{}
+
+// tracked 署名に使ったキー
+type tracked struct {
+	pool   *Pool
+	member *member
+}
+
+// Track prepare req to report the key signing it by Done. the HTTP client calls it before signing.
+func Track(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), trackKey{}, &tracked{}))
+}
+
+// Done report the response of req prepared by Track to the pool of its key.
+func Done(req *http.Request, resp *http.Response, err error) {
+	t, ok := req.Context().Value(trackKey{}).(*tracked)
+	if !ok || t.pool == nil || err != nil || resp == nil {
+		return
+	}
+	t.pool.observe(t.member, resp)
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
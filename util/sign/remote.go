@@ -0,0 +1,122 @@
+package sign
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// remote protocol: one JSON line per request and response on a connection.
+type remoteReq struct {
+	Key string `json:"key"`
+	Msg []byte `json:"msg"`
+}
+
+type remoteRes struct {
+	MAC []byte `json:"mac,omitempty"`
+	Err string `json:"err,omitempty"`
+}
+
+// remoteTimeout 署名プロセスが応答しないときに諦めるまでの時間
+const remoteTimeout = 5 * time.Second
+
+type remote struct {
+	network string
+	addr    string
+	apiKey  string
+
+	// mu 1つの接続で順番に問い合わせる
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Remote key whose secret is held by a signing process listening on a local socket, e.g.
+// Remote("unix", "/run/ccew/signer.sock", apiKey). the process runs Serve. secrets never enter this process.
+func Remote(network, addr, apiKey string) Key {
+	return &remote{network: network, addr: addr, apiKey: apiKey}
+}
+
+func (k *remote) ID() string {
+	return k.apiKey
+}
+
+func (k *remote) HMAC(msg []byte) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	res, err := k.call(remoteReq{Key: k.apiKey, Msg: msg})
+	if err != nil {
+		// 次の呼び出しで繋ぎ直す
+		if k.conn != nil {
+			k.conn.Close()
+			k.conn = nil
+		}
+		return nil, err
+	}
+	if res.Err != "" {
+		return nil, errors.New(res.Err)
+	}
+	return res.MAC, nil
+}
+
+func (k *remote) call(req remoteReq) (remoteRes, error) {
+	res := remoteRes{}
+	if k.conn == nil {
+		conn, err := net.DialTimeout(k.network, k.addr, remoteTimeout)
+		if err != nil {
+			return res, err
+		}
+		k.conn, k.r = conn, bufio.NewReader(conn)
+	}
+	k.conn.SetDeadline(time.Now().Add(remoteTimeout))
+	line, err := json.Marshal(req)
+	if err != nil {
+		return res, err
+	}
+	if _, err := k.conn.Write(append(line, '\n')); err != nil {
+		return res, err
+	}
+	line, err = k.r.ReadBytes('\n')
+	if err != nil {
+		return res, err
+	}
+	return res, json.Unmarshal(line, &res)
+}
+
+// Serve answer HMAC requests of Remote keys on l by secrets of API keys, until l is closed.
+// run it in the signing process.
+func Serve(l net.Listener, secrets map[string]string) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveConn(conn, secrets)
+	}
+}
+
+func serveConn(conn net.Conn, secrets map[string]string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		req, res := remoteReq{}, remoteRes{}
+		if err := json.Unmarshal(line, &req); err != nil {
+			res.Err = err.Error()
+		} else if sec, exist := secrets[req.Key]; !exist {
+			res.Err = "unknown key."
+		} else {
+			res.MAC, _ = Secret{APIKey: req.Key, APISecKey: sec}.HMAC(req.Msg)
+		}
+		if enc.Encode(res) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/TTRSQ/ccew/interface/exchange"
+)
+
+// Signer signs requests of an exchange. the HTTP client calls it before every attempt, with the body
+// of the request. it sets headers or rewrites the query or the body (see SetBody).
+type Signer interface {
+	Sign(req *http.Request, body []byte) error
+}
+
+// Func Signer of a function.
+type Func func(req *http.Request, body []byte) error
+
+// Sign call f.
+func (f Func) Sign(req *http.Request, body []byte) error {
+	return f(req, body)
+}
+
+// Key API key. the secret can be held by another process (see Remote).
+type Key interface {
+	// ID API key sent to the exchange.
+	ID() string
+	// HMAC HMAC-SHA256 of msg by the secret.
+	HMAC(msg []byte) ([]byte, error)
+}
+
+// Secret key with the secret in memory.
+type Secret struct {
+	APIKey    string
+	APISecKey string
+}
+
+// ID API key.
+func (s Secret) ID() string {
+	return s.APIKey
+}
+
+// HMAC HMAC-SHA256 of msg.
+func (s Secret) HMAC(msg []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, []byte(s.APISecKey))
+	mac.Write(msg)
+	return mac.Sum(nil), nil
+}
+
+// Keys chooses the key of each request.
+type Keys interface {
+	// Next key of req, with its nonces.
+	Next(req *http.Request) (Key, *Nonce)
+}
+
+type single struct {
+	key   Key
+	nonce Nonce
+}
+
+func (s *single) Next(req *http.Request) (Key, *Nonce) {
+	return s.key, &s.nonce
+}
+
+// Single Keys always choosing k.
+func Single(k Key) Keys {
+	return &single{key: k}
+}
+
+// KeyOf key of an adapter. SpecificParam signKey (sign.Key) replaces APISecKey, e.g. by Remote.
+func KeyOf(key exchange.Key) (Key, error) {
+	if key.SpecificParam["signKey"] != nil {
+		k := key.SpecificParam["signKey"].(Key)
+		if k.ID() == "" {
+			return nil, errors.New("APIKey of signKey Required")
+		}
+		return k, nil
+	}
+	if key.APIKey == "" || key.APISecKey == "" {
+		return nil, errors.New("APIKey and APISecKey Required")
+	}
+	return Secret{APIKey: key.APIKey, APISecKey: key.APISecKey}, nil
+}
+
+type publicKey struct{}
+
+// Public mark req as a public request, which is sent without signing.
+func Public(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), publicKey{}, true))
+}
+
+// IsPublic true if req is marked by Public.
+func IsPublic(req *http.Request) bool {
+	return req.Context().Value(publicKey{}) != nil
+}
+
+// SetBody replace the body of req, e.g. to add the signature to it.
+func SetBody(req *http.Request, body []byte) {
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+}
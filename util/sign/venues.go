@@ -0,0 +1,271 @@
+package sign
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// signers of exchanges.
+
+// Bitflyer HMAC of timestamp (seconds) + method + path and query + body.
+func Bitflyer(keys Keys) *HMAC {
+	return &HMAC{
+		Keys: keys,
+		Unit: time.Second,
+		Message: func(req *http.Request, body []byte, nonce string) string {
+			return nonce + req.Method + pathQuery(req) + string(body)
+		},
+		Header: func(h http.Header, apiKey, nonce, sign string) {
+			h.Set("ACCESS-KEY", apiKey)
+			h.Set("ACCESS-TIMESTAMP", nonce)
+			h.Set("ACCESS-SIGN", sign)
+		},
+	}
+}
+
+// Ftx HMAC of timestamp (ms) + method + path and query + body. subaccount is sent if not empty.
+func Ftx(keys Keys, subaccount string) *HMAC {
+	return &HMAC{
+		Keys: keys,
+		Unit: time.Millisecond,
+		Message: func(req *http.Request, body []byte, nonce string) string {
+			return nonce + req.Method + pathQuery(req) + string(body)
+		},
+		Header: func(h http.Header, apiKey, nonce, sign string) {
+			h.Set("FTX-KEY", apiKey)
+			h.Set("FTX-TS", nonce)
+			h.Set("FTX-SIGN", sign)
+			if subaccount != "" {
+				h.Set("FTX-SUBACCOUNT", subaccount)
+			}
+		},
+	}
+}
+
+// Gmo HMAC of timestamp (ms) + method + path without /private + body. the query is not signed.
+func Gmo(keys Keys) *HMAC {
+	return &HMAC{
+		Keys: keys,
+		Unit: time.Millisecond,
+		Message: func(req *http.Request, body []byte, nonce string) string {
+			msg := nonce + req.Method + strings.TrimPrefix(req.URL.Path, "/private")
+			// ws-authは署名にbodyを含めない
+			if strings.HasSuffix(req.URL.Path, "/ws-auth") {
+				return msg
+			}
+			return msg + string(body)
+		},
+		Header: func(h http.Header, apiKey, nonce, sign string) {
+			h.Set("API-KEY", apiKey)
+			h.Set("API-TIMESTAMP", nonce)
+			h.Set("API-SIGN", sign)
+		},
+	}
+}
+
+// Bitbank HMAC of nonce (ns) + path and query for GET, nonce + body for the others.
+func Bitbank(keys Keys) *HMAC {
+	return &HMAC{
+		Keys:       keys,
+		Unit:       time.Nanosecond,
+		Increasing: true,
+		Message: func(req *http.Request, body []byte, nonce string) string {
+			if req.Method == http.MethodGet {
+				return nonce + pathQuery(req)
+			}
+			return nonce + string(body)
+		},
+		Header: nonceHeader,
+	}
+}
+
+// Coincheck HMAC of nonce (ns) + URL + body.
+func Coincheck(keys Keys) *HMAC {
+	return &HMAC{
+		Keys:       keys,
+		Unit:       time.Nanosecond,
+		Increasing: true,
+		Message: func(req *http.Request, body []byte, nonce string) string {
+			return nonce + req.URL.String() + string(body)
+		},
+		Header: nonceHeader,
+	}
+}
+
+// Liquid JWT of path, nonce (ms) and token id in X-Quoine-Auth. GET signs the path with "?" and the query.
+func Liquid(keys Keys) *JWT {
+	return &JWT{
+		Keys:       keys,
+		Unit:       time.Millisecond,
+		Increasing: true,
+		Header:     "X-Quoine-Auth",
+		Claims: func(req *http.Request, apiKey, nonce string) interface{} {
+			path := req.URL.Path
+			if req.Method == http.MethodGet {
+				path += "?" + req.URL.RawQuery
+			}
+			return struct {
+				Path    string `json:"path"`
+				Nonce   string `json:"nonce"`
+				TokenID string `json:"token_id"`
+			}{path, nonce, apiKey}
+		},
+	}
+}
+
+// Params signer adding api_key, timestamp (ms) and sign to the parameters, which are the query of GET and
+// the JSON body of the others. sign is HMAC of the parameters sorted by key. bybit signs so.
+type Params struct {
+	Keys Keys
+	// Now clock of timestamps. default time.Now.
+	Now func() time.Time
+}
+
+// Bybit signer of bybit.
+func Bybit(keys Keys) *Params {
+	return &Params{Keys: keys}
+}
+
+// Sign sign req.
+func (s *Params) Sign(req *http.Request, body []byte) error {
+	key, _ := s.Keys.Next(req)
+	param := map[string]string{}
+	if req.Method == http.MethodGet {
+		for _, pair := range strings.Split(req.URL.RawQuery, "&") {
+			if pair == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) == 1 {
+				kv = append(kv, "")
+			}
+			param[kv[0]] = kv[1]
+		}
+	} else if len(body) > 0 {
+		if err := json.Unmarshal(body, &param); err != nil {
+			return err
+		}
+	}
+	param["api_key"] = key.ID()
+	param["timestamp"] = nonceOf(now(s.Now), time.Millisecond, false, nil)
+
+	query := sortedQuery(param)
+	mac, err := key.HMAC([]byte(query))
+	if err != nil {
+		return err
+	}
+	sign := fmt.Sprintf("%x", mac)
+	if req.Method == http.MethodGet {
+		req.URL.RawQuery = query + "&sign=" + sign
+		return nil
+	}
+	param["sign"] = sign
+	signed, err := json.Marshal(param)
+	if err != nil {
+		return err
+	}
+	SetBody(req, signed)
+	return nil
+}
+
+// BitbankRejected Rejected, and error codes of authentication (20001-20005) and too many requests (10009).
+func BitbankRejected(resp *http.Response, body []byte) bool {
+	if Rejected(resp, body) {
+		return true
+	}
+	res := struct {
+		Success int `json:"success"`
+		Data    struct {
+			Code int `json:"code"`
+		} `json:"data"`
+	}{}
+	if json.Unmarshal(body, &res) != nil || res.Success == 1 {
+		return false
+	}
+	return (20001 <= res.Data.Code && res.Data.Code <= 20005) || res.Data.Code == 10009
+}
+
+// BybitRejected Rejected, and ret_code of invalid api key (10003), invalid sign (10004) and too many visits
+// (10006), which bybit returns with 200.
+func BybitRejected(resp *http.Response, body []byte) bool {
+	if Rejected(resp, body) {
+		return true
+	}
+	res := struct {
+		RetCode int `json:"ret_code"`
+	}{}
+	if json.Unmarshal(body, &res) != nil {
+		return false
+	}
+	return res.RetCode == 10003 || res.RetCode == 10004 || res.RetCode == 10006
+}
+
+// GmoRejected Rejected, and messages of too many requests (ERR-5003) and authentication (ERR-5010 - ERR-5012),
+// which gmo returns with 200.
+func GmoRejected(resp *http.Response, body []byte) bool {
+	if Rejected(resp, body) {
+		return true
+	}
+	res := struct {
+		Status   int `json:"status"`
+		Messages []struct {
+			MessageCode string `json:"message_code"`
+		} `json:"messages"`
+	}{}
+	if json.Unmarshal(body, &res) != nil || res.Status == 0 {
+		return false
+	}
+	for _, m := range res.Messages {
+		switch m.MessageCode {
+		case "ERR-5003", "ERR-5010", "ERR-5011", "ERR-5012":
+			return true
+		}
+	}
+	return false
+}
+
+// BitflyerRejected Rejected, and status of authentication (-500 - -509), which bitflyer may return with 400.
+func BitflyerRejected(resp *http.Response, body []byte) bool {
+	if Rejected(resp, body) {
+		return true
+	}
+	res := struct {
+		Status int `json:"status"`
+	}{}
+	if json.Unmarshal(body, &res) != nil {
+		return false
+	}
+	return -509 <= res.Status && res.Status <= -500
+}
+
+func nonceHeader(h http.Header, apiKey, nonce, sign string) {
+	h.Set("ACCESS-KEY", apiKey)
+	h.Set("ACCESS-NONCE", nonce)
+	h.Set("ACCESS-SIGNATURE", sign)
+}
+
+// pathQuery path and the query if any.
+func pathQuery(req *http.Request) string {
+	if req.URL.RawQuery == "" {
+		return req.URL.Path
+	}
+	return req.URL.Path + "?" + req.URL.RawQuery
+}
+
+// sortedQuery k=v pairs sorted by key. values are not escaped.
+func sortedQuery(param map[string]string) string {
+	keys := make([]string, 0, len(param))
+	for k := range param {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+param[k])
+	}
+	return strings.Join(pairs, "&")
+}
@@ -0,0 +1,200 @@
+package wsconn
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Conn websocket connection. received messages are passed to handler on a goroutine.
+type Conn struct {
+	ws *websocket.Conn
+
+	writeMu  sync.Mutex
+	mu       sync.Mutex
+	err      error
+	lastRecv time.Time
+	closed   bool
+	// stopped errが決まると閉じる
+	stopped chan struct{}
+}
+
+// Dial connect to rawURL. proxyURL can be nil.
+func Dial(rawURL string, proxyURL *url.URL) (*Conn, error) {
+	dialer := *websocket.DefaultDialer
+	if proxyURL != nil {
+		dialer.Proxy = http.ProxyURL(proxyURL)
+	}
+	ws, _, err := dialer.Dial(rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{ws: ws, lastRecv: time.Now(), stopped: make(chan struct{})}
+	ws.SetPongHandler(func(string) error {
+		c.touch()
+		return nil
+	})
+	return c, nil
+}
+
+// WriteJSON send v as json text message.
+func (c *Conn) WriteJSON(v interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.ws.WriteJSON(v)
+}
+
+// ReadJSON read one message synchronously. use it before Listen (e.g. waiting auth result).
+func (c *Conn) ReadJSON(v interface{}, timeout time.Duration) error {
+	c.ws.SetReadDeadline(time.Now().Add(timeout))
+	defer c.ws.SetReadDeadline(time.Time{})
+	err := c.ws.ReadJSON(v)
+	if err == nil {
+		c.touch()
+	}
+	return err
+}
+
+// Listen start reading messages. the loop stops at the first error, which can be got by Err.
+func (c *Conn) Listen(handler func(msg []byte)) {
+	go func() {
+		for {
+			_, msg, err := c.ws.ReadMessage()
+			if err != nil {
+				c.setErr(err)
+				return
+			}
+			c.touch()
+			handler(msg)
+		}
+	}()
+}
+
+// Ping send websocket ping frame. pong updates LastReceived.
+func (c *Conn) Ping() error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+}
+
+// Err return the error which stopped the connection.
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// LastReceived return the time of the last message (including pong).
+func (c *Conn) LastReceived() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastRecv
+}
+
+// Close close the connection.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.stop(errors.New("connection closed."))
+	c.mu.Unlock()
+	return c.ws.Close()
+}
+
+// Fail close the connection with err. use it when the server reports a fatal error.
+func (c *Conn) Fail(err error) error {
+	c.setErr(err)
+	return c.Close()
+}
+
+func (c *Conn) setErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stop(err)
+}
+
+// stop 最初のエラーだけ残す. c.mu を持って呼ぶ
+func (c *Conn) stop(err error) {
+	if c.err == nil {
+		c.err = err
+		close(c.stopped)
+	}
+}
+
+// WakeOnClose wake q when the connection stops, so that readers waiting on q.Ready see Err.
+func (c *Conn) WakeOnClose(q *Queue) {
+	go func() {
+		<-c.stopped
+		q.Wake()
+	}()
+}
+
+func (c *Conn) touch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastRecv = time.Now()
+}
+
+// Queue unbounded fifo shared between reader goroutine and Read.
+type Queue struct {
+	mu    sync.Mutex
+	items []interface{}
+	ready chan struct{}
+}
+
+// Push add v to the tail.
+func (q *Queue) Push(v interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, v)
+	q.wake()
+}
+
+// Ready receive after Push or Wake. pop until empty after receiving, signals are merged.
+func (q *Queue) Ready() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.readyChan()
+}
+
+// Wake signal Ready without a value, e.g. when the connection stops.
+func (q *Queue) Wake() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.wake()
+}
+
+func (q *Queue) wake() {
+	select {
+	case q.readyChan() <- struct{}{}:
+	default:
+	}
+}
+
+// readyChan ゼロ値のQueueも使えるように初めて使うときに作る
+func (q *Queue) readyChan() chan struct{} {
+	if q.ready == nil {
+		q.ready = make(chan struct{}, 1)
+	}
+	return q.ready
+}
+
+// Pop remove the head. return nil when empty.
+func (q *Queue) Pop() interface{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return nil
+	}
+	v := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	return v
+}